@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
 
 	"github.com/dimmy-kor/audioguid/internal/api"
 	"github.com/dimmy-kor/audioguid/internal/database"
@@ -29,6 +30,16 @@ import (
 
 // @schemes http https
 
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API-ключ клиента (ag_...)
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT пользователя: "Bearer <token>"
+
 func main() {
 	// Загрузка переменных окружения
 	if err := godotenv.Load(); err != nil {
@@ -49,11 +60,20 @@ func main() {
 	// Настройка Gin
 	router := gin.Default()
 
+	// IP клиента для ограничения частоты: X-Forwarded-For учитывается только от своих прокси
+	if err := router.SetTrustedProxies(trustedProxies()); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID, Range, If-None-Match, If-Range")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, "+
+			"ETag, Accept-Ranges, Content-Range, Content-Length, "+
+			"X-Quota-Waypoints-Limit, X-Quota-Waypoints-Remaining, X-Quota-Waypoints-Reset, "+
+			"X-Quota-Characters-Limit, X-Quota-Characters-Remaining, X-Quota-Characters-Reset")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -80,3 +100,15 @@ func main() {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+// trustedProxies читает TRUSTED_PROXIES: адреса или подсети через запятую.
+// По умолчанию прокси не доверяем.
+func trustedProxies() []string {
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
@@ -0,0 +1,475 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AdminHandler - редакционные и административные эндпоинты
+type AdminHandler struct {
+	reviewService *services.ReviewService
+	poiService    *services.POIService
+	authService   *services.AuthService
+	db            *gorm.DB
+}
+
+func NewAdminHandler(review *services.ReviewService, poi *services.POIService, auth *services.AuthService, db *gorm.DB) *AdminHandler {
+	return &AdminHandler{
+		reviewService: review,
+		poiService:    poi,
+		authService:   auth,
+		db:            db,
+	}
+}
+
+// ListContent возвращает контент для редакционной проверки
+// @Summary      Список контента на проверку
+// @Description  Возвращает сгенерированные рассказы с указанным статусом (по умолчанию pending_review)
+// @Tags         admin
+// @Produce      json
+// @Param        status query string false "Статус (draft, pending_review, approved, rejected, all)"
+// @Param        limit query int false "Размер страницы (по умолчанию 50)"
+// @Param        offset query int false "Смещение"
+// @Success      200 {object} models.ContentReviewList
+// @Failure      500 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/content [get]
+func (h *AdminHandler) ListContent(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ContentStatusPendingReview)
+	if status == "all" {
+		status = ""
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	contents, total, err := h.reviewService.List(status, limit, offset)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch content")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ContentReviewList{
+		Items: h.formatContentReviews(contents),
+		Total: total,
+	})
+}
+
+// GetContent возвращает контент для редактора
+// @Summary      Получить контент
+// @Description  Возвращает текст, источники и результаты проверки фактов
+// @Tags         admin
+// @Produce      json
+// @Param        content_id path string true "Content ID"
+// @Success      200 {object} models.ContentReview
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/content/{content_id} [get]
+func (h *AdminHandler) GetContent(c *gin.Context) {
+	contentID, ok := parseContentID(c)
+	if !ok {
+		return
+	}
+
+	content, err := h.reviewService.Get(contentID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Content not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.formatContentReviews([]models.Content{*content})[0])
+}
+
+// UpdateContent заменяет текст и заново синтезирует аудио
+// @Summary      Править текст
+// @Description  Сохраняет исправленный редактором текст, заново генерирует аудио и возвращает контент в статус pending_review
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        content_id path string true "Content ID"
+// @Param        request body models.ContentEditRequest true "Новый текст"
+// @Success      200 {object} models.ContentReview
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      500 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/content/{content_id} [put]
+func (h *AdminHandler) UpdateContent(c *gin.Context) {
+	contentID, ok := parseContentID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ContentEditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	content, err := h.reviewService.UpdateText(contentID, req.Text, principalName(c))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, CodeNotFound, "Content not found")
+			return
+		}
+		respondServiceError(c, err, "Failed to update content")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.formatContentReviews([]models.Content{*content})[0])
+}
+
+// ApproveContent одобряет контент
+// @Summary      Одобрить контент
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        content_id path string true "Content ID"
+// @Param        request body models.ContentDecisionRequest false "Комментарий редактора"
+// @Success      200 {object} models.ContentReview
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      409 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/content/{content_id}/approve [post]
+func (h *AdminHandler) ApproveContent(c *gin.Context) {
+	h.decide(c, models.ContentStatusApproved)
+}
+
+// RejectContent отклоняет контент
+// @Summary      Отклонить контент
+// @Description  Отклоненный контент не отдается в публичных маршрутах. Комментарий обязателен.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        content_id path string true "Content ID"
+// @Param        request body models.ContentDecisionRequest true "Причина отклонения"
+// @Success      200 {object} models.ContentReview
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/content/{content_id}/reject [post]
+func (h *AdminHandler) RejectContent(c *gin.Context) {
+	h.decide(c, models.ContentStatusRejected)
+}
+
+func (h *AdminHandler) decide(c *gin.Context, status string) {
+	contentID, ok := parseContentID(c)
+	if !ok {
+		return
+	}
+
+	var req models.ContentDecisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	// Решение подписывается именем ключа или пользователя, а не полем запроса
+	reviewer := principalName(c)
+
+	var content *models.Content
+	var err error
+	if status == models.ContentStatusApproved {
+		content, err = h.reviewService.Approve(contentID, reviewer, req.Comment)
+	} else {
+		if req.Comment == "" {
+			respondError(c, http.StatusBadRequest, CodeValidationFailed, "Comment is required to reject content")
+			return
+		}
+		content, err = h.reviewService.Reject(contentID, reviewer, req.Comment)
+	}
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, CodeNotFound, "Content not found")
+			return
+		}
+		respondServiceError(c, err, "Failed to update content")
+		return
+	}
+
+	c.JSON(http.StatusOK, h.formatContentReviews([]models.Content{*content})[0])
+}
+
+// PromotePOI переносит пользовательское место в общий каталог
+// @Summary      Опубликовать пользовательское место
+// @Description  Делает приватное место из custom_pois публичным: оно появится в /api/pois и в автоподборе маршрутов
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        poi_id path string true "POI ID"
+// @Param        request body models.POIPromoteRequest false "Уточнение важности, эпохи и категории"
+// @Success      200 {object} models.POI
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/pois/{poi_id}/promote [post]
+func (h *AdminHandler) PromotePOI(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("poi_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid POI ID")
+		return
+	}
+
+	var req models.POIPromoteRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	poi, err := h.poiService.Promote(uid.String(), req.Importance, req.Epoch, req.Category)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, CodeNotFound, "POI not found")
+			return
+		}
+		respondServiceError(c, err, "Failed to promote POI")
+		return
+	}
+
+	c.JSON(http.StatusOK, poi)
+}
+
+// SetPOITriggerRadius задает радиус срабатывания рассказа о месте
+// @Summary      Радиус срабатывания рассказа
+// @Description  На каком расстоянии от места навигация (/api/routes/{route_id}/navigation) начинает рассказ. 0 - по умолчанию для способа передвижения (пешком 30 м, велосипед 60 м, транспорт и машина 150 м). Для больших объектов (парк, площадь) радиус стоит увеличить.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        poi_id path string true "POI ID"
+// @Param        request body models.POITriggerRadiusRequest true "Радиус, метры"
+// @Success      200 {object} models.POI
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/pois/{poi_id}/trigger-radius [put]
+func (h *AdminHandler) SetPOITriggerRadius(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("poi_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid POI ID")
+		return
+	}
+
+	var req models.POITriggerRadiusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	poi, err := h.poiService.SetTriggerRadius(uid.String(), req.TriggerRadius)
+	if err != nil {
+		respondServiceError(c, err, "Failed to update POI")
+		return
+	}
+
+	c.JSON(http.StatusOK, poi)
+}
+
+// CreateAPIKey выпускает API-ключ
+// @Summary      Выпустить API-ключ
+// @Description  Создает ключ клиента с правами routes:generate, pois:write и/или admin. Секрет возвращается только в этом ответе, в БД хранится его хеш.
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Param        request body models.APIKeyCreateRequest true "Название и права ключа"
+// @Success      201 {object} models.APIKeyCreated
+// @Failure      400 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/keys [post]
+func (h *AdminHandler) CreateAPIKey(c *gin.Context) {
+	var req models.APIKeyCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &expires
+	}
+
+	key, secret, err := h.authService.IssueKey(req.Name, req.Scopes, expiresAt, principalName(c))
+	if err != nil {
+		respondServiceError(c, err, "Failed to create API key")
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIKeyCreated{
+		APIKeyResponse: formatAPIKey(key),
+		Key:            secret,
+	})
+}
+
+// ListAPIKeys возвращает выпущенные API-ключи
+// @Summary      Список API-ключей
+// @Description  Возвращает ключи без секретов, включая отозванные
+// @Tags         admin
+// @Produce      json
+// @Success      200 {array} models.APIKeyResponse
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/keys [get]
+func (h *AdminHandler) ListAPIKeys(c *gin.Context) {
+	keys, err := h.authService.ListKeys()
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch API keys")
+		return
+	}
+
+	response := make([]models.APIKeyResponse, len(keys))
+	for i := range keys {
+		response[i] = formatAPIKey(&keys[i])
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeAPIKey отзывает API-ключ
+// @Summary      Отозвать API-ключ
+// @Description  Отозванный ключ сразу перестает приниматься
+// @Tags         admin
+// @Produce      json
+// @Param        key_id path string true "API key ID"
+// @Success      200 {object} models.APIKeyResponse
+// @Failure      400 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Failure      404 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /admin/keys/{key_id} [delete]
+func (h *AdminHandler) RevokeAPIKey(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("key_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid API key ID")
+		return
+	}
+
+	key, err := h.authService.RevokeKey(uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, CodeNotFound, "API key not found")
+			return
+		}
+		respondServiceError(c, err, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusOK, formatAPIKey(key))
+}
+
+func formatAPIKey(key *models.APIKey) models.APIKeyResponse {
+	return models.APIKeyResponse{
+		ID:         key.ID.String(),
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     key.Scopes,
+		CreatedBy:  key.CreatedBy,
+		ExpiresAt:  key.ExpiresAt,
+		RevokedAt:  key.RevokedAt,
+		LastUsedAt: key.LastUsedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// formatContentReviews дополняет контент данными о точке и месте
+func (h *AdminHandler) formatContentReviews(contents []models.Content) []models.ContentReview {
+	waypointIDs := make([]uuid.UUID, len(contents))
+	for i, content := range contents {
+		waypointIDs[i] = content.WaypointID
+	}
+
+	var waypoints []models.Waypoint
+	if len(waypointIDs) > 0 {
+		h.db.Preload("POI").Where("id IN ?", waypointIDs).Find(&waypoints)
+	}
+
+	byID := make(map[uuid.UUID]models.Waypoint, len(waypoints))
+	for _, wp := range waypoints {
+		byID[wp.ID] = wp
+	}
+
+	reviews := make([]models.ContentReview, len(contents))
+	for i, content := range contents {
+		review := models.ContentReview{
+			ID:               content.ID.String(),
+			WaypointID:       content.WaypointID.String(),
+			Text:             content.Text,
+			AudioURL:         content.AudioURL,
+			Status:           content.Status,
+			FactCheckVerdict: content.FactCheckVerdict,
+			FactCheckIssues:  content.FactCheckIssues,
+			Sources:          content.Sources,
+			ReviewComment:    content.ReviewComment,
+			ReviewedBy:       content.ReviewedBy,
+			ReviewedAt:       content.ReviewedAt,
+			CreatedAt:        content.CreatedAt,
+			UpdatedAt:        content.UpdatedAt,
+		}
+
+		if wp, ok := byID[content.WaypointID]; ok {
+			review.RouteID = wp.RouteID.String()
+			review.POIID = wp.POIID.String()
+			review.POIName = wp.POI.Name
+		}
+
+		reviews[i] = review
+	}
+
+	return reviews
+}
+
+func parseContentID(c *gin.Context) (string, bool) {
+	uid, err := uuid.Parse(c.Param("content_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid content ID")
+		return "", false
+	}
+	return uid.String(), true
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Аудио по версионной ссылке (?v=<версия>) не меняется - кэшируется на год.
+// Без версии клиент может хранить копию, но перепроверяет ее по ETag.
+const (
+	audioCacheImmutable  = "public, max-age=31536000, immutable"
+	audioCacheRevalidate = "public, no-cache"
+)
+
+// serveAudio отдает аудио из хранилища с ETag по версии аудио и поддержкой Range (206).
+// Если хранилище выдает временные ссылки, отвечает редиректом на них.
+func (h *RouteHandler) serveAudio(c *gin.Context, key, version, downloadName string) {
+	if audioNotModified(c, version) {
+		return
+	}
+
+	if h.audioURLTTL > 0 {
+		url, err := h.audioStore.PresignedURL(key, h.audioURLTTL)
+		if err != nil {
+			respondServiceError(c, err, "Failed to sign audio URL")
+			return
+		}
+		if url != "" {
+			// Ссылка временная - сам редирект кэшировать нельзя
+			c.Header("Cache-Control", "no-store")
+			c.Redirect(http.StatusFound, url)
+			return
+		}
+	}
+
+	reader, object, err := h.audioStore.Get(key)
+	if err != nil {
+		respondServiceError(c, err, "Failed to load audio")
+		return
+	}
+	defer reader.Close()
+
+	if downloadName != "" {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", downloadName))
+	}
+	c.Header("Content-Type", "audio/mpeg")
+
+	// ServeContent отвечает 206 на Range (и целым файлом, если If-Range устарел)
+	http.ServeContent(c.Writer, c.Request, path.Base(key), object.ModTime, reader)
+}
+
+// audioNotModified выставляет ETag и Cache-Control для версии аудио и отвечает 304,
+// если у клиента уже есть эта версия. Проверка идет до обращения к хранилищу.
+func audioNotModified(c *gin.Context, version string) bool {
+	etag := `"` + version + `"`
+	c.Header("ETag", etag)
+	if c.Query("v") == version {
+		c.Header("Cache-Control", audioCacheImmutable)
+	} else {
+		c.Header("Cache-Control", audioCacheRevalidate)
+	}
+
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+	if !etagMatches(c.GetHeader("If-None-Match"), etag) {
+		return false
+	}
+
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// etagMatches проверяет If-None-Match: список ETag через запятую или "*", сравнение слабое
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	principalKey = "principal"
+)
+
+// Authenticate определяет клиента по заголовку X-API-Key или Authorization: Bearer
+// (API-ключ ag_... или JWT пользователя). Запрос без учетных данных проходит дальше
+// анонимно, а права проверяет RequireScope. Неверные учетные данные - всегда 401.
+// AUTH_DISABLED=true отключает проверку прав для локальной разработки:
+// все запросы выполняются от локального пользователя с правами admin.
+func Authenticate(auth *services.AuthService) gin.HandlerFunc {
+	disabled := os.Getenv("AUTH_DISABLED") == "true"
+
+	return func(c *gin.Context) {
+		if disabled {
+			c.Set(principalKey, &services.Principal{
+				Kind:   services.PrincipalUser,
+				ID:     "local",
+				Name:   "local",
+				Scopes: []string{models.ScopeAdmin},
+			})
+			c.Next()
+			return
+		}
+
+		credential, isKey := requestCredential(c)
+		if credential == "" {
+			c.Next()
+			return
+		}
+
+		var principal *services.Principal
+		var err error
+		if isKey {
+			principal, err = auth.AuthenticateKey(credential)
+		} else {
+			principal, err = auth.AuthenticateToken(credential)
+		}
+		if err != nil {
+			if errors.Is(err, services.ErrUnauthorized) {
+				respondUnauthorized(c, "Invalid credentials")
+				return
+			}
+			respondServiceError(c, err, "Failed to authenticate request")
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// RequireScope пропускает только клиентов с одним из указанных прав
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := currentPrincipal(c)
+		if principal == nil {
+			respondUnauthorized(c, "Authentication required")
+			return
+		}
+
+		for _, scope := range scopes {
+			if principal.HasScope(scope) {
+				c.Next()
+				return
+			}
+		}
+		respondErrorDetails(c, http.StatusForbidden, CodeForbidden, "Insufficient permissions",
+			gin.H{"required_scopes": scopes})
+	}
+}
+
+// RequireUser пропускает только пользователей с JWT: у API-ключа нет истории и избранного
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := currentPrincipal(c)
+		if principal == nil {
+			respondUnauthorized(c, "Authentication required")
+			return
+		}
+		if principal.Kind != services.PrincipalUser {
+			respondError(c, http.StatusForbidden, CodeForbidden, "User token required")
+			return
+		}
+		c.Next()
+	}
+}
+
+// currentPrincipal возвращает аутентифицированного клиента запроса (nil - анонимный)
+func currentPrincipal(c *gin.Context) *services.Principal {
+	if value, ok := c.Get(principalKey); ok {
+		if principal, ok := value.(*services.Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+// principalName - имя клиента запроса для журнала действий: имя ключа или пользователя,
+// а если имени в токене нет - его ID. Пусто только при AUTH_DISABLED.
+func principalName(c *gin.Context) string {
+	principal := currentPrincipal(c)
+	if principal == nil {
+		return ""
+	}
+	if principal.Name != "" {
+		return principal.Name
+	}
+	return principal.ID
+}
+
+// respondUnauthorized отвечает 401 с подсказкой схемы аутентификации
+func respondUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="audioguid"`)
+	respondError(c, http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// requestCredential извлекает учетные данные и сообщает, API-ключ ли это
+func requestCredential(c *gin.Context) (string, bool) {
+	if key := strings.TrimSpace(c.GetHeader(apiKeyHeader)); key != "" {
+		return key, true
+	}
+
+	header := c.GetHeader("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		token := strings.TrimSpace(header[7:])
+		return token, services.IsAPIKey(token)
+	}
+	return "", false
+}
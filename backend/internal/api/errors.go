@@ -0,0 +1,195 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Коды ошибок API
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeValidationFailed    = "validation_failed"
+	CodeModerationRejected  = "moderation_rejected"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeConflict            = "conflict"
+	CodeAudioNotReady       = "audio_not_ready"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeRateLimited         = "rate_limited"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeInternal            = "internal_error"
+)
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:audioguid:problem:"
+	requestIDHeader    = "X-Request-ID"
+	requestIDKey       = "request_id"
+)
+
+// APIError - ошибка API в формате RFC 7807 (application/problem+json).
+// code, message, details и request_id - расширения формата.
+type APIError struct {
+	Type      string      `json:"type" example:"urn:audioguid:problem:not_found"`
+	Title     string      `json:"title" example:"Not Found"`
+	Status    int         `json:"status" example:"404"`
+	Instance  string      `json:"instance,omitempty" example:"/api/routes/550e8400-e29b-41d4-a716-446655440000"`
+	Code      string      `json:"code" example:"not_found"`
+	Message   string      `json:"message" example:"Route not found"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+}
+
+// FieldError - ошибка валидации поля запроса
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+	Param string `json:"param,omitempty"`
+}
+
+// RequestID присваивает запросу идентификатор (или берет его из X-Request-ID)
+// и возвращает его в заголовке ответа
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > 128 {
+			id = newRequestID()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// respondError отвечает ошибкой в формате problem+json
+func respondError(c *gin.Context, status int, code, message string) {
+	respondErrorDetails(c, status, code, message, nil)
+}
+
+// respondErrorDetails отвечает ошибкой с дополнительными данными
+func respondErrorDetails(c *gin.Context, status int, code, message string, details interface{}) {
+	problem := APIError{
+		Type:      problemTypePrefix + code,
+		Title:     http.StatusText(status),
+		Status:    status,
+		Instance:  c.Request.URL.Path,
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.GetString(requestIDKey),
+	}
+
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(status, problem)
+}
+
+// respondBindError отвечает на ошибку разбора или валидации тела запроса
+func respondBindError(c *gin.Context, err error) {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, len(validationErrs))
+		for i, fe := range validationErrs {
+			fields[i] = FieldError{
+				Field: fieldPath(fe.Namespace()),
+				Rule:  fe.Tag(),
+				Param: fe.Param(),
+			}
+		}
+		respondErrorDetails(c, http.StatusBadRequest, CodeValidationFailed, "Request validation failed", fields)
+		return
+	}
+
+	respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Malformed request")
+}
+
+// respondServiceError сопоставляет ошибку сервиса со статусом HTTP.
+// Внутренние детали и ответы внешних API пишутся в лог, но не отдаются клиенту.
+func respondServiceError(c *gin.Context, err error, message string) {
+	var modErr *services.ModerationError
+	var quotaErr *services.QuotaExceededError
+
+	switch {
+	case errors.As(err, &modErr):
+		respondErrorDetails(c, http.StatusUnprocessableEntity, CodeModerationRejected, "Content rejected by moderation", modErr.Violations)
+	case errors.Is(err, services.ErrValidation):
+		respondError(c, http.StatusBadRequest, CodeValidationFailed, strings.TrimPrefix(err.Error(), services.ErrValidation.Error()+": "))
+	case errors.Is(err, services.ErrUnauthorized):
+		respondUnauthorized(c, "Authentication required")
+	case errors.Is(err, services.ErrForbidden):
+		respondError(c, http.StatusForbidden, CodeForbidden, "Insufficient permissions")
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, services.ErrNotFound):
+		respondError(c, http.StatusNotFound, CodeNotFound, "Resource not found")
+	case errors.Is(err, services.ErrInvalidTransition):
+		respondError(c, http.StatusConflict, CodeConflict, strings.TrimPrefix(err.Error(), services.ErrInvalidTransition.Error()+": "))
+	case errors.As(err, &quotaErr):
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(time.Until(quotaErr.ResetAt))))
+		respondErrorDetails(c, http.StatusTooManyRequests, CodeQuotaExceeded, quotaErr.Error(), gin.H{
+			"period":   quotaErr.Period,
+			"resource": quotaErr.Resource,
+			"limit":    quotaErr.Limit,
+			"reset_at": quotaErr.ResetAt,
+		})
+	case errors.Is(err, services.ErrQuotaExceeded):
+		respondError(c, http.StatusTooManyRequests, CodeQuotaExceeded, "Quota exceeded")
+	case errors.Is(err, services.ErrUpstreamUnavailable):
+		log.Printf("Upstream error [%s]: %v", c.GetString(requestIDKey), err)
+		respondError(c, http.StatusServiceUnavailable, CodeUpstreamUnavailable, "External service is temporarily unavailable")
+	default:
+		log.Printf("Error [%s]: %v", c.GetString(requestIDKey), err)
+		respondError(c, http.StatusInternalServerError, CodeInternal, message)
+	}
+}
+
+// fieldPath отбрасывает имя структуры: RouteRequest.custom_pois[0].name -> custom_pois[0].name
+func fieldPath(namespace string) string {
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+// useJSONFieldNames включает в ошибках валидации имена полей из json-тегов
+func useJSONFieldNames() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+}
+
+// notFoundHandler - ответ для неизвестных путей
+func notFoundHandler(c *gin.Context) {
+	respondError(c, http.StatusNotFound, CodeNotFound, fmt.Sprintf("No route for %s %s", c.Request.Method, c.Request.URL.Path))
+}
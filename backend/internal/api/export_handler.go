@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GPX 1.1 (https://www.topografix.com/GPX/1/1/) - порядок элементов задан схемой
+type gpxDocument struct {
+	XMLName  xml.Name    `xml:"gpx"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Version  string      `xml:"version,attr"`
+	Creator  string      `xml:"creator,attr"`
+	Metadata gpxMetadata `xml:"metadata"`
+	Points   []gpxPoint  `xml:"wpt"`
+	Tracks   []gpxTrack  `xml:"trk,omitempty"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name"`
+	Desc string `xml:"desc,omitempty"`
+}
+
+type gpxPoint struct {
+	Lat   float64   `xml:"lat,attr"`
+	Lon   float64   `xml:"lon,attr"`
+	Name  string    `xml:"name,omitempty"`
+	Desc  string    `xml:"desc,omitempty"`
+	Links []gpxLink `xml:"link,omitempty"`
+	Type  string    `xml:"type,omitempty"`
+}
+
+type gpxLink struct {
+	Href string `xml:"href,attr"`
+	Text string `xml:"text,omitempty"`
+	Type string `xml:"type,omitempty"`
+}
+
+type gpxTrack struct {
+	Name    string          `xml:"name,omitempty"`
+	Type    string          `xml:"type,omitempty"`
+	Segment gpxTrackSegment `xml:"trkseg"`
+}
+
+type gpxTrackSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+// KML 2.2 (https://developers.google.com/kml/documentation/kmlreference)
+type kmlDocument struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Document kmlContents `xml:"Document"`
+}
+
+type kmlContents struct {
+	Name        string         `xml:"name"`
+	Description string         `xml:"description,omitempty"`
+	Placemarks  []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name         string         `xml:"name"`
+	Description  string         `xml:"description,omitempty"`
+	ExtendedData *kmlData       `xml:"ExtendedData,omitempty"`
+	Point        *kmlPoint      `xml:"Point,omitempty"`
+	LineString   *kmlLineString `xml:"LineString,omitempty"`
+}
+
+type kmlData struct {
+	Data []kmlDataValue `xml:"Data"`
+}
+
+type kmlDataValue struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlLineString struct {
+	Tessellate  int    `xml:"tessellate"`
+	Coordinates string `xml:"coordinates"`
+}
+
+// ExportRouteGPX выгружает маршрут в GPX
+// @Summary      Экспорт маршрута в GPX
+// @Description  GPX 1.1 для навигаторов (Garmin, Organic Maps): точки маршрута (wpt) с названием, рассказом и ссылкой на аудио, трек (trk) по геометрии маршрута.
+// @Tags         routes
+// @Produce      application/gpx+xml
+// @Param        route_id path string true "Route ID"
+// @Success      200 {file} application/gpx+xml "GPX-файл"
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Router       /routes/{route_id}/export.gpx [get]
+func (h *RouteHandler) ExportRouteGPX(c *gin.Context) {
+	route, ok := h.exportedRoute(c)
+	if !ok {
+		return
+	}
+	baseURL := h.requestBaseURL(c)
+
+	doc := gpxDocument{
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		Version:  "1.1",
+		Creator:  "audioguid",
+		Metadata: gpxMetadata{Name: route.Name, Desc: route.Description},
+		Points:   make([]gpxPoint, len(route.Waypoints)),
+	}
+
+	for i, wp := range route.Waypoints {
+		point := gpxPoint{
+			Lat:  wp.POI.Latitude,
+			Lon:  wp.POI.Longitude,
+			Name: fmt.Sprintf("%d. %s", wp.Order, wp.POI.Name),
+			Desc: h.waypointText(&wp),
+			Type: wp.POI.Category,
+		}
+		if audioURL := h.waypointAudioURL(&wp, baseURL); audioURL != "" {
+			point.Links = append(point.Links, gpxLink{Href: audioURL, Text: "Аудиогид", Type: "audio/mpeg"})
+		}
+		doc.Points[i] = point
+	}
+
+	if path := routePath(route); len(path) >= 2 {
+		track := gpxTrack{Name: route.Name, Type: route.TransportMode}
+		track.Segment.Points = make([]gpxPoint, len(path))
+		for i, coord := range path {
+			track.Segment.Points[i] = gpxPoint{Lat: coord[1], Lon: coord[0]}
+		}
+		doc.Tracks = append(doc.Tracks, track)
+	}
+
+	respondExport(c, route, "gpx", "application/gpx+xml", doc)
+}
+
+// ExportRouteKML выгружает маршрут в KML
+// @Summary      Экспорт маршрута в KML
+// @Description  KML 2.2 для Google Earth и Organic Maps: метки точек с рассказом и ссылкой на аудио (также в ExtendedData audio_url) и линия маршрута.
+// @Tags         routes
+// @Produce      application/vnd.google-earth.kml+xml
+// @Param        route_id path string true "Route ID"
+// @Success      200 {file} application/vnd.google-earth.kml+xml "KML-файл"
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Router       /routes/{route_id}/export.kml [get]
+func (h *RouteHandler) ExportRouteKML(c *gin.Context) {
+	route, ok := h.exportedRoute(c)
+	if !ok {
+		return
+	}
+	baseURL := h.requestBaseURL(c)
+
+	doc := kmlDocument{
+		Xmlns: "http://www.opengis.net/kml/2.2",
+		Document: kmlContents{
+			Name:        route.Name,
+			Description: route.Description,
+			Placemarks:  make([]kmlPlacemark, 0, len(route.Waypoints)+1),
+		},
+	}
+
+	for _, wp := range route.Waypoints {
+		// Описание метки - HTML: текст абзацами и ссылка на аудио
+		var description strings.Builder
+		for _, paragraph := range strings.Split(h.waypointText(&wp), "\n") {
+			if paragraph = strings.TrimSpace(paragraph); paragraph != "" {
+				description.WriteString("<p>" + html.EscapeString(paragraph) + "</p>")
+			}
+		}
+
+		placemark := kmlPlacemark{
+			Name:  fmt.Sprintf("%d. %s", wp.Order, wp.POI.Name),
+			Point: &kmlPoint{Coordinates: kmlCoordinate(wp.POI.Longitude, wp.POI.Latitude)},
+		}
+		if audioURL := h.waypointAudioURL(&wp, baseURL); audioURL != "" {
+			fmt.Fprintf(&description, `<p><a href="%s">Слушать аудиогид</a></p>`, html.EscapeString(audioURL))
+			placemark.ExtendedData = &kmlData{Data: []kmlDataValue{{Name: "audio_url", Value: audioURL}}}
+		}
+		placemark.Description = description.String()
+		doc.Document.Placemarks = append(doc.Document.Placemarks, placemark)
+	}
+
+	if path := routePath(route); len(path) >= 2 {
+		coords := make([]string, len(path))
+		for i, coord := range path {
+			coords[i] = kmlCoordinate(coord[0], coord[1])
+		}
+		doc.Document.Placemarks = append(doc.Document.Placemarks, kmlPlacemark{
+			Name:       route.Name,
+			LineString: &kmlLineString{Tessellate: 1, Coordinates: strings.Join(coords, " ")},
+		})
+	}
+
+	respondExport(c, route, "kml", "application/vnd.google-earth.kml+xml", doc)
+}
+
+// ExportRouteGeoJSON выгружает маршрут в GeoJSON
+// @Summary      Экспорт маршрута в GeoJSON
+// @Description  FeatureCollection (RFC 7946): LineString маршрута и Point для каждой точки со свойствами name, order, description, audio_url.
+// @Tags         routes
+// @Produce      application/geo+json
+// @Param        route_id path string true "Route ID"
+// @Success      200 {object} models.GeoJSONFeatureCollection
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Router       /routes/{route_id}/export.geojson [get]
+func (h *RouteHandler) ExportRouteGeoJSON(c *gin.Context) {
+	route, ok := h.exportedRoute(c)
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(h.routeGeoJSON(route, h.requestBaseURL(c)))
+	if err != nil {
+		respondServiceError(c, err, "Failed to export route")
+		return
+	}
+
+	c.Header("Content-Disposition", exportDisposition(route, "geojson"))
+	c.Data(http.StatusOK, "application/geo+json", data)
+}
+
+// exportedRoute загружает маршрут по :route_id, при ошибке отвечает клиенту
+func (h *RouteHandler) exportedRoute(c *gin.Context) (*models.Route, bool) {
+	uid, err := uuid.Parse(c.Param("route_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid route ID")
+		return nil, false
+	}
+
+	route, err := h.loadRoute(uid)
+	if err != nil {
+		respondServiceError(c, err, "Route not found")
+		return nil, false
+	}
+	return route, true
+}
+
+// respondExport отдает XML-документ файлом для скачивания
+func respondExport(c *gin.Context, route *models.Route, extension, contentType string, doc interface{}) {
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		respondServiceError(c, err, "Failed to export route")
+		return
+	}
+
+	c.Header("Content-Disposition", exportDisposition(route, extension))
+	c.Data(http.StatusOK, contentType+"; charset=utf-8", append([]byte(xml.Header), data...))
+}
+
+func exportDisposition(route *models.Route, extension string) string {
+	return fmt.Sprintf("attachment; filename=route_%s.%s", route.ID.String()[:8], extension)
+}
+
+// kmlCoordinate - координата KML: долгота,широта
+func kmlCoordinate(lon, lat float64) string {
+	return strconv.FormatFloat(lon, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64)
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// routeGeoJSON строит FeatureCollection маршрута: линию пути и точки по порядку.
+// Ссылки на аудио - абсолютные, от baseURL.
+func (h *RouteHandler) routeGeoJSON(route *models.Route, baseURL string) models.GeoJSONFeatureCollection {
+	features := make([]models.GeoJSONFeature, 0, len(route.Waypoints)+1)
+
+	if path := routePath(route); len(path) >= 2 {
+		features = append(features, models.GeoJSONFeature{
+			Type:     "Feature",
+			Geometry: models.GeoJSONGeometry{Type: "LineString", Coordinates: path},
+			Properties: map[string]interface{}{
+				"route_id":           route.ID.String(),
+				"name":               route.Name,
+				"total_distance":     route.TotalDistance,
+				"estimated_duration": route.EstimatedDuration,
+				"transport_mode":     route.TransportMode,
+			},
+		})
+	}
+
+	for _, wp := range route.Waypoints {
+		properties := map[string]interface{}{
+			"waypoint_id": wp.ID.String(),
+			"poi_id":      wp.POI.ID.String(),
+			"order":       wp.Order,
+			"name":        wp.POI.Name,
+			"epoch":       wp.POI.Epoch,
+			"category":    wp.POI.Category,
+			"description": h.waypointText(&wp),
+		}
+		if audioURL := h.waypointAudioURL(&wp, baseURL); audioURL != "" {
+			properties["audio_url"] = audioURL
+		}
+
+		features = append(features, models.GeoJSONFeature{
+			Type:       "Feature",
+			Geometry:   models.GeoJSONGeometry{Type: "Point", Coordinates: []float64{wp.POI.Longitude, wp.POI.Latitude}},
+			Properties: properties,
+		})
+	}
+
+	return models.GeoJSONFeatureCollection{Type: "FeatureCollection", Features: features}
+}
+
+// routePath - линия маршрута [lon, lat]: геометрия из маршрутизатора, а если ее нет -
+// ломаная через старт, точки и финиш
+func routePath(route *models.Route) [][]float64 {
+	if len(route.Geometry) >= 2 {
+		return route.Geometry
+	}
+
+	path := make([][]float64, 0, len(route.Waypoints)+2)
+	if route.StartLat != 0 || route.StartLon != 0 {
+		path = append(path, []float64{route.StartLon, route.StartLat})
+	}
+	for _, wp := range route.Waypoints {
+		path = append(path, []float64{wp.POI.Longitude, wp.POI.Latitude})
+	}
+	switch {
+	case route.EndLat != nil && route.EndLon != nil:
+		path = append(path, []float64{*route.EndLon, *route.EndLat})
+	case route.RoundTrip && len(path) > 0:
+		path = append(path, path[0])
+	}
+	return path
+}
+
+// waypointText - рассказ точки, а если он не прошел проверку - описание места
+func (h *RouteHandler) waypointText(wp *models.Waypoint) string {
+	if h.reviewService.IsServable(wp.Content) {
+		return wp.Content.Text
+	}
+	return wp.POI.Description
+}
+
+// waypointAudioURL - абсолютная ссылка на аудио точки или пустая строка, если аудио нет
+func (h *RouteHandler) waypointAudioURL(wp *models.Waypoint, baseURL string) string {
+	if wp.Content == nil || wp.Content.AudioURL == "" || !h.reviewService.IsServable(wp.Content) {
+		return ""
+	}
+	return baseURL + wp.Content.AudioURL
+}
+
+// requestBaseURL - публичный адрес API без завершающего /: PUBLIC_BASE_URL, а если он не задан -
+// адрес, по которому пришел запрос. Заголовкам X-Forwarded-* не доверяем: их может подставить клиент.
+func (h *RouteHandler) requestBaseURL(c *gin.Context) string {
+	if h.publicBaseURL != "" {
+		return h.publicBaseURL
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetRouteAudioPlaylist отдает HLS-плейлист аудиогида
+// @Summary      HLS-плейлист аудиогида
+// @Description  Живой плейлист (без EXT-X-PLAYLIST-TYPE): по сегменту (MP3) на точку, перед каждым - EXT-X-DISCONTINUITY, название точки - в EXTINF. Воспроизведение можно начать сразу: пока точки генерируются, плейлист растет, а после последней точки закрывается EXT-X-ENDLIST. Если маршрут изменили (точки заменили, переставили или переозвучили), прежние сегменты считаются ушедшими из окна: EXT-X-MEDIA-SEQUENCE и EXT-X-DISCONTINUITY-SEQUENCE увеличиваются на их число. Точки без допустимого аудио пропускаются.
+// @Tags         routes
+// @Produce      application/vnd.apple.mpegurl
+// @Param        route_id path string true "Route ID"
+// @Success      200 {string} string "Плейлист M3U8"
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Router       /routes/{route_id}/audio.m3u8 [get]
+func (h *RouteHandler) GetRouteAudioPlaylist(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("route_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid route ID")
+		return
+	}
+
+	route, err := h.loadRoute(uid)
+	if err != nil {
+		respondServiceError(c, err, "Route not found")
+		return
+	}
+
+	if len(route.Waypoints) == 0 {
+		respondError(c, http.StatusNotFound, CodeNotFound, "No waypoints in route")
+		return
+	}
+
+	// Сегменты только дописываются в конец, поэтому останавливаемся
+	// на первой точке, контент которой еще генерируется или ждет одобрения редактора
+	var segments strings.Builder
+	var urls []string
+	targetDuration := 1
+	complete := true
+	for _, wp := range route.Waypoints {
+		if wp.Content == nil {
+			complete = false
+			break
+		}
+		if wp.Content.AudioKey == "" || wp.Content.Status == models.ContentStatusRejected {
+			continue
+		}
+		if !h.reviewService.IsServable(wp.Content) {
+			complete = false
+			break
+		}
+
+		duration := wp.Content.Duration
+		if duration < 1 {
+			duration = 1
+		}
+		if duration > targetDuration {
+			targetDuration = duration
+		}
+
+		// Каждая точка - отдельный MP3 со своими временными метками. Разрыв ставится и перед
+		// первым сегментом: тогда каждый ушедший из окна сегмент уносит ровно один EXT-X-DISCONTINUITY
+		url := services.WaypointAudioURL(wp.ID.String(), wp.Content.AudioKey)
+		segments.WriteString("#EXT-X-DISCONTINUITY\n")
+		fmt.Fprintf(&segments, "#EXTINF:%d,%s\n", duration, playlistTitle(wp.POI.Name))
+		segments.WriteString(url + "\n")
+		urls = append(urls, url)
+	}
+
+	sequence, err := h.playlistSequence(route.ID, urls)
+	if err != nil {
+		respondServiceError(c, err, "Failed to build playlist")
+		return
+	}
+
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n")
+	playlist.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&playlist, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(&playlist, "#EXT-X-MEDIA-SEQUENCE:%d\n", sequence)
+	fmt.Fprintf(&playlist, "#EXT-X-DISCONTINUITY-SEQUENCE:%d\n", sequence)
+	playlist.WriteString(segments.String())
+
+	// Пока плейлист растет, плеер перечитывает его - кэшировать нельзя
+	if complete {
+		playlist.WriteString("#EXT-X-ENDLIST\n")
+		c.Header("Cache-Control", audioCacheRevalidate)
+	} else {
+		c.Header("Cache-Control", "no-store")
+	}
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", []byte(playlist.String()))
+}
+
+// playlistSequence возвращает номер первого сегмента плейлиста из адресов urls.
+// Пока сегменты только дописываются, номер не меняется. Если изменился уже отданный сегмент,
+// плеер не должен получить под прежним номером другой файл: все прежние сегменты считаются
+// ушедшими из окна, и номер растет на их число.
+func (h *RouteHandler) playlistSequence(routeID uuid.UUID, urls []string) (int, error) {
+	var sequence int
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var route models.Route
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "playlist_segments", "playlist_sequence").
+			First(&route, "id = ?", routeID).Error
+		if err != nil {
+			return err
+		}
+
+		sequence = route.PlaylistSequence
+		published := route.PlaylistSegments
+		if playlistExtends(urls, published) {
+			if len(urls) == len(published) {
+				return nil
+			}
+		} else {
+			sequence += len(published)
+		}
+
+		return tx.Model(&route).Updates(map[string]interface{}{
+			"playlist_segments": pq.StringArray(urls),
+			"playlist_sequence": sequence,
+		}).Error
+	})
+	return sequence, err
+}
+
+// playlistExtends сообщает, что urls - отданный ранее плейлист published, возможно с новыми сегментами в конце
+func playlistExtends(urls, published []string) bool {
+	if len(published) > len(urls) {
+		return false
+	}
+	for i := range published {
+		if urls[i] != published[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// playlistTitle убирает из названия символы, ломающие строку EXTINF
+func playlistTitle(name string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(name)
+}
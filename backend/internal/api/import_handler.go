@@ -0,0 +1,262 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxImportFileSize   = 5 << 20 // 5 МБ
+	defaultMatchRadius  = 50.0    // метры
+	roundTripImportDist = 100.0   // трек, закончившийся ближе к старту, считается кольцевым
+)
+
+// ImportRoute создает маршрут из GPX, KML или GeoJSON
+// @Summary      Импорт маршрута из файла
+// @Description  Разбирает файл партнера: места - точки wpt (или rtept) из GPX, метки Point из KML, Feature с геометрией Point из GeoJSON, в порядке файла. Каждое место сопоставляется с ближайшим местом каталога в радиусе match_radius, остальные создаются как пользовательские места маршрута. Трек (trk, LineString) задает старт и финиш: если он заканчивается рядом со стартом, маршрут кольцевой. Дальше маршрут проходит обычную генерацию: контент и аудио создаются асинхронно.
+// @Tags         routes
+// @Accept       multipart/form-data
+// @Produce      json
+// @Param        file formData file true "GPX, KML или GeoJSON (до 5 МБ)"
+// @Param        match_radius formData number false "Радиус сопоставления с каталогом, метры (по умолчанию 50, максимум 500)"
+// @Param        transport_mode formData string false "Способ передвижения" Enums(walking, cycling, public_transport, car)
+// @Success      200 {object} models.RouteImportResponse
+// @Failure      400 {object} APIError
+// @Failure      413 {object} APIError
+// @Failure      422 {object} APIError "Название маршрута, название или описание места не прошло модерацию"
+// @Failure      429 {object} APIError
+// @Router       /routes/import [post]
+func (h *RouteHandler) ImportRoute(c *gin.Context) {
+	// Запас на поля формы и заголовки частей
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize+64<<10)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondError(c, http.StatusRequestEntityTooLarge, CodeInvalidRequest, "File is too large")
+			return
+		}
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "File is required")
+		return
+	}
+	if fileHeader.Size > maxImportFileSize {
+		respondError(c, http.StatusRequestEntityTooLarge, CodeInvalidRequest, "File is too large")
+		return
+	}
+
+	var req models.RouteImportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.MatchRadius == 0 {
+		req.MatchRadius = defaultMatchRadius
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Failed to read file")
+		return
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Failed to read file")
+		return
+	}
+
+	imported, err := services.ParseRouteFile(fileHeader.Filename, data)
+	if err != nil {
+		respondServiceError(c, err, "Failed to parse file")
+		return
+	}
+
+	// Название из файла становится названием маршрута - проверяем его, как и места
+	if imported.Name != "" {
+		if err := h.moderationService.CheckInput(map[string]string{"name": imported.Name}); err != nil {
+			respondServiceError(c, err, "Route name rejected")
+			return
+		}
+	}
+
+	match, err := h.matchImportedPOIs(imported.Points, req.MatchRadius)
+	if err != nil {
+		respondServiceError(c, err, "Failed to import POIs")
+		return
+	}
+
+	owner, ok := h.requestOwner(c)
+	if !ok {
+		return
+	}
+
+	// Квоту списываем до того, как создавать места и маршрут
+	client, ok := h.reserveQuota(c, match.count())
+	if !ok {
+		return
+	}
+
+	pois, err := h.createImportedPOIs(match)
+	if err != nil {
+		h.releaseQuota(client, match.count())
+		respondServiceError(c, err, "Failed to import POIs")
+		return
+	}
+
+	routeReq := importRouteRequest(imported, req.TransportMode)
+	// Созданные места привязываются к маршруту, как custom_pois при генерации
+	routeReq.CustomPOIs = match.customs
+	profile := services.TransportProfileFor(routeReq.TransportMode)
+	plan := h.routePlanner.Plan(services.PlanRequest{
+		StartLat: routeReq.StartPoint.Lat,
+		StartLon: routeReq.StartPoint.Lon,
+		Fixed:    pois,
+		MaxStops: len(pois),
+		End:      requestEnd(routeReq),
+		Speed:    profile.Speed,
+	})
+
+	route, waypoints, err := h.createRoute(routeReq, &plan, "Маршрут импортирован из файла", owner)
+	if err != nil {
+		h.releaseQuota(client, len(plan.POIs))
+		respondServiceError(c, err, "Failed to create route")
+		return
+	}
+
+	if imported.Name != "" {
+		if err := h.db.Model(route).Update("name", imported.Name).Error; err != nil {
+			log.Printf("Warning: failed to rename imported route %s: %v", route.ID, err)
+		} else {
+			route.Name = imported.Name
+		}
+	}
+
+	go h.generateContentForWaypoints(services.TransportProfileFor(route.TransportMode), waypoints, client)
+
+	c.JSON(http.StatusOK, models.RouteImportResponse{
+		RouteResponse: h.formatRouteResponse(route, waypoints),
+		Format:        imported.Format,
+		Imported:      match.places,
+	})
+}
+
+// importMatch - места файла, сопоставленные с каталогом
+type importMatch struct {
+	places      []models.ImportedPlace
+	matched     []*models.POI      // место каталога для каждой точки файла (nil - новое место или повтор)
+	customs     []models.CustomPOI // новые места в порядке файла
+	customIndex []int              // индекс точки файла для каждого нового места
+}
+
+// count - сколько мест попадет в маршрут
+func (m *importMatch) count() int {
+	count := len(m.customs)
+	for _, poi := range m.matched {
+		if poi != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// matchImportedPOIs сопоставляет места из файла с каталогом (ближайшее в радиусе matchRadius),
+// остальные готовит к созданию как пользовательские места. Ничего не сохраняет.
+// Повторное попадание в то же место каталога пропускается.
+func (h *RouteHandler) matchImportedPOIs(points []services.ImportedPoint, matchRadius float64) (*importMatch, error) {
+	match := &importMatch{
+		places:  make([]models.ImportedPlace, len(points)),
+		matched: make([]*models.POI, len(points)),
+	}
+	seen := make(map[uuid.UUID]bool)
+
+	for i, point := range points {
+		name := point.Name
+		if name == "" {
+			name = fmt.Sprintf("Точка %d", i+1)
+		}
+		match.places[i].Name = name
+
+		poi, distance, err := h.poiService.FindNearest(point.Lat, point.Lon, matchRadius)
+		if err != nil {
+			return nil, err
+		}
+		if poi != nil {
+			match.places[i].POIID = poi.ID.String()
+			match.places[i].Matched = true
+			match.places[i].MatchDistance = distance
+			if seen[poi.ID] {
+				match.places[i].Duplicate = true
+				continue
+			}
+			seen[poi.ID] = true
+			match.matched[i] = poi
+			continue
+		}
+
+		match.customs = append(match.customs, models.CustomPOI{
+			Name:        name,
+			Description: point.Description,
+			Latitude:    point.Lat,
+			Longitude:   point.Lon,
+		})
+		match.customIndex = append(match.customIndex, i)
+	}
+
+	return match, nil
+}
+
+// createImportedPOIs создает новые места (с модерацией) и возвращает места маршрута в порядке файла
+func (h *RouteHandler) createImportedPOIs(match *importMatch) ([]models.POI, error) {
+	if len(match.customs) > 0 {
+		created, err := h.createCustomPOIs(match.customs)
+		if err != nil {
+			return nil, err
+		}
+		for j, poi := range created {
+			i := match.customIndex[j]
+			match.matched[i] = &created[j]
+			match.places[i].POIID = poi.ID.String()
+		}
+	}
+
+	pois := make([]models.POI, 0, len(match.matched))
+	for _, poi := range match.matched {
+		if poi != nil {
+			pois = append(pois, *poi)
+		}
+	}
+	return pois, nil
+}
+
+// importRouteRequest - параметры маршрута из файла: старт и финиш по треку,
+// без трека маршрут начинается в первом месте
+func importRouteRequest(imported *services.ImportedRoute, transportMode string) models.RouteRequest {
+	req := models.RouteRequest{
+		TransportMode: transportMode,
+	}
+
+	first := imported.Points[0]
+	req.StartPoint = models.Point{Lat: first.Lat, Lon: first.Lon}
+
+	if len(imported.Track) >= 2 {
+		start := imported.Track[0]
+		end := imported.Track[len(imported.Track)-1]
+		req.StartPoint = models.Point{Lat: start.Lat, Lon: start.Lon}
+		if services.Distance(start.Lat, start.Lon, end.Lat, end.Lon) <= roundTripImportDist {
+			req.RoundTrip = true
+		} else {
+			req.EndPoint = &models.Point{Lat: end.Lat, Lon: end.Lon}
+		}
+	}
+
+	return req
+}
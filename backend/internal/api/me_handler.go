@@ -0,0 +1,418 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// GetMyQuota возвращает расход квот текущего клиента
+// @Summary      Мои квоты
+// @Description  Дневной и месячный расход квот на генерацию: точки маршрутов и символы озвучки. Для администраторов квоты не действуют (unlimited).
+// @Tags         me
+// @Produce      json
+// @Success      200 {object} models.QuotaStatus
+// @Failure      401 {object} APIError
+// @Failure      500 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /me/quota [get]
+func (h *RouteHandler) GetMyQuota(c *gin.Context) {
+	status, err := h.quotaService.Status(quotaClient(c))
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch quota")
+		return
+	}
+
+	setQuotaHeaders(c, status)
+	c.JSON(http.StatusOK, status)
+}
+
+// ListMyRoutes возвращает историю маршрутов пользователя
+// @Summary      Мои маршруты
+// @Description  Маршруты, созданные пользователем, новые сверху, со статусом готовности аудио
+// @Tags         me
+// @Produce      json
+// @Param        limit query int false "Размер страницы (по умолчанию 20, максимум 100)"
+// @Param        offset query int false "Смещение"
+// @Success      200 {object} models.RouteHistory
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Failure      500 {object} APIError
+// @Security     BearerAuth
+// @Router       /me/routes [get]
+func (h *RouteHandler) ListMyRoutes(c *gin.Context) {
+	user, ok := h.requestUser(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := h.db.Model(&models.Route{}).Where("user_id = ?", user.ID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		respondServiceError(c, err, "Failed to fetch routes")
+		return
+	}
+
+	var routes []models.Route
+	if err := query.Preload("Waypoints.Content").Order("created_at DESC").
+		Limit(limit).Offset(offset).Find(&routes).Error; err != nil {
+		respondServiceError(c, err, "Failed to fetch routes")
+		return
+	}
+
+	summaries, err := h.summarizeRoutes(user.ID, routes)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch routes")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.RouteHistory{Items: summaries, Total: total})
+}
+
+// DeleteMyRoute удаляет маршрут пользователя вместе с контентом и аудиофайлами
+// @Summary      Удалить свой маршрут
+// @Description  Удаляет маршрут, его точки, рассказы и аудио. Чужие маршруты не видны (404).
+// @Tags         me
+// @Param        route_id path string true "Route ID"
+// @Success      204
+// @Failure      400 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Failure      404 {object} APIError
+// @Security     BearerAuth
+// @Router       /me/routes/{route_id} [delete]
+func (h *RouteHandler) DeleteMyRoute(c *gin.Context) {
+	user, ok := h.requestUser(c)
+	if !ok {
+		return
+	}
+
+	uid, err := uuid.Parse(c.Param("route_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid route ID")
+		return
+	}
+
+	route, err := h.loadRoute(uid)
+	if err != nil || route.UserID == nil || *route.UserID != user.ID {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Route not found")
+		return
+	}
+
+	waypointIDs := make([]uuid.UUID, len(route.Waypoints))
+	for i, wp := range route.Waypoints {
+		waypointIDs[i] = wp.ID
+	}
+
+	// Генерация контента может еще идти: ее результат либо удалится вместе с маршрутом,
+	// либо не сохранится, а загруженное аудио генерация удалит сама
+	var contents []models.Content
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if contents, err = deleteWaypointContent(tx, waypointIDs); err != nil {
+			return err
+		}
+		if err := tx.Where("route_id = ?", route.ID).Delete(&models.Waypoint{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("kind = ? AND target_id = ?", models.FavoriteKindRoute, route.ID).Delete(&models.Favorite{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(route).Error
+	})
+	if err != nil {
+		respondServiceError(c, err, "Failed to delete route")
+		return
+	}
+
+	// Свои места маршрута удалит фоновая очистка: на них больше нет ссылок
+	h.removeContentsAudio(contents)
+	h.routeAudio.Remove(route)
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetMyFavorites возвращает избранные места и маршруты
+// @Summary      Избранное
+// @Tags         me
+// @Produce      json
+// @Success      200 {object} models.Favorites
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Failure      500 {object} APIError
+// @Security     BearerAuth
+// @Router       /me/favorites [get]
+func (h *RouteHandler) GetMyFavorites(c *gin.Context) {
+	user, ok := h.requestUser(c)
+	if !ok {
+		return
+	}
+
+	favorites := models.Favorites{POIs: []models.POI{}, Routes: []models.RouteSummary{}}
+
+	poiIDs, err := h.userService.FavoriteIDs(user.ID, models.FavoriteKindPOI)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch favorites")
+		return
+	}
+	if len(poiIDs) > 0 {
+		var pois []models.POI
+		if err := h.db.Where("id IN ?", poiIDs).Find(&pois).Error; err != nil {
+			respondServiceError(c, err, "Failed to fetch favorites")
+			return
+		}
+		position := idPositions(poiIDs)
+		sort.Slice(pois, func(i, j int) bool { return position[pois[i].ID] < position[pois[j].ID] })
+		favorites.POIs = pois
+	}
+
+	routeIDs, err := h.userService.FavoriteIDs(user.ID, models.FavoriteKindRoute)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch favorites")
+		return
+	}
+	if len(routeIDs) > 0 {
+		var routes []models.Route
+		if err := h.db.Preload("Waypoints.Content").Where("id IN ?", routeIDs).Find(&routes).Error; err != nil {
+			respondServiceError(c, err, "Failed to fetch favorites")
+			return
+		}
+		position := idPositions(routeIDs)
+		sort.Slice(routes, func(i, j int) bool { return position[routes[i].ID] < position[routes[j].ID] })
+		summaries, err := h.summarizeRoutes(user.ID, routes)
+		if err != nil {
+			respondServiceError(c, err, "Failed to fetch favorites")
+			return
+		}
+		favorites.Routes = summaries
+	}
+
+	c.JSON(http.StatusOK, favorites)
+}
+
+// AddFavoritePOI добавляет место в избранное
+// @Summary      Добавить место в избранное
+// @Tags         me
+// @Param        poi_id path string true "POI ID"
+// @Success      204
+// @Failure      400 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      404 {object} APIError
+// @Security     BearerAuth
+// @Router       /me/favorites/pois/{poi_id} [put]
+func (h *RouteHandler) AddFavoritePOI(c *gin.Context) {
+	h.changeFavorite(c, models.FavoriteKindPOI, "poi_id", true)
+}
+
+// RemoveFavoritePOI убирает место из избранного
+// @Summary      Убрать место из избранного
+// @Tags         me
+// @Param        poi_id path string true "POI ID"
+// @Success      204
+// @Failure      400 {object} APIError
+// @Failure      401 {object} APIError
+// @Security     BearerAuth
+// @Router       /me/favorites/pois/{poi_id} [delete]
+func (h *RouteHandler) RemoveFavoritePOI(c *gin.Context) {
+	h.changeFavorite(c, models.FavoriteKindPOI, "poi_id", false)
+}
+
+// AddFavoriteRoute добавляет маршрут в избранное
+// @Summary      Добавить маршрут в избранное
+// @Tags         me
+// @Param        route_id path string true "Route ID"
+// @Success      204
+// @Failure      400 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      404 {object} APIError
+// @Security     BearerAuth
+// @Router       /me/favorites/routes/{route_id} [put]
+func (h *RouteHandler) AddFavoriteRoute(c *gin.Context) {
+	h.changeFavorite(c, models.FavoriteKindRoute, "route_id", true)
+}
+
+// RemoveFavoriteRoute убирает маршрут из избранного
+// @Summary      Убрать маршрут из избранного
+// @Tags         me
+// @Param        route_id path string true "Route ID"
+// @Success      204
+// @Failure      400 {object} APIError
+// @Failure      401 {object} APIError
+// @Security     BearerAuth
+// @Router       /me/favorites/routes/{route_id} [delete]
+func (h *RouteHandler) RemoveFavoriteRoute(c *gin.Context) {
+	h.changeFavorite(c, models.FavoriteKindRoute, "route_id", false)
+}
+
+func (h *RouteHandler) changeFavorite(c *gin.Context, kind, param string, add bool) {
+	user, ok := h.requestUser(c)
+	if !ok {
+		return
+	}
+
+	targetID, err := uuid.Parse(c.Param(param))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid ID")
+		return
+	}
+
+	if add {
+		err = h.userService.AddFavorite(user.ID, kind, targetID)
+	} else {
+		err = h.userService.RemoveFavorite(user.ID, kind, targetID)
+	}
+	if err != nil {
+		respondServiceError(c, err, "Failed to update favorites")
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Вспомогательные функции
+
+// requestUser возвращает пользователя запроса (nil - запрос по API-ключу), при ошибке отвечает клиенту
+func (h *RouteHandler) requestUser(c *gin.Context) (*models.User, bool) {
+	principal := currentPrincipal(c)
+	if principal == nil || principal.Kind != services.PrincipalUser {
+		return nil, true
+	}
+
+	user, err := h.userService.Ensure(principal.ID, principal.Name)
+	if err != nil {
+		respondServiceError(c, err, "Failed to load user")
+		return nil, false
+	}
+	return user, true
+}
+
+// routeOwner - автор маршрута: пользователь с JWT или API-ключ (оба nil - анонимный запрос)
+type routeOwner struct {
+	userID   *uuid.UUID
+	apiKeyID *uuid.UUID
+}
+
+// requestOwner возвращает автора создаваемого или изменяемого маршрута, при ошибке отвечает клиенту
+func (h *RouteHandler) requestOwner(c *gin.Context) (routeOwner, bool) {
+	user, ok := h.requestUser(c)
+	if !ok {
+		return routeOwner{}, false
+	}
+
+	var owner routeOwner
+	if user != nil {
+		owner.userID = &user.ID
+	}
+	if principal := currentPrincipal(c); principal != nil && principal.Kind == services.PrincipalAPIKey {
+		if id, err := uuid.Parse(principal.ID); err == nil {
+			owner.apiKeyID = &id
+		}
+	}
+	return owner, true
+}
+
+// owns сообщает, создан ли маршрут этим автором; маршрут без автора не принадлежит никому
+func (o routeOwner) owns(route *models.Route) bool {
+	switch {
+	case route.UserID != nil:
+		return o.userID != nil && *o.userID == *route.UserID
+	case route.APIKeyID != nil:
+		return o.apiKeyID != nil && *o.apiKeyID == *route.APIKeyID
+	default:
+		return false
+	}
+}
+
+// checkRouteOwner пропускает изменение маршрута только его автору (или администратору),
+// иначе отвечает 403. Маршруты без автора (созданные до учета авторов или анонимно)
+// может менять только администратор.
+func (h *RouteHandler) checkRouteOwner(c *gin.Context, route *models.Route) bool {
+	if principal := currentPrincipal(c); principal != nil && principal.HasScope(models.ScopeAdmin) {
+		return true
+	}
+
+	owner, ok := h.requestOwner(c)
+	if !ok {
+		return false
+	}
+	if !owner.owns(route) {
+		respondError(c, http.StatusForbidden, CodeForbidden, "Route belongs to another client")
+		return false
+	}
+	return true
+}
+
+// summarizeRoutes считает готовность аудио маршрутов и отмечает избранные
+func (h *RouteHandler) summarizeRoutes(userID uuid.UUID, routes []models.Route) ([]models.RouteSummary, error) {
+	favoriteIDs, err := h.userService.FavoriteIDs(userID, models.FavoriteKindRoute)
+	if err != nil {
+		return nil, err
+	}
+	favorite := make(map[uuid.UUID]bool, len(favoriteIDs))
+	for _, id := range favoriteIDs {
+		favorite[id] = true
+	}
+
+	summaries := make([]models.RouteSummary, len(routes))
+	for i, route := range routes {
+		pending, ready := 0, 0
+		for _, wp := range route.Waypoints {
+			switch {
+			case wp.Content == nil:
+				pending++
+			case wp.Content.AudioKey != "" && h.reviewService.IsServable(wp.Content):
+				ready++
+			}
+		}
+
+		status := models.RouteStatusUnavailable
+		switch {
+		case pending > 0:
+			status = models.RouteStatusGenerating
+		case ready == len(route.Waypoints):
+			status = models.RouteStatusReady
+		case ready > 0:
+			status = models.RouteStatusPartial
+		}
+
+		summaries[i] = models.RouteSummary{
+			RouteID:           route.ID.String(),
+			Name:              route.Name,
+			TotalDistance:     route.TotalDistance,
+			EstimatedDuration: route.EstimatedDuration,
+			TransportMode:     route.TransportMode,
+			Status:            status,
+			WaypointsTotal:    len(route.Waypoints),
+			AudioReady:        ready,
+			Favorite:          favorite[route.ID],
+			CreatedAt:         route.CreatedAt,
+		}
+	}
+	return summaries, nil
+}
+
+// idPositions - позиции ID в списке для сортировки в том же порядке
+func idPositions(ids []uuid.UUID) map[uuid.UUID]int {
+	position := make(map[uuid.UUID]int, len(ids))
+	for i, id := range ids {
+		position[id] = i
+	}
+	return position
+}
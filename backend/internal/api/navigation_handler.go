@@ -0,0 +1,137 @@
+package api
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// NavigateRoute сообщает, какую точку играть сейчас и куда идти дальше
+// @Summary      Навигация по маршруту
+// @Description  Принимает текущее положение (и курс) пользователя. Возвращает active - непрослушанную точку, в радиусе срабатывания которой находится пользователь (ее рассказ пора включать), и next - следующую непрослушанную точку по порядку с расстоянием, временем в пути и направлением. Радиус срабатывания задается у места (trigger_radius), по умолчанию зависит от способа передвижения. off_route - пользователь дальше допустимого от линии маршрута (с учетом точности GPS), nearest_route_point - куда вернуться.
+// @Tags         routes
+// @Accept       json
+// @Produce      json
+// @Param        route_id path string true "Route ID"
+// @Param        request body models.NavigationRequest true "Положение, курс и прослушанные точки"
+// @Success      200 {object} models.NavigationResponse
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Router       /routes/{route_id}/navigation [post]
+func (h *RouteHandler) NavigateRoute(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("route_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid route ID")
+		return
+	}
+
+	var req models.NavigationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	route, err := h.loadRoute(uid)
+	if err != nil {
+		respondServiceError(c, err, "Route not found")
+		return
+	}
+
+	profile := services.TransportProfileFor(route.TransportMode)
+	lat, lon := req.Location.Lat, req.Location.Lon
+
+	coords := routePath(route)
+	path := make([]services.RoutePoint, len(coords))
+	for i, coord := range coords {
+		path[i] = services.RoutePoint{Lat: coord[1], Lon: coord[0]}
+	}
+
+	response := models.NavigationResponse{RouteID: route.ID.String()}
+
+	// Положение на линии маршрута
+	position := services.ProjectOnPath(path, lat, lon)
+	onRoute := len(path) >= 2
+	if onRoute {
+		response.DistanceFromRoute = math.Round(position.Distance)
+		response.NearestRoutePoint = &models.Point{Lat: position.Nearest.Lat, Lon: position.Nearest.Lon}
+		response.RemainingDistance = math.Round(position.Length - position.Along)
+		if position.Length > 0 {
+			response.Progress = math.Round(position.Along/position.Length*100) / 100
+		}
+		// Погрешность GPS не должна выбрасывать пользователя с маршрута
+		response.OffRoute = position.Distance > profile.OffRouteDistance+req.Accuracy
+		onRoute = !response.OffRoute
+	}
+
+	visited := make(map[string]bool, len(req.Visited))
+	for _, id := range req.Visited {
+		visited[id] = true
+	}
+
+	var upcoming []*models.NavigationWaypoint
+	for i := range route.Waypoints {
+		wp := &route.Waypoints[i]
+		if visited[wp.ID.String()] {
+			continue
+		}
+
+		target := h.navigationWaypoint(wp, req, profile)
+
+		// По маршруту до точки идти дальше, чем по прямой, - считаем вдоль линии
+		if onRoute {
+			at := services.ProjectOnPath(path, wp.POI.Latitude, wp.POI.Longitude)
+			if along := at.Along - position.Along + at.Distance; at.Along > position.Along && along > target.Distance {
+				target.Distance = math.Round(along)
+			}
+		}
+		target.ETASeconds = profile.TravelSeconds(target.Distance)
+
+		upcoming = append(upcoming, target)
+	}
+
+	// Играть сейчас - ближайшую точку, в радиус которой вошел пользователь
+	for _, target := range upcoming {
+		if target.InsideTrigger && (response.Active == nil || target.Distance < response.Active.Distance) {
+			response.Active = target
+		}
+	}
+	for _, target := range upcoming {
+		if target != response.Active {
+			response.Next = target
+			break
+		}
+	}
+	response.Finished = len(upcoming) == 0
+
+	c.JSON(http.StatusOK, response)
+}
+
+// navigationWaypoint - точка относительно пользователя: расстояние по прямой, направление,
+// радиус срабатывания и ссылка на аудио, если оно готово
+func (h *RouteHandler) navigationWaypoint(wp *models.Waypoint, req models.NavigationRequest, profile services.TransportProfile) *models.NavigationWaypoint {
+	lat, lon := req.Location.Lat, req.Location.Lon
+	distance := services.Distance(lat, lon, wp.POI.Latitude, wp.POI.Longitude)
+	radius := profile.TriggerRadiusFor(wp.POI)
+
+	target := &models.NavigationWaypoint{
+		WaypointID:    wp.ID.String(),
+		Order:         wp.Order,
+		Name:          wp.POI.Name,
+		Coordinates:   models.Point{Lat: wp.POI.Latitude, Lon: wp.POI.Longitude},
+		Distance:      math.Round(distance),
+		Bearing:       math.Round(services.Bearing(lat, lon, wp.POI.Latitude, wp.POI.Longitude)),
+		TriggerRadius: radius,
+		InsideTrigger: distance <= radius,
+		AudioURL:      h.waypointAudioURL(wp, ""),
+	}
+	if req.Heading != nil {
+		turn := math.Round(services.RelativeBearing(*req.Heading, target.Bearing))
+		target.RelativeBearing = &turn
+	}
+
+	return target
+}
@@ -0,0 +1,238 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Файлы офлайн-пакета
+const (
+	packageManifestFile  = "manifest.json"
+	packageChecksumsFile = "checksums.sha256"
+	packageGeoJSONFile   = "route.geojson"
+	packageAudioFile     = "audio/route.mp3"
+)
+
+// GetRoutePackage отдает офлайн-пакет маршрута
+// @Summary      Офлайн-пакет маршрута
+// @Description  ZIP-архив для прослушивания без интернета: manifest.json (маршрут, точки, координаты, тексты, геометрия, ссылки на фото; версия схемы в schema_version), MP3 каждой точки в audio/, аудиогид целиком (audio/route.mp3), линия маршрута в route.geojson и checksums.sha256 с SHA-256 всех файлов (формат sha256sum). Пакет собирается, когда готово аудио всех точек.
+// @Tags         routes
+// @Produce      application/zip
+// @Param        route_id path string true "Route ID"
+// @Success      200 {file} application/zip "ZIP-архив"
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      409 {object} APIError "Аудио еще генерируется (см. Retry-After)"
+// @Router       /routes/{route_id}/package [get]
+func (h *RouteHandler) GetRoutePackage(c *gin.Context) {
+	uid, err := uuid.Parse(c.Param("route_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid route ID")
+		return
+	}
+
+	route, err := h.loadRoute(uid)
+	if err != nil {
+		respondServiceError(c, err, "Route not found")
+		return
+	}
+
+	// Пакет собирается один раз и целиком - ждем аудио всех точек
+	var pending []string
+	var audioKeys []string
+	for _, wp := range route.Waypoints {
+		if wp.Content == nil {
+			pending = append(pending, wp.ID.String())
+			continue
+		}
+		if wp.Content.AudioKey != "" && h.reviewService.IsServable(wp.Content) {
+			audioKeys = append(audioKeys, wp.Content.AudioKey)
+		}
+	}
+	if len(pending) > 0 {
+		c.Header("Retry-After", audioRetryAfter)
+		respondErrorDetails(c, http.StatusConflict, CodeAudioNotReady, "Audio is being generated, retry later", gin.H{
+			"ready":   len(audioKeys),
+			"total":   len(route.Waypoints),
+			"pending": pending,
+		})
+		return
+	}
+
+	mergedKey := ""
+	switch {
+	case len(audioKeys) == 1:
+		mergedKey = audioKeys[0]
+	case len(audioKeys) > 1:
+		if mergedKey, err = h.routeAudio.Merged(route.ID, audioKeys); err != nil {
+			respondServiceError(c, err, "Failed to merge audio files")
+			return
+		}
+	}
+
+	manifest := h.packageManifest(route)
+	routeID := route.ID.String()
+
+	// Дальше архив пишется прямо в ответ - после первого байта статус уже не поменять
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=route_%s.zip", routeID[:8]))
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	if err := h.writePackage(zw, route, manifest, mergedKey, h.requestBaseURL(c)); err != nil {
+		log.Printf("Warning: failed to write package of route %s: %v", routeID, err)
+		c.Abort()
+		return
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Warning: failed to finish package of route %s: %v", routeID, err)
+	}
+}
+
+// packageManifest заполняет manifest.json без списка файлов
+func (h *RouteHandler) packageManifest(route *models.Route) *models.PackageManifest {
+	manifest := &models.PackageManifest{
+		SchemaVersion: models.PackageSchemaVersion,
+		GeneratedAt:   time.Now().UTC(),
+		Route: models.PackageRoute{
+			ID:                route.ID.String(),
+			Name:              route.Name,
+			Description:       route.Description,
+			TotalDistance:     route.TotalDistance,
+			EstimatedDuration: route.EstimatedDuration,
+			TransportMode:     services.TransportProfileFor(route.TransportMode).Mode,
+			RoundTrip:         route.RoundTrip,
+			Geometry:          route.Geometry,
+		},
+		Waypoints: make([]models.PackageWaypoint, len(route.Waypoints)),
+		GeoJSON:   packageGeoJSONFile,
+	}
+	if route.StartLat != 0 || route.StartLon != 0 {
+		manifest.Route.StartPoint = &models.Point{Lat: route.StartLat, Lon: route.StartLon}
+	}
+	if route.EndLat != nil && route.EndLon != nil {
+		manifest.Route.EndPoint = &models.Point{Lat: *route.EndLat, Lon: *route.EndLon}
+	}
+
+	for i, wp := range route.Waypoints {
+		waypoint := models.PackageWaypoint{
+			ID:          wp.ID.String(),
+			Order:       wp.Order,
+			Name:        wp.POI.Name,
+			Description: wp.POI.Description,
+			Coordinates: models.Point{Lat: wp.POI.Latitude, Lon: wp.POI.Longitude},
+			Epoch:       wp.POI.Epoch,
+			Category:    wp.POI.Category,
+			LegDuration: wp.LegDuration,
+			Text:        wp.POI.Description,
+			Photos:      wp.POI.Photos,
+		}
+		// Как и в ответе API, непроверенный рассказ заменяется описанием места
+		if h.reviewService.IsServable(wp.Content) {
+			waypoint.Text = wp.Content.Text
+			waypoint.Photos = wp.Content.Photos
+			waypoint.Sources = wp.Content.Sources
+			if wp.Content.AudioKey != "" {
+				waypoint.Audio = fmt.Sprintf("audio/%02d_%s.mp3", wp.Order, wp.ID.String())
+				waypoint.DurationSeconds = wp.Content.Duration
+			}
+		}
+		if waypoint.Photos == nil {
+			waypoint.Photos = []string{}
+		}
+		manifest.Waypoints[i] = waypoint
+	}
+
+	return manifest
+}
+
+// writePackage пишет файлы пакета, затем manifest.json с их контрольными суммами
+// и checksums.sha256 по всем файлам, включая манифест
+func (h *RouteHandler) writePackage(zw *zip.Writer, route *models.Route, manifest *models.PackageManifest, mergedKey, baseURL string) error {
+	for i, wp := range route.Waypoints {
+		if manifest.Waypoints[i].Audio == "" {
+			continue
+		}
+		file, err := h.writePackageAudio(zw, manifest.Waypoints[i].Audio, wp.Content.AudioKey)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	if mergedKey != "" {
+		file, err := h.writePackageAudio(zw, packageAudioFile, mergedKey)
+		if err != nil {
+			return err
+		}
+		manifest.Audio = packageAudioFile
+		manifest.Files = append(manifest.Files, file)
+	}
+
+	geoJSON, err := json.MarshalIndent(h.routeGeoJSON(route, baseURL), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode geojson: %w", err)
+	}
+	file, err := writePackageFile(zw, packageGeoJSONFile, zip.Deflate, manifest.GeneratedAt, bytes.NewReader(geoJSON))
+	if err != nil {
+		return err
+	}
+	manifest.Files = append(manifest.Files, file)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	manifestFile, err := writePackageFile(zw, packageManifestFile, zip.Deflate, manifest.GeneratedAt, bytes.NewReader(manifestJSON))
+	if err != nil {
+		return err
+	}
+
+	var checksums strings.Builder
+	for _, f := range append(manifest.Files, manifestFile) {
+		fmt.Fprintf(&checksums, "%s  %s\n", f.SHA256, f.Path)
+	}
+	_, err = writePackageFile(zw, packageChecksumsFile, zip.Deflate, manifest.GeneratedAt, strings.NewReader(checksums.String()))
+	return err
+}
+
+// writePackageAudio копирует аудио из хранилища в архив без сжатия (MP3 уже сжат)
+func (h *RouteHandler) writePackageAudio(zw *zip.Writer, name, key string) (models.PackageFile, error) {
+	reader, object, err := h.audioStore.Get(key)
+	if err != nil {
+		return models.PackageFile{}, fmt.Errorf("failed to open %s: %w", key, err)
+	}
+	defer reader.Close()
+
+	return writePackageFile(zw, name, zip.Store, object.ModTime, reader)
+}
+
+// writePackageFile добавляет файл в архив, по пути считая SHA-256
+func writePackageFile(zw *zip.Writer, name string, method uint16, modified time.Time, r io.Reader) (models.PackageFile, error) {
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified})
+	if err != nil {
+		return models.PackageFile{}, fmt.Errorf("failed to add %s: %w", name, err)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(w, hash), r)
+	if err != nil {
+		return models.PackageFile{}, fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return models.PackageFile{Path: name, Size: size, SHA256: hex.EncodeToString(hash.Sum(nil))}, nil
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit ограничивает частоту запросов клиента (API-ключ, пользователь или IP).
+// Должен стоять после Authenticate, чтобы лимит считался по ключу, а не по адресу.
+func RateLimit(limiter *services.RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := limiter.Allow(rateLimitKey(c))
+		if result.Limit == 0 {
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(result.RetryAfter)))
+			respondError(c, http.StatusTooManyRequests, CodeRateLimited, "Too many requests")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func rateLimitKey(c *gin.Context) string {
+	if principal := currentPrincipal(c); principal != nil {
+		return principal.Kind + ":" + principal.ID
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// quotaClient - субъект учета квот; администраторы квотами не ограничены
+func quotaClient(c *gin.Context) string {
+	principal := currentPrincipal(c)
+	if principal == nil || principal.HasScope(models.ScopeAdmin) {
+		return ""
+	}
+	if principal.Kind == services.PrincipalUser {
+		return "user:" + principal.ID
+	}
+	return "key:" + principal.ID
+}
+
+// reserveQuota списывает точки с квоты клиента перед генерацией и возвращает субъект учета.
+// При исчерпанной квоте отвечает 429 и возвращает false.
+func (h *RouteHandler) reserveQuota(c *gin.Context, waypoints int) (string, bool) {
+	client := quotaClient(c)
+	status, err := h.quotaService.Reserve(client, waypoints)
+	if err != nil {
+		respondServiceError(c, err, "Failed to check quota")
+		return "", false
+	}
+	setQuotaHeaders(c, status)
+	return client, true
+}
+
+// releaseQuota возвращает на квоту клиента точки, которые не будут озвучены
+func (h *RouteHandler) releaseQuota(client string, waypoints int) {
+	if err := h.quotaService.Release(client, waypoints); err != nil {
+		log.Printf("Warning: failed to release quota: %v", err)
+	}
+}
+
+// setQuotaHeaders сообщает клиенту остаток самой строгой из квот
+func setQuotaHeaders(c *gin.Context, status *models.QuotaStatus) {
+	if status == nil || status.Unlimited {
+		return
+	}
+
+	for _, resource := range []string{"Waypoints", "Characters"} {
+		var remaining, limit int64 = math.MaxInt64, 0
+		var resetAt time.Time
+		for _, period := range status.Periods {
+			used, periodLimit := period.WaypointsUsed, period.WaypointsLimit
+			if resource == "Characters" {
+				used, periodLimit = period.CharactersUsed, period.CharactersLimit
+			}
+			if periodLimit > 0 && periodLimit-used < remaining {
+				remaining, limit, resetAt = periodLimit-used, periodLimit, period.ResetAt
+			}
+		}
+		if limit == 0 {
+			continue
+		}
+		if remaining < 0 {
+			remaining = 0
+		}
+		c.Header(fmt.Sprintf("X-Quota-%s-Limit", resource), strconv.FormatInt(limit, 10))
+		c.Header(fmt.Sprintf("X-Quota-%s-Remaining", resource), strconv.FormatInt(remaining, 10))
+		c.Header(fmt.Sprintf("X-Quota-%s-Reset", resource), strconv.FormatInt(resetAt.Unix(), 10))
+	}
+}
+
+func retryAfterSeconds(d time.Duration) int {
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
@@ -0,0 +1,362 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultRoamLimit     = 3
+	roamRadiusMinutes    = 6 // радиус поиска по умолчанию - столько минут пути
+	roamBehindPenalty    = 2 // место позади пользователя считается во столько раз дальше
+	roamRouteName        = "Свободная прогулка"
+	roamRouteDescription = "Рассказы о местах рядом, собранные по пути"
+)
+
+// roamCandidate - место рядом и его положение относительно пользователя
+type roamCandidate struct {
+	poi      models.POI
+	distance float64
+	bearing  float64
+	score    float64 // расстояние с поправкой на направление движения
+}
+
+// Roam подбирает рассказы о местах рядом для свободной прогулки
+// @Summary      Что рядом (свободная прогулка)
+// @Description  Без заранее построенного маршрута: по положению, курсу и списку прослушанных мест возвращает ближайшие непрослушанные места по эпохам и интересам, для которых уже есть аудио. Рассказы берутся из кэша - готовый рассказ о месте с любого маршрута копируется в прогулку вместе с аудио. Если готового аудио нет, ближайшее место озвучивается сразу, остальные и соседние (следующие по расстоянию) - в фоне, их ID возвращаются в generating. Места впереди по курсу предпочтительнее мест позади. Новые рассказы добавляются точками в маршрут прогулки (roam_id) - передавайте его в следующих запросах.
+// @Tags         routes
+// @Accept       json
+// @Produce      json
+// @Param        request body models.RoamRequest true "Положение, курс, предпочтения и прослушанные места"
+// @Success      200 {object} models.RoamResponse
+// @Failure      400 {object} APIError
+// @Failure      403 {object} APIError "Прогулка другого клиента"
+// @Failure      404 {object} APIError
+// @Failure      422 {object} APIError "Рассказ не прошел проверку"
+// @Failure      429 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /routes/roam [post]
+func (h *RouteHandler) Roam(c *gin.Context) {
+	var req models.RoamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	limit := req.Limit
+	if limit == 0 {
+		limit = defaultRoamLimit
+	}
+	profile := services.TransportProfileFor(req.TransportMode)
+	radius := req.Radius
+	if radius == 0 {
+		radius = profile.Speed * roamRadiusMinutes
+	}
+
+	// Прогулка из предыдущего ответа
+	var route *models.Route
+	if req.RoamID != "" {
+		uid, err := uuid.Parse(req.RoamID)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid roam ID")
+			return
+		}
+		if route, err = h.loadRoute(uid); err != nil {
+			respondServiceError(c, err, "Roam not found")
+			return
+		}
+		if !route.FreeRoam {
+			respondError(c, http.StatusBadRequest, CodeValidationFailed, "roam_id is not a free roam")
+			return
+		}
+		// Дополнять прогулку может только ее автор
+		if !h.checkRouteOwner(c, route) {
+			return
+		}
+		profile = services.TransportProfileFor(route.TransportMode)
+	}
+
+	pois, err := h.poiService.FindNearby(req.Location.Lat, req.Location.Lon, radius, req.Epochs, req.Interests)
+	if err != nil {
+		respondServiceError(c, err, "Failed to find POIs")
+		return
+	}
+	candidates := roamCandidates(pois, req)
+
+	// Показываем limit ближайших, следующие столько же - соседи, их готовим заранее
+	nearby := candidates[:min(2*limit, len(candidates))]
+	shown := nearby[:min(limit, len(nearby))]
+
+	ids := make([]uuid.UUID, len(nearby))
+	for i, candidate := range nearby {
+		ids[i] = candidate.poi.ID
+	}
+	// Точки прогулки без перегонов - рассказ обычной для способа передвижения длины
+	cached, err := h.reviewService.ServableByPOI(ids, profile.NarrationSeconds(0))
+	if err != nil {
+		respondServiceError(c, err, "Failed to load content")
+		return
+	}
+
+	// Готовые рассказы этой прогулки. Рассказ из кэша сначала копируется в прогулку,
+	// места без рассказа озвучиваются.
+	ready := make(map[uuid.UUID]models.Content, len(shown))
+	var reused []roamCandidate
+	var missing []roamCandidate
+	var generating []string
+	missingShown := 0
+	for i, candidate := range nearby {
+		if wp := roamWaypoint(route, candidate.poi.ID); wp != nil {
+			// Рассказ уже готовится или отклонен проверкой - повторно не генерируем
+			switch {
+			case wp.Content == nil:
+				generating = append(generating, candidate.poi.ID.String())
+			case wp.Content.AudioKey != "" && h.reviewService.IsServable(wp.Content):
+				ready[candidate.poi.ID] = *wp.Content
+			}
+			continue
+		}
+		if _, ok := cached[candidate.poi.ID]; ok {
+			// Соседей из кэша копировать незачем, пока их не показывают
+			if i < len(shown) {
+				reused = append(reused, candidate)
+			}
+			continue
+		}
+		missing = append(missing, candidate)
+		if i < len(shown) {
+			missingShown++
+		}
+	}
+
+	if len(reused) > 0 || len(missing) > 0 {
+		owner, ok := h.requestOwner(c)
+		if !ok {
+			return
+		}
+
+		var client string
+		if len(missing) > 0 {
+			if client, ok = h.reserveQuota(c, len(missing)); !ok {
+				return
+			}
+		}
+
+		if route == nil {
+			if route, err = h.createRoamRoute(req, profile, owner); err != nil {
+				h.releaseQuota(client, len(missing))
+				respondServiceError(c, err, "Failed to create roam")
+				return
+			}
+		}
+
+		waypoints, err := h.addRoamWaypoints(route, append(reused, missing...))
+		if err != nil {
+			h.releaseQuota(client, len(missing))
+			respondServiceError(c, err, "Failed to add waypoints")
+			return
+		}
+
+		for i, candidate := range reused {
+			content, err := h.reviewService.CopyContent(cached[candidate.poi.ID], waypoints[i].ID)
+			if err != nil {
+				// Нескопированные рассказы попробуем взять из кэша при следующем запросе,
+				// места без рассказа озвучиваются как обычно
+				h.removeRoamWaypoints(waypoints[i:len(reused)])
+				go h.generateRoamContent(waypoints[len(reused):], profile, client)
+				respondServiceError(c, err, "Failed to copy content")
+				return
+			}
+			ready[candidate.poi.ID] = *content
+		}
+		waypoints = waypoints[len(reused):]
+
+		// Ничего из показываемого не готово - ближайшее место озвучиваем сразу
+		if missingShown > 0 && !roamHasReady(shown, ready) {
+			content, err := h.generateWaypointContent(waypoints[0], profile, client)
+			if err != nil {
+				go h.generateRoamContent(waypoints[1:], profile, client)
+				respondServiceError(c, err, "Failed to generate content")
+				return
+			}
+			if content.AudioKey != "" && h.reviewService.IsServable(content) {
+				ready[waypoints[0].POIID] = *content
+			}
+			waypoints = waypoints[1:]
+		}
+
+		for _, wp := range waypoints {
+			generating = append(generating, wp.POIID.String())
+		}
+		if len(waypoints) > 0 {
+			go h.generateRoamContent(waypoints, profile, client)
+		}
+	}
+
+	response := models.RoamResponse{POIs: []models.RoamPOI{}, Generating: generating}
+	if response.Generating == nil {
+		response.Generating = []string{}
+	}
+	if route != nil {
+		response.RoamID = route.ID.String()
+	}
+	for _, candidate := range shown {
+		content, ok := ready[candidate.poi.ID]
+		if !ok {
+			continue
+		}
+		response.POIs = append(response.POIs, roamPOI(candidate, content, req.Heading))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// roamCandidates убирает прослушанные места и сортирует остальные по расстоянию;
+// места позади по курсу отодвигаются в конец
+func roamCandidates(pois []models.POI, req models.RoamRequest) []roamCandidate {
+	played := make(map[string]bool, len(req.RecentlyPlayed))
+	for _, id := range req.RecentlyPlayed {
+		played[id] = true
+	}
+
+	lat, lon := req.Location.Lat, req.Location.Lon
+	candidates := make([]roamCandidate, 0, len(pois))
+	for _, poi := range pois {
+		if played[poi.ID.String()] {
+			continue
+		}
+		candidate := roamCandidate{
+			poi:      poi,
+			distance: services.Distance(lat, lon, poi.Latitude, poi.Longitude),
+			bearing:  services.Bearing(lat, lon, poi.Latitude, poi.Longitude),
+		}
+		candidate.score = candidate.distance
+		if req.Heading != nil && math.Abs(services.RelativeBearing(*req.Heading, candidate.bearing)) > 90 {
+			candidate.score *= roamBehindPenalty
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	// FindNearby отдает места по важности - при равном расстоянии важное остается выше
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score < candidates[j].score
+	})
+	return candidates
+}
+
+// roamWaypoint - точка прогулки с этим местом (nil - места в прогулке нет)
+func roamWaypoint(route *models.Route, poiID uuid.UUID) *models.Waypoint {
+	if route == nil {
+		return nil
+	}
+	for i := range route.Waypoints {
+		if route.Waypoints[i].POIID == poiID {
+			return &route.Waypoints[i]
+		}
+	}
+	return nil
+}
+
+// roamHasReady - есть ли среди показываемых мест хотя бы одно с готовым рассказом
+func roamHasReady(shown []roamCandidate, cached map[uuid.UUID]models.Content) bool {
+	for _, candidate := range shown {
+		if _, ok := cached[candidate.poi.ID]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// createRoamRoute создает маршрут свободной прогулки, начинающийся в текущей точке
+func (h *RouteHandler) createRoamRoute(req models.RoamRequest, profile services.TransportProfile, owner routeOwner) (*models.Route, error) {
+	route := &models.Route{
+		Name:          roamRouteName,
+		Description:   roamRouteDescription,
+		Epochs:        req.Epochs,
+		Categories:    req.Interests,
+		StartLat:      req.Location.Lat,
+		StartLon:      req.Location.Lon,
+		TransportMode: profile.Mode,
+		UserID:        owner.userID,
+		APIKeyID:      owner.apiKeyID,
+		FreeRoam:      true,
+	}
+	if err := h.db.Create(route).Error; err != nil {
+		return nil, fmt.Errorf("failed to create roam: %w", err)
+	}
+	return route, nil
+}
+
+// addRoamWaypoints добавляет места в конец прогулки в переданном порядке
+func (h *RouteHandler) addRoamWaypoints(route *models.Route, candidates []roamCandidate) ([]models.Waypoint, error) {
+	waypoints := make([]models.Waypoint, len(candidates))
+	for i, candidate := range candidates {
+		waypoints[i] = models.Waypoint{
+			RouteID: route.ID,
+			POIID:   candidate.poi.ID,
+			Order:   len(route.Waypoints) + i + 1,
+		}
+	}
+
+	if err := h.db.Create(&waypoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to create waypoints: %w", err)
+	}
+
+	for i := range waypoints {
+		waypoints[i].POI = candidates[i].poi
+	}
+	route.Waypoints = append(route.Waypoints, waypoints...)
+	return waypoints, nil
+}
+
+// removeRoamWaypoints удаляет только что добавленные точки прогулки без контента
+func (h *RouteHandler) removeRoamWaypoints(waypoints []models.Waypoint) {
+	ids := make([]uuid.UUID, len(waypoints))
+	for i, wp := range waypoints {
+		ids[i] = wp.ID
+	}
+	if err := h.db.Where("id IN ?", ids).Delete(&models.Waypoint{}).Error; err != nil {
+		log.Printf("Warning: failed to remove roam waypoints: %v", err)
+	}
+}
+
+// generateRoamContent озвучивает места прогулки в фоне. В отличие от маршрута,
+// общий аудиофайл не собирается: прогулка слушается по одному рассказу.
+func (h *RouteHandler) generateRoamContent(waypoints []models.Waypoint, profile services.TransportProfile, client string) {
+	for _, waypoint := range waypoints {
+		if _, err := h.generateWaypointContent(waypoint, profile, client); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+}
+
+// roamPOI - место с готовым рассказом относительно пользователя
+func roamPOI(candidate roamCandidate, content models.Content, heading *float64) models.RoamPOI {
+	poi := models.RoamPOI{
+		POIID:           candidate.poi.ID.String(),
+		WaypointID:      content.WaypointID.String(),
+		Name:            candidate.poi.Name,
+		Epoch:           candidate.poi.Epoch,
+		Category:        candidate.poi.Category,
+		Coordinates:     models.Point{Lat: candidate.poi.Latitude, Lon: candidate.poi.Longitude},
+		Distance:        math.Round(candidate.distance),
+		Bearing:         math.Round(candidate.bearing),
+		Text:            content.Text,
+		AudioURL:        content.AudioURL,
+		DurationSeconds: content.Duration,
+	}
+	if heading != nil {
+		turn := math.Round(services.RelativeBearing(*heading, candidate.bearing))
+		poi.RelativeBearing = &turn
+	}
+	return poi
+}
@@ -1,24 +1,41 @@
 package api
 
 import (
+	"errors"
 	"fmt"
-	"io"
+	"log"
+	"math"
 	"net/http"
 	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/dimmy-kor/audioguid/internal/models"
 	"github.com/dimmy-kor/audioguid/internal/services"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type RouteHandler struct {
-	gisService     *services.GISService
-	poiService     *services.POIService
-	contentService *services.ContentService
-	ttsService     *services.TTSService
-	db             *gorm.DB
+	gisService        *services.GISService
+	poiService        *services.POIService
+	contentService    *services.ContentService
+	ttsService        *services.TTSService
+	audioStore        services.AudioStore
+	routeAudio        *services.RouteAudioService
+	routePlanner      *services.RoutePlanner
+	reviewService     *services.ReviewService
+	moderationService *services.ModerationService
+	quotaService      *services.QuotaService
+	userService       *services.UserService
+	db                *gorm.DB
+	// Срок ссылок на аудио в хранилище; 0 - аудио отдается через API
+	audioURLTTL time.Duration
+	// Публичный адрес API для абсолютных ссылок в экспорте (пусто - адрес запроса)
+	publicBaseURL string
 }
 
 func NewRouteHandler(
@@ -26,126 +43,95 @@ func NewRouteHandler(
 	poi *services.POIService,
 	content *services.ContentService,
 	tts *services.TTSService,
+	store services.AudioStore,
+	routeAudio *services.RouteAudioService,
+	planner *services.RoutePlanner,
+	review *services.ReviewService,
+	moderation *services.ModerationService,
+	quota *services.QuotaService,
+	users *services.UserService,
 	db *gorm.DB,
 ) *RouteHandler {
+	audioURLTTL, _ := time.ParseDuration(os.Getenv("AUDIO_PRESIGN_TTL"))
+
 	return &RouteHandler{
-		gisService:     gis,
-		poiService:     poi,
-		contentService: content,
-		ttsService:     tts,
-		db:             db,
+		gisService:        gis,
+		poiService:        poi,
+		contentService:    content,
+		ttsService:        tts,
+		audioStore:        store,
+		routeAudio:        routeAudio,
+		routePlanner:      planner,
+		reviewService:     review,
+		moderationService: moderation,
+		quotaService:      quota,
+		userService:       users,
+		db:                db,
+		audioURLTTL:       audioURLTTL,
+		publicBaseURL:     strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/"),
 	}
 }
 
 // GenerateRoute создает новый маршрут
 // @Summary      Создать маршрут (асинхронно)
-// @Description  Создает маршрут с точками интереса. Аудио генерируется асинхронно в фоне. Поддерживает 3 режима: автопоиск, конкретные POI ID, свои места.
+// @Description  Создает маршрут с точками интереса. Аудио генерируется асинхронно в фоне. Обязательные места (poi_ids, custom_pois) можно комбинировать и дополнять автоподбором на оставшееся время (fill_remaining).
 // @Tags         routes
 // @Accept       json
 // @Produce      json
-// @Param        request body models.RouteRequest true "Параметры маршрута (можно указать poi_ids или custom_pois)"
+// @Param        request body models.RouteRequest true "Параметры маршрута (poi_ids, custom_pois, fill_remaining, optimize_order)"
 // @Success      200 {object} models.RouteResponse
-// @Failure      400 {object} map[string]string
-// @Failure      404 {object} map[string]string
-// @Failure      500 {object} map[string]string
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      422 {object} APIError "Свои места не прошли модерацию"
+// @Failure      500 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
 // @Router       /routes/generate [post]
 func (h *RouteHandler) GenerateRoute(c *gin.Context) {
 	var req models.RouteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
-
-	// Получаем точки интереса
-	var pois []models.POI
-	var err error
-
-	// Вариант 1: Конкретные POI ID из базы
-	if len(req.POIIDs) > 0 {
-		pois, err = h.getPOIsByIDs(req.POIIDs)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-	} else if len(req.CustomPOIs) > 0 {
-		// Вариант 2: Пользовательские места (создаем новые POI)
-		pois, err = h.createCustomPOIs(req.CustomPOIs)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	} else {
-		// Вариант 3: Автоматический поиск по критериям
-		radius := float64(req.DurationMinutes * 83)
-		if radius > 5000 {
-			radius = 5000
-		}
-
-		pois, err = h.poiService.FindNearby(
-			req.StartPoint.Lat,
-			req.StartPoint.Lon,
-			radius,
-			req.Epochs,
-			req.Interests,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find POIs"})
-			return
-		}
-
-		// Ограничиваем количество точек только для автопоиска
-		maxPoints := req.MaxWaypoints
-		if maxPoints == 0 || maxPoints > 10 {
-			maxPoints = 5
-		}
-		if len(pois) > maxPoints {
-			pois = pois[:maxPoints]
-		}
-	}
-
-	if len(pois) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No POIs found matching criteria"})
+	if err := validateRouteRequest(req); err != nil {
+		respondError(c, http.StatusBadRequest, CodeValidationFailed, err.Error())
 		return
 	}
 
-	// Создаем маршрут в БД
-	route := &models.Route{
-		Name:              generateRouteName(req.Epochs, req.Interests),
-		Description:       "Автоматически сгенерированный маршрут",
-		TotalDistance:     0,
-		EstimatedDuration: req.DurationMinutes,
-		Epochs:            req.Epochs,
-		Categories:        req.Interests,
+	// Подбираем точки интереса
+	plan, err := h.selectPOIs(req)
+	if err != nil {
+		respondServiceError(c, err, "Failed to find POIs")
+		return
 	}
 
-	if err := h.db.Create(route).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create route"})
+	if len(plan.POIs) == 0 {
+		respondError(c, http.StatusNotFound, CodeNotFound, "No POIs found matching criteria")
 		return
 	}
 
-	// Создаем waypoints
-	waypoints := make([]models.Waypoint, len(pois))
-	for i, poi := range pois {
-		waypoint := models.Waypoint{
-			RouteID: route.ID,
-			POIID:   poi.ID,
-			Order:   i + 1,
-		}
-		waypoints[i] = waypoint
+	owner, ok := h.requestOwner(c)
+	if !ok {
+		return
 	}
 
-	if err := h.db.Create(&waypoints).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create waypoints"})
+	client, ok := h.reserveQuota(c, len(plan.POIs))
+	if !ok {
 		return
 	}
 
-	// Загружаем POI данные для каждой waypoint
-	for i := range waypoints {
-		waypoints[i].POI = pois[i]
+	// Создаем маршрут и точки в БД
+	route, waypoints, err := h.createRoute(req, plan, "Автоматически сгенерированный маршрут", owner)
+	if err != nil {
+		h.releaseQuota(client, len(plan.POIs))
+		respondServiceError(c, err, "Failed to create route")
+		return
 	}
 
 	// Генерируем контент асинхронно (в реальности - через очередь)
-	go h.generateContentForWaypoints(waypoints)
+	go h.generateContentForWaypoints(services.TransportProfileFor(route.TransportMode), waypoints, client)
 
 	// Формируем ответ
 	response := h.formatRouteResponse(route, waypoints)
@@ -160,22 +146,22 @@ func (h *RouteHandler) GenerateRoute(c *gin.Context) {
 // @Produce      json
 // @Param        route_id path string true "Route ID"
 // @Success      200 {object} models.RouteResponse
-// @Failure      400 {object} map[string]string
-// @Failure      404 {object} map[string]string
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
 // @Router       /routes/{route_id} [get]
 func (h *RouteHandler) GetRoute(c *gin.Context) {
 	routeID := c.Param("route_id")
 
 	uid, err := uuid.Parse(routeID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid route ID")
 		return
 	}
 
 	var route models.Route
 	if err := h.db.Preload("Waypoints.POI").Preload("Waypoints.Content").
 		First(&route, "id = ?", uid).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+		respondError(c, http.StatusNotFound, CodeNotFound, "Route not found")
 		return
 	}
 
@@ -185,32 +171,99 @@ func (h *RouteHandler) GetRoute(c *gin.Context) {
 
 // GetPOIs получает список мест интереса
 // @Summary      Список POI
-// @Description  Возвращает список всех мест интереса с фильтрацией
+// @Description  Возвращает страницу мест интереса с фильтрами и сортировкой. Фильтры-списки можно повторять (epoch=soviet&epoch=modern) или перечислять через запятую. Для следующей страницы передайте next_cursor из ответа в cursor с теми же параметрами.
 // @Tags         pois
 // @Produce      json
-// @Param        epoch query string false "Фильтр по эпохе (medieval, imperial, soviet, modern)"
-// @Param        category query string false "Фильтр по категории (architecture, history, culture, religion, art)"
-// @Success      200 {array} models.POI
-// @Failure      500 {object} map[string]string
+// @Param        epoch query []string false "Эпохи (medieval, imperial, soviet, modern)" collectionFormat(multi)
+// @Param        category query []string false "Категории (architecture, history, culture, religion, art)" collectionFormat(multi)
+// @Param        style query []string false "Архитектурные стили" collectionFormat(multi)
+// @Param        architect query []string false "Архитекторы (поиск по части имени)" collectionFormat(multi)
+// @Param        year_from query int false "Построено не раньше года"
+// @Param        year_to query int false "Построено не позже года"
+// @Param        min_importance query int false "Минимальная важность (1-10)"
+// @Param        bbox query string false "Прямоугольник minLon,minLat,maxLon,maxLat"
+// @Param        lat query number false "Широта точки (для radius и sort=distance)"
+// @Param        lon query number false "Долгота точки (для radius и sort=distance)"
+// @Param        radius query number false "Радиус от точки, метры"
+// @Param        sort query string false "Сортировка: importance (по умолчанию), distance, name, year" Enums(importance, distance, name, year)
+// @Param        order query string false "Порядок: asc, desc (по умолчанию desc для importance, иначе asc)" Enums(asc, desc)
+// @Param        limit query int false "Размер страницы (по умолчанию 50, максимум 200)"
+// @Param        cursor query string false "Курсор следующей страницы"
+// @Success      200 {object} models.POIList
+// @Failure      400 {object} APIError
+// @Failure      500 {object} APIError
 // @Router       /pois [get]
 func (h *RouteHandler) GetPOIs(c *gin.Context) {
-	var pois []models.POI
-	query := h.db.Model(&models.POI{})
+	var query models.POIListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondBindError(c, err)
+		return
+	}
 
-	// Фильтры
-	if epoch := c.Query("epoch"); epoch != "" {
-		query = query.Where("epoch = ?", epoch)
+	list, err := h.poiService.List(query)
+	if err != nil {
+		respondServiceError(c, err, "Failed to fetch POIs")
+		return
 	}
-	if category := c.Query("category"); category != "" {
-		query = query.Where("category = ?", category)
+
+	c.JSON(http.StatusOK, list)
+}
+
+// SearchPOIs ищет места по тексту
+// @Summary      Поиск POI
+// @Description  Полнотекстовый поиск по названию, архитектору, стилю и описанию (русский и английский) с учетом опечаток и транслитерации. Результаты отсортированы по релевантности; совпадения в name_highlight и snippet обернуты в <mark>.
+// @Tags         pois
+// @Produce      json
+// @Param        q query string true "Поисковый запрос"
+// @Param        epoch query []string false "Эпохи" collectionFormat(multi)
+// @Param        category query []string false "Категории" collectionFormat(multi)
+// @Param        limit query int false "Размер страницы (по умолчанию 20, максимум 50)"
+// @Param        offset query int false "Смещение"
+// @Success      200 {object} models.POISearchList
+// @Failure      400 {object} APIError
+// @Failure      500 {object} APIError
+// @Router       /pois/search [get]
+func (h *RouteHandler) SearchPOIs(c *gin.Context) {
+	var query models.POISearchQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondBindError(c, err)
+		return
 	}
 
-	if err := query.Find(&pois).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch POIs"})
+	results, err := h.poiService.Search(query)
+	if err != nil {
+		respondServiceError(c, err, "Failed to search POIs")
 		return
 	}
 
-	c.JSON(http.StatusOK, pois)
+	c.JSON(http.StatusOK, results)
+}
+
+// AutocompletePOIs подсказывает места по началу названия
+// @Summary      Подсказки POI
+// @Description  Быстрые подсказки для поисковой строки по началу названия или слова в нем (в том числе в транслитерации)
+// @Tags         pois
+// @Produce      json
+// @Param        q query string true "Начало названия"
+// @Param        limit query int false "Количество подсказок (по умолчанию 10, максимум 20)"
+// @Success      200 {array} models.POIAutocompleteItem
+// @Failure      400 {object} APIError
+// @Failure      500 {object} APIError
+// @Router       /pois/autocomplete [get]
+func (h *RouteHandler) AutocompletePOIs(c *gin.Context) {
+	var query models.POIAutocompleteQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	items, err := h.poiService.Autocomplete(query.Query, query.Limit)
+	if err != nil {
+		respondServiceError(c, err, "Failed to autocomplete POIs")
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
 }
 
 // GetPOI получает детали места
@@ -220,21 +273,21 @@ func (h *RouteHandler) GetPOIs(c *gin.Context) {
 // @Produce      json
 // @Param        poi_id path string true "POI ID"
 // @Success      200 {object} models.POI
-// @Failure      400 {object} map[string]string
-// @Failure      404 {object} map[string]string
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
 // @Router       /pois/{poi_id} [get]
 func (h *RouteHandler) GetPOI(c *gin.Context) {
 	poiID := c.Param("poi_id")
 
 	uid, err := uuid.Parse(poiID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid POI ID"})
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid POI ID")
 		return
 	}
 
 	var poi models.POI
-	if err := h.db.First(&poi, "id = ?", uid).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "POI not found"})
+	if err := h.db.First(&poi, "id = ? AND visibility = ?", uid, models.POIVisibilityPublic).Error; err != nil {
+		respondError(c, http.StatusNotFound, CodeNotFound, "POI not found")
 		return
 	}
 
@@ -243,168 +296,122 @@ func (h *RouteHandler) GetPOI(c *gin.Context) {
 
 // GenerateRouteWithAudio создает маршрут и сразу генерирует аудио (синхронно)
 // @Summary      Создать маршрут и получить MP3 (синхронно)
-// @Description  Создает маршрут, генерирует аудио для всех точек и возвращает готовый MP3 файл. Занимает 2-5 минут. Поддерживает 3 режима: автопоиск, конкретные POI ID, свои места с координатами.
+// @Description  Создает маршрут, генерирует аудио для всех точек и возвращает готовый MP3 файл. Занимает 2-5 минут. Обязательные места (poi_ids, custom_pois) можно комбинировать и дополнять автоподбором на оставшееся время (fill_remaining).
 // @Tags         routes
 // @Accept       json
 // @Produce      audio/mpeg
-// @Param        request body models.RouteRequest true "Параметры маршрута (можно указать poi_ids или custom_pois)"
+// @Param        request body models.RouteRequest true "Параметры маршрута (poi_ids, custom_pois, fill_remaining, optimize_order)"
 // @Success      200 {file} audio/mpeg "MP3 файл с аудиогидом"
-// @Failure      400 {object} map[string]string
-// @Failure      404 {object} map[string]string
-// @Failure      500 {object} map[string]string
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      409 {object} APIError "Аудио ждет редакционной проверки (details.route_id)"
+// @Failure      422 {object} APIError "Свои места или все рассказы не прошли модерацию (во втором случае details.route_id)"
+// @Failure      500 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
 // @Router       /routes/generate-audio [post]
 func (h *RouteHandler) GenerateRouteWithAudio(c *gin.Context) {
 	var req models.RouteRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondBindError(c, err)
 		return
 	}
-
-	// Получаем точки интереса (используем ту же логику)
-	var pois []models.POI
-	var err error
-
-	if len(req.POIIDs) > 0 {
-		pois, err = h.getPOIsByIDs(req.POIIDs)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-			return
-		}
-	} else if len(req.CustomPOIs) > 0 {
-		pois, err = h.createCustomPOIs(req.CustomPOIs)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-	} else {
-		radius := float64(req.DurationMinutes * 83)
-		if radius > 5000 {
-			radius = 5000
-		}
-
-		pois, err = h.poiService.FindNearby(
-			req.StartPoint.Lat,
-			req.StartPoint.Lon,
-			radius,
-			req.Epochs,
-			req.Interests,
-		)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find POIs"})
-			return
-		}
-
-		maxPoints := req.MaxWaypoints
-		if maxPoints == 0 || maxPoints > 10 {
-			maxPoints = 5
-		}
-		if len(pois) > maxPoints {
-			pois = pois[:maxPoints]
-		}
-	}
-
-	if len(pois) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No POIs found matching criteria"})
+	if err := validateRouteRequest(req); err != nil {
+		respondError(c, http.StatusBadRequest, CodeValidationFailed, err.Error())
 		return
 	}
 
-	// Создаем маршрут в БД
-	route := &models.Route{
-		Name:              generateRouteName(req.Epochs, req.Interests),
-		Description:       "Автоматически сгенерированный маршрут с аудио",
-		TotalDistance:     0,
-		EstimatedDuration: req.DurationMinutes,
-		Epochs:            req.Epochs,
-		Categories:        req.Interests,
+	// Подбираем точки интереса (используем ту же логику)
+	plan, err := h.selectPOIs(req)
+	if err != nil {
+		respondServiceError(c, err, "Failed to find POIs")
+		return
 	}
 
-	if err := h.db.Create(route).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create route"})
+	if len(plan.POIs) == 0 {
+		respondError(c, http.StatusNotFound, CodeNotFound, "No POIs found matching criteria")
 		return
 	}
 
-	// Создаем waypoints
-	waypoints := make([]models.Waypoint, len(pois))
-	for i, poi := range pois {
-		waypoint := models.Waypoint{
-			RouteID: route.ID,
-			POIID:   poi.ID,
-			Order:   i + 1,
-		}
-		waypoints[i] = waypoint
+	owner, ok := h.requestOwner(c)
+	if !ok {
+		return
 	}
 
-	if err := h.db.Create(&waypoints).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create waypoints"})
+	client, ok := h.reserveQuota(c, len(plan.POIs))
+	if !ok {
 		return
 	}
 
-	// Загружаем POI данные
-	for i := range waypoints {
-		waypoints[i].POI = pois[i]
+	// Создаем маршрут и точки в БД
+	route, waypoints, err := h.createRoute(req, plan, "Автоматически сгенерированный маршрут с аудио", owner)
+	if err != nil {
+		h.releaseQuota(client, len(plan.POIs))
+		respondServiceError(c, err, "Failed to create route")
+		return
 	}
 
 	// СИНХРОННАЯ генерация контента
-	var audioFiles []string
-	for _, waypoint := range waypoints {
-		// Генерируем текст
-		text, err := h.contentService.GenerateDescription(waypoint.POI)
+	profile := services.TransportProfileFor(route.TransportMode)
+	var audioKeys []string
+	awaitingReview := false
+	for i, waypoint := range waypoints {
+		content, err := h.generateWaypointContent(waypoint, profile, client)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("Failed to generate content for %s: %v", waypoint.POI.Name, err),
-			})
+			// Остальные точки догенерируются в фоне, маршрут можно будет получить по ID
+			go h.generateContentForWaypoints(profile, waypoints[i+1:], client)
+			respondServiceError(c, err, "Failed to generate content")
 			return
 		}
 
-		// Генерируем аудио
-		audioPath, duration, err := h.ttsService.GenerateAudio(text, waypoint.ID.String())
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"error": fmt.Sprintf("Failed to generate audio for %s: %v", waypoint.POI.Name, err),
-			})
-			return
+		// Текст отклонен проверкой фактов или модерацией - точка остается без аудио
+		if content.AudioKey == "" || content.Status == models.ContentStatusRejected {
+			continue
 		}
 
-		// Сохраняем контент
-		content := models.Content{
-			WaypointID: waypoint.ID,
-			Text:       text,
-			AudioPath:  audioPath,
-			AudioURL:   fmt.Sprintf("/api/audio/%s", waypoint.ID.String()),
-			Duration:   duration,
-			Photos:     waypoint.POI.Photos,
-			Generated:  true,
+		// Озвученный рассказ ждет одобрения редактора (CONTENT_REQUIRE_APPROVAL)
+		if !h.reviewService.IsServable(content) {
+			awaitingReview = true
+			continue
 		}
 
-		if err := h.db.Create(&content).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save content"})
+		audioKeys = append(audioKeys, content.AudioKey)
+	}
+
+	if len(audioKeys) == 0 {
+		if awaitingReview {
+			// Аудио появится после проверки - его можно будет получить по ID маршрута
+			respondErrorDetails(c, http.StatusConflict, CodeAudioNotReady, "Audio is awaiting editorial review", gin.H{
+				"route_id": route.ID.String(),
+			})
 			return
 		}
-
-		audioFiles = append(audioFiles, audioPath)
+		// Маршрут уже создан: его можно отредактировать или озвучить позже
+		respondErrorDetails(c, http.StatusUnprocessableEntity, CodeModerationRejected, "No content passed fact check and moderation", gin.H{
+			"route_id": route.ID.String(),
+		})
+		return
 	}
 
 	// Объединяем аудио файлы
-	if len(audioFiles) == 1 {
+	downloadName := fmt.Sprintf("route_%s.mp3", route.ID.String()[:8])
+	if len(audioKeys) == 1 {
 		// Один файл - отдаем напрямую
-		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=route_%s.mp3", route.ID.String()[:8]))
-		c.File(audioFiles[0])
+		h.serveAudio(c, audioKeys[0], services.AudioVersion(audioKeys[0]), downloadName)
 		return
 	}
 
 	// Несколько файлов - объединяем
-	mergedPath, err := h.mergeAudioFiles(audioFiles, route.ID.String())
+	mergedKey, err := h.routeAudio.Merged(route.ID, audioKeys)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to merge audio files",
-			"details": err.Error(),
-		})
+		respondServiceError(c, err, "Failed to merge audio files")
 		return
 	}
 
 	// Отдаем объединенный файл
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=route_%s.mp3", route.ID.String()[:8]))
-	c.File(mergedPath)
+	h.serveAudio(c, mergedKey, services.RouteAudioVersion(audioKeys), downloadName)
 }
 
 // GetAudio получает аудио файл для одной точки
@@ -413,31 +420,42 @@ func (h *RouteHandler) GenerateRouteWithAudio(c *gin.Context) {
 // @Tags         audio
 // @Produce      audio/mpeg
 // @Param        waypoint_id path string true "Waypoint ID"
+// @Param        v query string false "Версия аудио из audio_url: ответ кэшируется бессрочно"
+// @Param        Range header string false "Диапазон байт, например bytes=0-1023"
+// @Param        If-None-Match header string false "ETag сохраненной копии"
 // @Success      200 {file} audio/mpeg "MP3 файл"
-// @Failure      400 {object} map[string]string
-// @Failure      404 {object} map[string]string
+// @Success      206 {file} audio/mpeg "Запрошенный диапазон байт"
+// @Success      302 "Редирект на временную ссылку в хранилище (AUDIO_PRESIGN_TTL)"
+// @Success      304 "Копия клиента актуальна"
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
 // @Router       /audio/{waypoint_id} [get]
 func (h *RouteHandler) GetAudio(c *gin.Context) {
 	waypointID := c.Param("waypoint_id")
 
 	uid, err := uuid.Parse(waypointID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid waypoint ID"})
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid waypoint ID")
 		return
 	}
 
 	var content models.Content
 	if err := h.db.First(&content, "waypoint_id = ?", uid).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Audio not found"})
+		respondError(c, http.StatusNotFound, CodeNotFound, "Audio not found")
+		return
+	}
+
+	if content.AudioKey == "" {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Audio not generated yet")
 		return
 	}
 
-	if content.AudioPath == "" {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Audio not generated yet"})
+	if !h.reviewService.IsServable(&content) {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Audio is not approved yet")
 		return
 	}
 
-	c.File(content.AudioPath)
+	h.serveAudio(c, content.AudioKey, services.AudioVersion(content.AudioKey), "")
 }
 
 // GetRouteAudio получает объединенный аудиофайл для всего маршрута
@@ -446,150 +464,286 @@ func (h *RouteHandler) GetAudio(c *gin.Context) {
 // @Tags         routes
 // @Produce      audio/mpeg
 // @Param        route_id path string true "Route ID"
+// @Param        Range header string false "Диапазон байт, например bytes=0-1023"
+// @Param        If-None-Match header string false "ETag сохраненной копии"
 // @Success      200 {file} audio/mpeg "MP3 файл"
-// @Failure      206 {object} map[string]interface{} "Частично готово"
-// @Failure      404 {object} map[string]interface{} "Не готово"
+// @Success      206 {file} audio/mpeg "Запрошенный диапазон байт"
+// @Success      302 "Редирект на временную ссылку в хранилище (AUDIO_PRESIGN_TTL)"
+// @Success      304 "Копия клиента актуальна"
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError "Маршрут не найден или аудио недоступно"
+// @Failure      409 {object} APIError "Аудио еще генерируется (см. Retry-After)"
 // @Router       /routes/{route_id}/audio [get]
 func (h *RouteHandler) GetRouteAudio(c *gin.Context) {
 	routeID := c.Param("route_id")
 
 	uid, err := uuid.Parse(routeID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid route ID"})
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid route ID")
 		return
 	}
 
 	// Получаем маршрут с waypoints
 	var route models.Route
-	if err := h.db.Preload("Waypoints").First(&route, "id = ?", uid).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Route not found"})
+	if err := h.db.Preload("Waypoints", func(db *gorm.DB) *gorm.DB { return db.Order(`"order"`) }).
+		First(&route, "id = ?", uid).Error; err != nil {
+		respondError(c, http.StatusNotFound, CodeNotFound, "Route not found")
 		return
 	}
 
 	if len(route.Waypoints) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No waypoints in route"})
+		respondError(c, http.StatusNotFound, CodeNotFound, "No waypoints in route")
 		return
 	}
 
 	// Получаем все аудио файлы
-	var audioFiles []string
-	var notReady []string
-
-	for _, wp := range route.Waypoints {
-		var content models.Content
-		err := h.db.First(&content, "waypoint_id = ?", wp.ID).Error
-
-		if err != nil || content.AudioPath == "" {
-			notReady = append(notReady, wp.POI.Name)
-			continue
-		}
-
-		audioFiles = append(audioFiles, content.AudioPath)
+	audioKeys, pending, err := h.routeAudioParts(&route)
+	if err != nil {
+		respondServiceError(c, err, "Failed to load audio")
+		return
 	}
 
-	// Если ни одно аудио не готово
-	if len(audioFiles) == 0 {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":   "No audio files generated yet",
-			"pending": notReady,
-			"message": "Audio is being generated. Please try again in 1-2 minutes",
+	// Часть аудио еще генерируется - клиенту стоит повторить запрос позже
+	if len(pending) > 0 {
+		c.Header("Retry-After", audioRetryAfter)
+		respondErrorDetails(c, http.StatusConflict, CodeAudioNotReady, "Audio is being generated, retry later", gin.H{
+			"ready":   len(audioKeys),
+			"total":   len(route.Waypoints),
+			"pending": pending,
 		})
 		return
 	}
 
-	// Если есть частично готовые
-	if len(notReady) > 0 {
-		c.JSON(http.StatusPartialContent, gin.H{
-			"error":   "Some audio files are not ready yet",
-			"ready":   len(audioFiles),
-			"pending": notReady,
-			"message": fmt.Sprintf("Only %d of %d audio files are ready", len(audioFiles), len(route.Waypoints)),
-		})
+	if len(audioKeys) == 0 {
+		respondError(c, http.StatusNotFound, CodeNotFound, "No audio available for this route")
 		return
 	}
 
 	// Если только один файл - отдаем его напрямую
-	if len(audioFiles) == 1 {
-		c.File(audioFiles[0])
+	if len(audioKeys) == 1 {
+		h.serveAudio(c, audioKeys[0], services.AudioVersion(audioKeys[0]), "")
 		return
 	}
 
-	// Объединяем несколько MP3 файлов
-	mergedPath, err := h.mergeAudioFiles(audioFiles, routeID)
+	// Объединенное аудио определяется ключами частей - у клиента может быть актуальная копия
+	version := services.RouteAudioVersion(audioKeys)
+	if audioNotModified(c, version) {
+		return
+	}
+
+	// Собранный ранее файл отдается сразу, склейка - только при изменении частей
+	mergedKey, err := h.routeAudio.Merged(route.ID, audioKeys)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to merge audio files",
-			"details": err.Error(),
-		})
+		respondServiceError(c, err, "Failed to merge audio files")
 		return
 	}
 
 	// Отдаем объединенный файл
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=route_%s.mp3", routeID[:8]))
-	c.File(mergedPath)
+	h.serveAudio(c, mergedKey, version, fmt.Sprintf("route_%s.mp3", routeID[:8]))
 }
 
-// mergeAudioFiles объединяет несколько MP3 файлов в один
-func (h *RouteHandler) mergeAudioFiles(files []string, routeID string) (string, error) {
-	// Создаем путь для объединенного файла
-	mergedPath := fmt.Sprintf("./audio/route_%s_full.mp3", routeID)
+// routeAudioParts возвращает ключи допустимого аудио точек по порядку
+// и ID точек, контент которых еще генерируется
+func (h *RouteHandler) routeAudioParts(route *models.Route) ([]string, []string, error) {
+	var audioKeys []string
+	var pending []string
 
-	// Создаем выходной файл
-	outFile, err := os.Create(mergedPath)
-	if err != nil {
-		return "", fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer outFile.Close()
+	for _, wp := range route.Waypoints {
+		var content models.Content
+		err := h.db.First(&content, "waypoint_id = ?", wp.ID).Error
 
-	// Копируем все файлы последовательно
-	for _, filePath := range files {
-		inFile, err := os.Open(filePath)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Контент еще генерируется
+			pending = append(pending, wp.ID.String())
+			continue
+		}
 		if err != nil {
-			return "", fmt.Errorf("failed to open %s: %w", filePath, err)
+			return nil, nil, err
 		}
 
-		_, err = io.Copy(outFile, inFile)
-		inFile.Close()
-
-		if err != nil {
-			return "", fmt.Errorf("failed to copy %s: %w", filePath, err)
+		// Рассказ отклонен проверкой или модерацией - точка остается без аудио
+		if content.AudioKey == "" || !h.reviewService.IsServable(&content) {
+			continue
 		}
+
+		audioKeys = append(audioKeys, content.AudioKey)
+	}
+
+	return audioKeys, pending, nil
+}
+
+// prepareRouteAudio заранее собирает объединенное аудио, когда готовы все точки маршрута
+func (h *RouteHandler) prepareRouteAudio(routeID uuid.UUID) {
+	var route models.Route
+	if err := h.db.Preload("Waypoints", func(db *gorm.DB) *gorm.DB { return db.Order(`"order"`) }).
+		First(&route, "id = ?", routeID).Error; err != nil {
+		log.Printf("Warning: failed to load route %s for audio: %v", routeID, err)
+		return
 	}
 
-	return mergedPath, nil
+	audioKeys, pending, err := h.routeAudioParts(&route)
+	if err != nil {
+		log.Printf("Warning: failed to load audio of route %s: %v", routeID, err)
+		return
+	}
+	// Сборку запустит генерация последней точки; одну часть склеивать не нужно
+	if len(pending) > 0 || len(audioKeys) < 2 {
+		return
+	}
+
+	if _, err := h.routeAudio.Merged(routeID, audioKeys); err != nil {
+		log.Printf("Warning: failed to merge audio of route %s: %v", routeID, err)
+	}
 }
 
+// audioRetryAfter - через сколько секунд повторить запрос, пока аудио генерируется
+const audioRetryAfter = "60"
+
 // Вспомогательные функции
 
-func (h *RouteHandler) generateContentForWaypoints(waypoints []models.Waypoint) {
+// generateContentForWaypoints генерирует контент точек маршрута по очереди и собирает общее аудио.
+// profile - способ передвижения по маршруту, от него зависит длина рассказов.
+func (h *RouteHandler) generateContentForWaypoints(profile services.TransportProfile, waypoints []models.Waypoint, client string) {
 	for _, waypoint := range waypoints {
-		// Генерируем текст
-		text, err := h.contentService.GenerateDescription(waypoint.POI)
-		if err != nil {
-			continue
+		if _, err := h.generateWaypointContent(waypoint, profile, client); err != nil {
+			log.Printf("Warning: %v", err)
 		}
+	}
+
+	if len(waypoints) > 0 {
+		h.prepareRouteAudio(waypoints[0].RouteID)
+	}
+}
+
+// generateWaypointContent генерирует текст и аудио для точки и сохраняет контент.
+// Если проверка фактов отклонила текст или генерация не удалась, сохраняется черновик без аудио
+// для редактора: точка больше не считается генерирующейся. Длина рассказа зависит от способа
+// передвижения profile. Озвученные символы списываются с квоты client, точка без озвучки возвращается на квоту.
+func (h *RouteHandler) generateWaypointContent(waypoint models.Waypoint, profile services.TransportProfile, client string) (content *models.Content, err error) {
+	defer func() {
+		if err != nil || content.AudioKey == "" {
+			h.releaseQuota(client, 1)
+		}
+	}()
+
+	// Генерируем текст
+	narration := profile.NarrationSeconds(waypoint.LegDuration)
+	description, err := h.contentService.GenerateDescription(waypoint.POI, narration)
+	if err != nil {
+		h.saveFailedContent(&models.Content{
+			WaypointID:       waypoint.ID,
+			Photos:           waypoint.POI.Photos,
+			NarrationSeconds: narration,
+		}, waypoint.POIID, err)
+		return nil, fmt.Errorf("failed to generate content for %s: %w", waypoint.POI.Name, err)
+	}
+
+	content = &models.Content{
+		WaypointID:       waypoint.ID,
+		Text:             description.Text,
+		Photos:           waypoint.POI.Photos,
+		Sources:          description.Sources,
+		NarrationSeconds: narration,
+		Status:           models.ContentStatusPendingReview,
+	}
 
-		// Генерируем аудио
-		audioPath, duration, err := h.ttsService.GenerateAudio(text, waypoint.ID.String())
+	if description.FactCheck != nil {
+		content.FactCheckVerdict = description.FactCheck.Verdict
+		content.FactCheckIssues = description.FactCheck.IssueStrings()
+	}
+	if content.FactCheckVerdict == services.FactCheckRejected {
+		content.Status = models.ContentStatusDraft
+	}
+
+	// Проверяем сгенерированный текст модерацией
+	if err := h.moderationService.CheckOutput(description.Text); err != nil {
+		content.Status = models.ContentStatusRejected
+		content.ReviewedBy = "moderation"
+		content.ReviewComment = err.Error()
+	}
+
+	// Генерируем аудио только для текста, прошедшего проверки
+	if content.Status == models.ContentStatusPendingReview {
+		audioKey, duration, err := h.ttsService.GenerateAudio(description.Text, waypoint.ID.String())
 		if err != nil {
-			continue
+			h.saveFailedContent(content, waypoint.POIID, err)
+			return nil, fmt.Errorf("failed to generate audio for %s: %w", waypoint.POI.Name, err)
 		}
+		if err := h.quotaService.AddCharacters(client, utf8.RuneCountInString(description.Text)); err != nil {
+			log.Printf("Warning: failed to record TTS usage: %v", err)
+		}
+
+		content.AudioKey = audioKey
+		content.AudioURL = services.WaypointAudioURL(waypoint.ID.String(), audioKey)
+		content.Duration = duration
+		content.Generated = true
+	}
 
-		// Сохраняем контент
-		content := models.Content{
-			WaypointID: waypoint.ID,
-			Text:       text,
-			AudioPath:  audioPath,
-			AudioURL:   fmt.Sprintf("/api/audio/%s", waypoint.ID.String()),
-			Duration:   duration,
-			Photos:     waypoint.POI.Photos,
-			Generated:  true,
+	// Сохраняем контент; если точку за время генерации удалили или заменили, аудио больше не нужно
+	if err := h.saveWaypointContent(content, waypoint.POIID); err != nil {
+		h.removeContentAudio(content)
+		if !errors.Is(err, errWaypointChanged) {
+			// Точка без контента считалась бы генерирующейся (в прогулке - бесконечно),
+			// поэтому сохраняем хотя бы текст черновиком без аудио
+			h.saveFailedContent(&models.Content{
+				WaypointID:       waypoint.ID,
+				Text:             content.Text,
+				Photos:           content.Photos,
+				Sources:          content.Sources,
+				NarrationSeconds: content.NarrationSeconds,
+				FactCheckVerdict: content.FactCheckVerdict,
+				FactCheckIssues:  content.FactCheckIssues,
+			}, waypoint.POIID, err)
 		}
+		return nil, fmt.Errorf("failed to save content for %s: %w", waypoint.POI.Name, err)
+	}
 
-		h.db.Create(&content)
+	return content, nil
+}
+
+// saveFailedContent сохраняет черновик без аудио для точки, генерация которой не удалась.
+// Если не сохраняется и он (например, текст не прошел ограничения базы), сохраняется пустой черновик.
+func (h *RouteHandler) saveFailedContent(content *models.Content, poiID uuid.UUID, cause error) {
+	content.Status = models.ContentStatusDraft
+	content.ReviewedBy = "generation"
+	content.ReviewComment = cause.Error()
+	err := h.saveWaypointContent(content, poiID)
+	if err != nil && content.Text != "" && !errors.Is(err, errWaypointChanged) {
+		err = h.saveWaypointContent(&models.Content{
+			WaypointID:       content.WaypointID,
+			Photos:           content.Photos,
+			NarrationSeconds: content.NarrationSeconds,
+			Status:           models.ContentStatusDraft,
+			ReviewedBy:       "generation",
+			ReviewComment:    cause.Error(),
+		}, poiID)
+	}
+	if err != nil && !errors.Is(err, errWaypointChanged) {
+		log.Printf("Warning: failed to save content draft: %v", err)
 	}
 }
 
+// errWaypointChanged - точку удалили или заменили другим местом, пока для нее генерировался контент
+var errWaypointChanged = errors.New("waypoint was removed or replaced during generation")
+
+// saveWaypointContent сохраняет контент, только если точка все еще ведет к месту poiID.
+// Строка точки блокируется так же, как при удалении контента (deleteWaypointContent),
+// поэтому удаление маршрута или точки не разминется с сохранением.
+func (h *RouteHandler) saveWaypointContent(content *models.Content, poiID uuid.UUID) error {
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		var waypoint models.Waypoint
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+			First(&waypoint, "id = ? AND poi_id = ?", content.WaypointID, poiID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errWaypointChanged
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Create(content).Error
+	})
+}
+
 func (h *RouteHandler) formatRouteResponse(route *models.Route, waypoints []models.Waypoint) models.RouteResponse {
 	waypointDetails := make([]models.WaypointDetails, len(waypoints))
 
@@ -602,30 +756,49 @@ func (h *RouteHandler) formatRouteResponse(route *models.Route, waypoints []mode
 				Lat: wp.POI.Latitude,
 				Lon: wp.POI.Longitude,
 			},
-			Epoch:    wp.POI.Epoch,
-			Category: wp.POI.Category,
-			Order:    wp.Order,
+			Epoch:       wp.POI.Epoch,
+			Category:    wp.POI.Category,
+			Order:       wp.Order,
+			LegDuration: wp.LegDuration,
 		}
 
-		if wp.Content != nil {
+		if h.reviewService.IsServable(wp.Content) {
 			detail.Content = &models.ContentDetails{
 				Text:            wp.Content.Text,
 				AudioURL:        wp.Content.AudioURL,
 				DurationSeconds: wp.Content.Duration,
 				Photos:          wp.Content.Photos,
+				Sources:         wp.Content.Sources,
+			}
+		} else if wp.Content != nil {
+			// Контент не прошел редакционную проверку - отдаем описание места без аудио
+			detail.Content = &models.ContentDetails{
+				Text:   wp.POI.Description,
+				Photos: wp.POI.Photos,
 			}
 		}
 
 		waypointDetails[i] = detail
 	}
 
-	return models.RouteResponse{
+	response := models.RouteResponse{
 		RouteID:           route.ID.String(),
 		Name:              route.Name,
 		TotalDistance:     route.TotalDistance,
 		EstimatedDuration: route.EstimatedDuration,
 		Waypoints:         waypointDetails,
+		RoundTrip:         route.RoundTrip,
+		TransportMode:     services.TransportProfileFor(route.TransportMode).Mode,
+		Geometry:          route.Geometry,
 	}
+	if route.StartLat != 0 || route.StartLon != 0 {
+		response.StartPoint = &models.Point{Lat: route.StartLat, Lon: route.StartLon}
+	}
+	if route.EndLat != nil && route.EndLon != nil {
+		response.EndPoint = &models.Point{Lat: *route.EndLat, Lon: *route.EndLon}
+	}
+
+	return response
 }
 
 func generateRouteName(epochs []string, interests []string) string {
@@ -668,7 +841,7 @@ func (h *RouteHandler) getPOIsByIDs(ids []string) ([]models.POI, error) {
 	for _, id := range ids {
 		uid, err := uuid.Parse(id)
 		if err != nil {
-			return nil, fmt.Errorf("invalid POI ID: %s", id)
+			return nil, fmt.Errorf("%w: invalid POI ID: %s", services.ErrValidation, id)
 		}
 		uuids = append(uuids, uid)
 	}
@@ -676,8 +849,8 @@ func (h *RouteHandler) getPOIsByIDs(ids []string) ([]models.POI, error) {
 	// Получаем POI из базы в том же порядке
 	for _, uid := range uuids {
 		var poi models.POI
-		if err := h.db.First(&poi, "id = ?", uid).Error; err != nil {
-			return nil, fmt.Errorf("POI not found: %s", uid)
+		if err := h.db.First(&poi, "id = ? AND visibility = ?", uid, models.POIVisibilityPublic).Error; err != nil {
+			return nil, fmt.Errorf("%w: POI not found: %s", services.ErrValidation, uid)
 		}
 		pois = append(pois, poi)
 	}
@@ -685,19 +858,281 @@ func (h *RouteHandler) getPOIsByIDs(ids []string) ([]models.POI, error) {
 	return pois, nil
 }
 
-// createCustomPOIs создает временные POI из пользовательских данных
+// selectPOIs подбирает места для маршрута. Обязательные места (poi_ids и custom_pois)
+// попадают в маршрут всегда; автоподбор по эпохам и интересам дополняет их на оставшееся
+// время, если задан fill_remaining или обязательных мест нет.
+func (h *RouteHandler) selectPOIs(req models.RouteRequest) (*services.Plan, error) {
+	var fixed []models.POI
+
+	// Конкретные POI ID из базы
+	if len(req.POIIDs) > 0 {
+		pois, err := h.getPOIsByIDs(req.POIIDs)
+		if err != nil {
+			return nil, err
+		}
+		fixed = append(fixed, pois...)
+	}
+
+	// Пользовательские места (создаем новые приватные POI)
+	if len(req.CustomPOIs) > 0 {
+		pois, err := h.createCustomPOIs(req.CustomPOIs)
+		if err != nil {
+			return nil, err
+		}
+		fixed = append(fixed, pois...)
+	}
+
+	end := requestEnd(req)
+	profile := services.TransportProfileFor(req.TransportMode)
+
+	// Автоматический поиск по критериям
+	var candidates []models.POI
+	if len(fixed) == 0 || req.FillRemaining {
+		reach := float64(req.DurationMinutes) * profile.Speed
+
+		var err error
+		if req.EndPoint != nil {
+			// Маршрут из точки в точку: ищем в коридоре между стартом и финишем
+			direct := services.Distance(req.StartPoint.Lat, req.StartPoint.Lon, end.Lat, end.Lon)
+			maxPath := math.Min(math.Max(reach, direct+1000), direct+2*profile.MaxRadius)
+
+			candidates, err = h.poiService.FindInCorridor(
+				req.StartPoint.Lat,
+				req.StartPoint.Lon,
+				end.Lat,
+				end.Lon,
+				maxPath,
+				req.Epochs,
+				req.Interests,
+			)
+		} else {
+			radius := profile.SearchRadius(req.DurationMinutes)
+			if req.RoundTrip {
+				// Нужно успеть вернуться обратно
+				radius /= 2
+			}
+
+			candidates, err = h.poiService.FindNearby(
+				req.StartPoint.Lat,
+				req.StartPoint.Lon,
+				radius,
+				req.Epochs,
+				req.Interests,
+			)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to find POIs: %w", err)
+		}
+	}
+
+	// Ограничиваем количество точек (обязательные не отбрасываются)
+	maxPoints := req.MaxWaypoints
+	if maxPoints == 0 || maxPoints > 10 {
+		maxPoints = 5
+	}
+
+	plan := h.routePlanner.Plan(services.PlanRequest{
+		StartLat:      req.StartPoint.Lat,
+		StartLon:      req.StartPoint.Lon,
+		Fixed:         fixed,
+		Candidates:    candidates,
+		BudgetMinutes: req.DurationMinutes,
+		MaxStops:      maxPoints,
+		OptimizeOrder: req.OptimizeOrder,
+		End:           end,
+		Speed:         profile.Speed,
+	})
+
+	return &plan, nil
+}
+
+// createRoute сохраняет маршрут и его точки в порядке плана; owner - автор маршрута
+func (h *RouteHandler) createRoute(req models.RouteRequest, plan *services.Plan, description string, owner routeOwner) (*models.Route, []models.Waypoint, error) {
+	route := &models.Route{
+		Name:              generateRouteName(req.Epochs, req.Interests),
+		Description:       description,
+		TotalDistance:     plan.DistanceMeters,
+		EstimatedDuration: plan.DurationMinutes,
+		Epochs:            req.Epochs,
+		Categories:        req.Interests,
+		StartLat:          req.StartPoint.Lat,
+		StartLon:          req.StartPoint.Lon,
+		RoundTrip:         req.RoundTrip,
+		TransportMode:     services.TransportProfileFor(req.TransportMode).Mode,
+		UserID:            owner.userID,
+		APIKeyID:          owner.apiKeyID,
+	}
+	if req.EndPoint != nil {
+		route.EndLat = &req.EndPoint.Lat
+		route.EndLon = &req.EndPoint.Lon
+	}
+
+	if err := h.db.Create(route).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create route: %w", err)
+	}
+
+	// Пользовательские места принадлежат только этому маршруту
+	if len(req.CustomPOIs) > 0 {
+		if err := h.poiService.AssignOwner(poiIDs(plan.POIs), route.ID); err != nil {
+			return nil, nil, fmt.Errorf("failed to assign custom POIs: %w", err)
+		}
+	}
+
+	// Создаем waypoints
+	waypoints := make([]models.Waypoint, len(plan.POIs))
+	for i, poi := range plan.POIs {
+		waypoints[i] = models.Waypoint{
+			RouteID: route.ID,
+			POIID:   poi.ID,
+			Order:   i + 1,
+		}
+	}
+
+	if err := h.db.Create(&waypoints).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to create waypoints: %w", err)
+	}
+
+	// Загружаем POI данные для каждой waypoint
+	for i := range waypoints {
+		waypoints[i].POI = plan.POIs[i]
+	}
+
+	// Уточняем длину и геометрию по маршруту 2GIS для выбранного способа передвижения
+	if err := h.recalculateRoute(route, waypoints); err != nil {
+		return nil, nil, err
+	}
+
+	return route, waypoints, nil
+}
+
+// recalculateRoute пересчитывает длину, длительность и геометрию маршрута по текущим точкам
+// с учетом способа передвижения маршрута
+func (h *RouteHandler) recalculateRoute(route *models.Route, waypoints []models.Waypoint) error {
+	var points []services.RoutePoint
+	// У старых маршрутов точка старта не сохранена - считаем от первой точки
+	if route.StartLat != 0 || route.StartLon != 0 {
+		points = append(points, services.RoutePoint{Lat: route.StartLat, Lon: route.StartLon})
+	}
+	for _, wp := range waypoints {
+		points = append(points, services.RoutePoint{Lat: wp.POI.Latitude, Lon: wp.POI.Longitude})
+	}
+	// Последний отрезок - до финиша или обратно к старту
+	if end := routeEnd(route); end != nil {
+		points = append(points, *end)
+	}
+
+	profile := services.TransportProfileFor(route.TransportMode)
+	result := h.gisService.EstimateRoute(points, profile)
+
+	route.TotalDistance = float64(result.TotalDistance)
+	route.EstimatedDuration = h.routePlanner.EstimateMinutes(result.TotalDuration, len(waypoints))
+	route.Geometry = result.Geometry
+
+	// Время каждого перехода: общее время маршрута делим пропорционально длине отрезков по прямой
+	legs := make([]float64, len(waypoints))
+	straight := 0.0
+	lat, lon := route.StartLat, route.StartLon
+	if lat == 0 && lon == 0 && len(waypoints) > 0 {
+		lat, lon = waypoints[0].POI.Latitude, waypoints[0].POI.Longitude
+	}
+	for i, wp := range waypoints {
+		legs[i] = services.Distance(lat, lon, wp.POI.Latitude, wp.POI.Longitude)
+		straight += legs[i]
+		lat, lon = wp.POI.Latitude, wp.POI.Longitude
+	}
+	if end := routeEnd(route); end != nil {
+		straight += services.Distance(lat, lon, end.Lat, end.Lon)
+	}
+
+	for i := range waypoints {
+		leg := 0
+		if straight > 0 {
+			leg = int(float64(result.TotalDuration) * legs[i] / straight)
+		}
+		waypoints[i].LegDuration = leg
+	}
+
+	// Геометрию маршрута и времена переходов сохраняем вместе
+	return h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(route).Select("total_distance", "estimated_duration", "geometry").Updates(route).Error; err != nil {
+			return fmt.Errorf("failed to update route geometry: %w", err)
+		}
+		for _, wp := range waypoints {
+			if err := tx.Model(&models.Waypoint{}).Where("id = ?", wp.ID).Update("leg_duration", wp.LegDuration).Error; err != nil {
+				return fmt.Errorf("failed to update leg duration: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// validateRouteRequest проверяет согласованность параметров маршрута
+func validateRouteRequest(req models.RouteRequest) error {
+	if req.EndPoint != nil && req.RoundTrip {
+		return errors.New("end_point and round_trip cannot be used together")
+	}
+	return nil
+}
+
+// requestEnd возвращает финиш маршрута из запроса (nil - без финиша)
+func requestEnd(req models.RouteRequest) *services.RoutePoint {
+	switch {
+	case req.EndPoint != nil:
+		return &services.RoutePoint{Lat: req.EndPoint.Lat, Lon: req.EndPoint.Lon}
+	case req.RoundTrip:
+		return &services.RoutePoint{Lat: req.StartPoint.Lat, Lon: req.StartPoint.Lon}
+	default:
+		return nil
+	}
+}
+
+// routeEnd возвращает финиш сохраненного маршрута (nil - без финиша)
+func routeEnd(route *models.Route) *services.RoutePoint {
+	switch {
+	case route.EndLat != nil && route.EndLon != nil:
+		return &services.RoutePoint{Lat: *route.EndLat, Lon: *route.EndLon}
+	case route.RoundTrip:
+		return &services.RoutePoint{Lat: route.StartLat, Lon: route.StartLon}
+	default:
+		return nil
+	}
+}
+
+// poiIDs возвращает ID мест
+func poiIDs(pois []models.POI) []uuid.UUID {
+	ids := make([]uuid.UUID, len(pois))
+	for i, poi := range pois {
+		ids[i] = poi.ID
+	}
+	return ids
+}
+
+// createCustomPOIs создает приватные POI из пользовательских данных.
+// Они не видны в каталоге и удаляются вместе с маршрутом.
 func (h *RouteHandler) createCustomPOIs(customPOIs []models.CustomPOI) ([]models.POI, error) {
+	// Пользовательский текст попадает в промпт - проверяем его до сохранения
+	fields := make(map[string]string, len(customPOIs)*2)
+	for i, custom := range customPOIs {
+		fields[fmt.Sprintf("custom_pois[%d].name", i)] = custom.Name
+		fields[fmt.Sprintf("custom_pois[%d].description", i)] = custom.Description
+	}
+	if err := h.moderationService.CheckInput(fields); err != nil {
+		return nil, err
+	}
+
 	pois := make([]models.POI, 0, len(customPOIs))
 	
 	for _, custom := range customPOIs {
 		poi := models.POI{
-			Name:        custom.Name,
-			Description: custom.Description,
-			Latitude:    custom.Latitude,
-			Longitude:   custom.Longitude,
-			Epoch:       custom.Epoch,
-			Category:    custom.Category,
-			Importance:  5, // Средняя важность
+			Name:          custom.Name,
+			Description:   custom.Description,
+			Latitude:      custom.Latitude,
+			Longitude:     custom.Longitude,
+			Epoch:         custom.Epoch,
+			Category:      custom.Category,
+			Importance:    5, // Средняя важность
+			Visibility:    models.POIVisibilityPrivate,
+			TriggerRadius: custom.TriggerRadius,
 		}
 		
 		// Сохраняем в базу
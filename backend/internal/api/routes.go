@@ -1,6 +1,10 @@
 package api
 
 import (
+	"log"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
 	"github.com/dimmy-kor/audioguid/internal/services"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -11,14 +15,40 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB) {
 	// Инициализация сервисов
 	gisService := services.NewGISService()
 	poiService := services.NewPOIService(db)
-	contentService := services.NewContentService()
-	ttsService := services.NewTTSService()
+	enrichmentService := services.NewEnrichmentService(db)
+	factCheckService := services.NewFactCheckService()
+	contentService := services.NewContentService(enrichmentService, factCheckService)
+	audioStore, err := services.NewAudioStore()
+	if err != nil {
+		log.Fatalf("Failed to initialize audio store: %v", err)
+	}
+	ttsService := services.NewTTSService(audioStore)
+	routeAudioService := services.NewRouteAudioService(db, audioStore)
+	routePlanner := services.NewRoutePlanner()
+	reviewService := services.NewReviewService(db, ttsService, audioStore)
+	moderationService := services.NewModerationService(contentService)
+	authService := services.NewAuthService(db)
+	quotaService := services.NewQuotaService(db)
+	userService := services.NewUserService(db)
+	apiLimiter := services.NewRateLimiter("RATE_LIMIT", 120, 30)
+	generateLimiter := services.NewRateLimiter("GENERATE_RATE_LIMIT", 6, 3)
 
 	// Хендлеры
-	routeHandler := NewRouteHandler(gisService, poiService, contentService, ttsService, db)
+	routeHandler := NewRouteHandler(gisService, poiService, contentService, ttsService, audioStore, routeAudioService, routePlanner, reviewService, moderationService, quotaService, userService, db)
+	adminHandler := NewAdminHandler(reviewService, poiService, authService, db)
+
+	// Фоновая очистка пользовательских мест удаленных маршрутов и замененного аудио
+	go poiService.RunPrivateCleanup(time.Hour, 24*time.Hour)
+	go routeAudioService.RunStaleCleanup(time.Hour, 24*time.Hour)
+
+	// Ошибки в формате problem+json с идентификатором запроса
+	useJSONFieldNames()
+	router.Use(RequestID())
+	router.NoRoute(notFoundHandler)
 
-	// API группа
+	// API группа: чтение открыто, генерация и администрирование - по API-ключу или JWT
 	api := router.Group("/api")
+	api.Use(Authenticate(authService), RateLimit(apiLimiter))
 	{
 		// Health check
 		api.GET("/health", func(c *gin.Context) {
@@ -31,20 +61,75 @@ func RegisterRoutes(router *gin.Engine, db *gorm.DB) {
 		// Маршруты
 		routes := api.Group("/routes")
 		{
-			routes.POST("/generate", routeHandler.GenerateRoute)
-			routes.POST("/generate-audio", routeHandler.GenerateRouteWithAudio)
 			routes.GET("/:route_id", routeHandler.GetRoute)
 			routes.GET("/:route_id/audio", routeHandler.GetRouteAudio)
+			routes.GET("/:route_id/audio.m3u8", routeHandler.GetRouteAudioPlaylist)
+			routes.GET("/:route_id/package", routeHandler.GetRoutePackage)
+			routes.GET("/:route_id/export.gpx", routeHandler.ExportRouteGPX)
+			routes.GET("/:route_id/export.kml", routeHandler.ExportRouteKML)
+			routes.GET("/:route_id/export.geojson", routeHandler.ExportRouteGeoJSON)
+			routes.POST("/:route_id/navigation", routeHandler.NavigateRoute)
+
+			// Генерация и редактирование запускают YandexGPT и SpeechKit
+			generate := routes.Group("", RequireScope(models.ScopeRoutesGenerate), RateLimit(generateLimiter))
+			generate.POST("/generate", routeHandler.GenerateRoute)
+			generate.POST("/generate-audio", routeHandler.GenerateRouteWithAudio)
+			generate.POST("/import", routeHandler.ImportRoute)
+			generate.POST("/roam", routeHandler.Roam)
+			generate.POST("/:route_id/waypoints", routeHandler.AddWaypoint)
+			generate.PATCH("/:route_id/waypoints", routeHandler.ReorderWaypoints)
+			generate.PUT("/:route_id/waypoints/:waypoint_id", routeHandler.ReplaceWaypoint)
+			generate.DELETE("/:route_id/waypoints/:waypoint_id", routeHandler.RemoveWaypoint)
 		}
 
 		// Места интереса
 		pois := api.Group("/pois")
 		{
 			pois.GET("", routeHandler.GetPOIs)
+			pois.GET("/search", routeHandler.SearchPOIs)
+			pois.GET("/autocomplete", routeHandler.AutocompletePOIs)
 			pois.GET("/:poi_id", routeHandler.GetPOI)
 		}
 
 		// Аудио
 		api.GET("/audio/:waypoint_id", routeHandler.GetAudio)
+
+		// Текущий клиент
+		me := api.Group("/me")
+		{
+			me.GET("/quota", RequireScope(models.ScopeRoutesGenerate), routeHandler.GetMyQuota)
+
+			// История и избранное есть только у пользователей с JWT
+			user := me.Group("", RequireUser())
+			user.GET("/routes", routeHandler.ListMyRoutes)
+			user.DELETE("/routes/:route_id", routeHandler.DeleteMyRoute)
+			user.GET("/favorites", routeHandler.GetMyFavorites)
+			user.PUT("/favorites/pois/:poi_id", routeHandler.AddFavoritePOI)
+			user.DELETE("/favorites/pois/:poi_id", routeHandler.RemoveFavoritePOI)
+			user.PUT("/favorites/routes/:route_id", routeHandler.AddFavoriteRoute)
+			user.DELETE("/favorites/routes/:route_id", routeHandler.RemoveFavoriteRoute)
+		}
+
+		// Администрирование
+		admin := api.Group("/admin")
+		{
+			// Редакционная проверка контента
+			content := admin.Group("/content", RequireScope(models.ScopeAdmin))
+			content.GET("", adminHandler.ListContent)
+			content.GET("/:content_id", adminHandler.GetContent)
+			content.PUT("/:content_id", adminHandler.UpdateContent)
+			content.POST("/:content_id/approve", adminHandler.ApproveContent)
+			content.POST("/:content_id/reject", adminHandler.RejectContent)
+
+			// Пользовательские места
+			admin.POST("/pois/:poi_id/promote", RequireScope(models.ScopePOIsWrite), adminHandler.PromotePOI)
+			admin.PUT("/pois/:poi_id/trigger-radius", RequireScope(models.ScopePOIsWrite), adminHandler.SetPOITriggerRadius)
+
+			// API-ключи клиентов
+			keys := admin.Group("/keys", RequireScope(models.ScopeAdmin))
+			keys.POST("", adminHandler.CreateAPIKey)
+			keys.GET("", adminHandler.ListAPIKeys)
+			keys.DELETE("/:key_id", adminHandler.RevokeAPIKey)
+		}
 	}
 }
@@ -0,0 +1,438 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/dimmy-kor/audioguid/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Редактирование точек существующего маршрута.
+// После любого изменения пересчитываются длина и геометрия маршрута,
+// контент генерируется только для новых точек, а объединенное аудио маршрута сбрасывается.
+
+// AddWaypoint добавляет точку в маршрут
+// @Summary      Добавить точку
+// @Description  Вставляет место из каталога (poi_id) или свое место (custom_poi) на указанную позицию. Контент генерируется асинхронно только для новой точки.
+// @Tags         routes
+// @Accept       json
+// @Produce      json
+// @Param        route_id path string true "Route ID"
+// @Param        request body models.WaypointInsertRequest true "Место и позиция"
+// @Success      200 {object} models.RouteResponse
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      422 {object} APIError "Свое место не прошло модерацию"
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /routes/{route_id}/waypoints [post]
+func (h *RouteHandler) AddWaypoint(c *gin.Context) {
+	route, ok := h.routeFromPath(c)
+	if !ok {
+		return
+	}
+
+	var req models.WaypointInsertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	poi, err := h.resolveWaypointPOI(route.ID, req.POIID, req.CustomPOI)
+	if err != nil {
+		respondServiceError(c, err, "Failed to resolve POI")
+		return
+	}
+
+	// Квота списывается, когда место уже найдено и прошло модерацию;
+	// неиспользованное свое место удалит очистка пользовательских мест
+	client, ok := h.reserveQuota(c, 1)
+	if !ok {
+		return
+	}
+
+	position := req.Position
+	if position <= 0 || position > len(route.Waypoints) {
+		position = len(route.Waypoints) + 1
+	}
+
+	waypoint := models.Waypoint{
+		RouteID: route.ID,
+		POIID:   poi.ID,
+		Order:   position,
+	}
+
+	waypoints := append([]models.Waypoint(nil), route.Waypoints[:position-1]...)
+	waypoints = append(waypoints, waypoint)
+	waypoints = append(waypoints, route.Waypoints[position-1:]...)
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&waypoints[position-1]).Error; err != nil {
+			return err
+		}
+		return renumberWaypoints(tx, waypoints)
+	})
+	if err != nil {
+		h.releaseQuota(client, 1)
+		respondServiceError(c, err, "Failed to add waypoint")
+		return
+	}
+
+	waypoints[position-1].POI = *poi
+	h.respondWaypointsChanged(c, route, waypoints)
+
+	// Генерируем после пересчета: длина рассказа зависит от времени перехода
+	go h.generateContentForWaypoints(services.TransportProfileFor(route.TransportMode), []models.Waypoint{waypoints[position-1]}, client)
+}
+
+// RemoveWaypoint удаляет точку из маршрута
+// @Summary      Удалить точку
+// @Description  Удаляет точку вместе с ее контентом и аудио, остальные точки перенумеровываются
+// @Tags         routes
+// @Produce      json
+// @Param        route_id path string true "Route ID"
+// @Param        waypoint_id path string true "Waypoint ID"
+// @Success      200 {object} models.RouteResponse
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /routes/{route_id}/waypoints/{waypoint_id} [delete]
+func (h *RouteHandler) RemoveWaypoint(c *gin.Context) {
+	route, ok := h.routeFromPath(c)
+	if !ok {
+		return
+	}
+
+	index, ok := waypointFromPath(c, route)
+	if !ok {
+		return
+	}
+
+	if len(route.Waypoints) == 1 {
+		respondError(c, http.StatusBadRequest, CodeValidationFailed, "Route must contain at least one waypoint")
+		return
+	}
+
+	removed := route.Waypoints[index]
+	waypoints := append(append([]models.Waypoint(nil), route.Waypoints[:index]...), route.Waypoints[index+1:]...)
+
+	var contents []models.Content
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if contents, err = deleteWaypointContent(tx, []uuid.UUID{removed.ID}); err != nil {
+			return err
+		}
+		if err := tx.Delete(&models.Waypoint{}, "id = ?", removed.ID).Error; err != nil {
+			return err
+		}
+		return renumberWaypoints(tx, waypoints)
+	})
+	if err != nil {
+		respondServiceError(c, err, "Failed to remove waypoint")
+		return
+	}
+
+	h.removeContentsAudio(contents)
+
+	h.respondWaypointsChanged(c, route, waypoints)
+}
+
+// ReorderWaypoints меняет порядок точек
+// @Summary      Изменить порядок точек
+// @Description  Принимает полный список ID точек маршрута в новом порядке. Контент не перегенерируется.
+// @Tags         routes
+// @Accept       json
+// @Produce      json
+// @Param        route_id path string true "Route ID"
+// @Param        request body models.WaypointReorderRequest true "ID точек в новом порядке"
+// @Success      200 {object} models.RouteResponse
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /routes/{route_id}/waypoints [patch]
+func (h *RouteHandler) ReorderWaypoints(c *gin.Context) {
+	route, ok := h.routeFromPath(c)
+	if !ok {
+		return
+	}
+
+	var req models.WaypointReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	if len(req.WaypointIDs) != len(route.Waypoints) {
+		respondError(c, http.StatusBadRequest, CodeValidationFailed, "waypoint_ids must list every waypoint of the route exactly once")
+		return
+	}
+
+	byID := make(map[string]models.Waypoint, len(route.Waypoints))
+	for _, wp := range route.Waypoints {
+		byID[wp.ID.String()] = wp
+	}
+
+	waypoints := make([]models.Waypoint, 0, len(req.WaypointIDs))
+	for _, id := range req.WaypointIDs {
+		wp, ok := byID[id]
+		if !ok {
+			respondError(c, http.StatusBadRequest, CodeValidationFailed, "waypoint_ids must list every waypoint of the route exactly once")
+			return
+		}
+		delete(byID, id)
+		waypoints = append(waypoints, wp)
+	}
+
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return renumberWaypoints(tx, waypoints)
+	}); err != nil {
+		respondServiceError(c, err, "Failed to reorder waypoints")
+		return
+	}
+
+	h.respondWaypointsChanged(c, route, waypoints)
+}
+
+// ReplaceWaypoint заменяет место в точке маршрута
+// @Summary      Заменить точку
+// @Description  Ставит на место точки другое место из каталога или свое место. Старый контент удаляется, новый генерируется асинхронно.
+// @Tags         routes
+// @Accept       json
+// @Produce      json
+// @Param        route_id path string true "Route ID"
+// @Param        waypoint_id path string true "Waypoint ID"
+// @Param        request body models.WaypointReplaceRequest true "Новое место"
+// @Success      200 {object} models.RouteResponse
+// @Failure      400 {object} APIError
+// @Failure      404 {object} APIError
+// @Failure      422 {object} APIError "Свое место не прошло модерацию"
+// @Failure      401 {object} APIError
+// @Failure      403 {object} APIError
+// @Security     ApiKeyAuth
+// @Security     BearerAuth
+// @Router       /routes/{route_id}/waypoints/{waypoint_id} [put]
+func (h *RouteHandler) ReplaceWaypoint(c *gin.Context) {
+	route, ok := h.routeFromPath(c)
+	if !ok {
+		return
+	}
+
+	index, ok := waypointFromPath(c, route)
+	if !ok {
+		return
+	}
+
+	var req models.WaypointReplaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+
+	poi, err := h.resolveWaypointPOI(route.ID, req.POIID, req.CustomPOI)
+	if err != nil {
+		respondServiceError(c, err, "Failed to resolve POI")
+		return
+	}
+
+	// Квота списывается, когда место уже найдено и прошло модерацию;
+	// неиспользованное свое место удалит очистка пользовательских мест
+	client, ok := h.reserveQuota(c, 1)
+	if !ok {
+		return
+	}
+
+	waypoints := append([]models.Waypoint(nil), route.Waypoints...)
+	replaced := waypoints[index]
+
+	var contents []models.Content
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if contents, err = deleteWaypointContent(tx, []uuid.UUID{replaced.ID}); err != nil {
+			return err
+		}
+		return tx.Model(&models.Waypoint{}).Where("id = ?", replaced.ID).Update("poi_id", poi.ID).Error
+	})
+	if err != nil {
+		h.releaseQuota(client, 1)
+		respondServiceError(c, err, "Failed to replace waypoint")
+		return
+	}
+
+	h.removeContentsAudio(contents)
+
+	waypoints[index].POIID = poi.ID
+	waypoints[index].POI = *poi
+	waypoints[index].Content = nil
+	h.respondWaypointsChanged(c, route, waypoints)
+
+	go h.generateContentForWaypoints(services.TransportProfileFor(route.TransportMode), []models.Waypoint{waypoints[index]}, client)
+}
+
+// Вспомогательные функции
+
+// loadRoute загружает маршрут с точками (по порядку), местами и контентом
+func (h *RouteHandler) loadRoute(id uuid.UUID) (*models.Route, error) {
+	var route models.Route
+	err := h.db.
+		Preload("Waypoints", func(db *gorm.DB) *gorm.DB { return db.Order(`"order"`) }).
+		Preload("Waypoints.POI").
+		Preload("Waypoints.Content").
+		First(&route, "id = ?", id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// routeFromPath загружает маршрут по :route_id для изменения, при ошибке отвечает клиенту
+func (h *RouteHandler) routeFromPath(c *gin.Context) (*models.Route, bool) {
+	uid, err := uuid.Parse(c.Param("route_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid route ID")
+		return nil, false
+	}
+
+	route, err := h.loadRoute(uid)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			respondError(c, http.StatusNotFound, CodeNotFound, "Route not found")
+		} else {
+			respondServiceError(c, err, "Failed to load route")
+		}
+		return nil, false
+	}
+
+	// Маршрут может менять только его автор - пользователь или API-ключ (или администратор)
+	if !h.checkRouteOwner(c, route) {
+		return nil, false
+	}
+
+	return route, true
+}
+
+// waypointFromPath находит индекс точки :waypoint_id в маршруте
+func waypointFromPath(c *gin.Context, route *models.Route) (int, bool) {
+	uid, err := uuid.Parse(c.Param("waypoint_id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, CodeInvalidRequest, "Invalid waypoint ID")
+		return 0, false
+	}
+
+	for i, wp := range route.Waypoints {
+		if wp.ID == uid {
+			return i, true
+		}
+	}
+
+	respondError(c, http.StatusNotFound, CodeNotFound, "Waypoint not found")
+	return 0, false
+}
+
+// resolveWaypointPOI находит место из каталога или создает свое место, принадлежащее маршруту
+func (h *RouteHandler) resolveWaypointPOI(routeID uuid.UUID, poiID string, custom *models.CustomPOI) (*models.POI, error) {
+	switch {
+	case poiID != "" && custom != nil:
+		return nil, fmt.Errorf("%w: specify either poi_id or custom_poi, not both", services.ErrValidation)
+	case poiID != "":
+		pois, err := h.getPOIsByIDs([]string{poiID})
+		if err != nil {
+			return nil, err
+		}
+		return &pois[0], nil
+	case custom != nil:
+		pois, err := h.createCustomPOIs([]models.CustomPOI{*custom})
+		if err != nil {
+			return nil, err
+		}
+		if err := h.poiService.AssignOwner(poiIDs(pois), routeID); err != nil {
+			return nil, fmt.Errorf("failed to assign custom POI: %w", err)
+		}
+		return &pois[0], nil
+	default:
+		return nil, fmt.Errorf("%w: poi_id or custom_poi is required", services.ErrValidation)
+	}
+}
+
+// respondWaypointsChanged пересчитывает маршрут и отдает его. Объединенное аудио сбрасывать
+// не нужно: его версия зависит от частей, и при следующем запросе оно соберется заново.
+func (h *RouteHandler) respondWaypointsChanged(c *gin.Context, route *models.Route, waypoints []models.Waypoint) {
+	for i := range waypoints {
+		waypoints[i].Order = i + 1
+	}
+
+	if err := h.recalculateRoute(route, waypoints); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	c.JSON(http.StatusOK, h.formatRouteResponse(route, waypoints))
+}
+
+// renumberWaypoints проставляет порядковые номера по позиции в списке
+func renumberWaypoints(tx *gorm.DB, waypoints []models.Waypoint) error {
+	for i, wp := range waypoints {
+		if err := tx.Model(&models.Waypoint{}).Where("id = ?", wp.ID).Update("order", i+1).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteWaypointContent удаляет контент точек и возвращает его, чтобы после фиксации транзакции
+// удалить аудио. Строки точек блокируются: генерация, которая сохраняет контент под той же
+// блокировкой (saveWaypointContent), либо успеет раньше и ее контент удалится здесь,
+// либо увидит, что точки уже нет.
+func deleteWaypointContent(tx *gorm.DB, waypointIDs []uuid.UUID) ([]models.Content, error) {
+	if len(waypointIDs) == 0 {
+		return nil, nil
+	}
+
+	var locked []models.Waypoint
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		Where("id IN ?", waypointIDs).Find(&locked).Error; err != nil {
+		return nil, err
+	}
+
+	var contents []models.Content
+	if err := tx.Where("waypoint_id IN ?", waypointIDs).Find(&contents).Error; err != nil {
+		return nil, err
+	}
+	if len(contents) == 0 {
+		return nil, nil
+	}
+	if err := tx.Where("waypoint_id IN ?", waypointIDs).Delete(&models.Content{}).Error; err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// removeContentsAudio удаляет аудиофайлы удаленного контента
+func (h *RouteHandler) removeContentsAudio(contents []models.Content) {
+	for i := range contents {
+		h.removeContentAudio(&contents[i])
+	}
+}
+
+// removeContentAudio удаляет аудиофайл удаленного контента
+func (h *RouteHandler) removeContentAudio(content *models.Content) {
+	if content == nil || content.AudioKey == "" {
+		return
+	}
+	if err := h.audioStore.Delete(content.AudioKey); err != nil {
+		log.Printf("Warning: failed to remove audio %s: %v", content.AudioKey, err)
+	}
+}
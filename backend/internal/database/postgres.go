@@ -38,9 +38,49 @@ func Migrate(db *gorm.DB) error {
 		&models.Route{},
 		&models.Waypoint{},
 		&models.Content{},
+		&models.APIKey{},
+		&models.QuotaUsage{},
+		&models.User{},
+		&models.Favorite{},
+		&models.StaleAudio{},
 	); err != nil {
 		return fmt.Errorf("failed to migrate models: %w", err)
 	}
 
+	// Раньше в контенте хранился путь к файлу на диске (./audio/<id>.mp3) - переводим в ключи хранилища
+	if db.Migrator().HasColumn(&models.Content{}, "audio_path") {
+		err := db.Exec(`UPDATE contents SET audio_key = regexp_replace(audio_path, '^(\./)?audio/', '')
+			WHERE coalesce(audio_key, '') = '' AND coalesce(audio_path, '') <> ''`).Error
+		if err != nil {
+			return fmt.Errorf("failed to migrate audio paths: %w", err)
+		}
+		if err := db.Migrator().DropColumn(&models.Content{}, "audio_path"); err != nil {
+			return fmt.Errorf("failed to drop audio_path: %w", err)
+		}
+	}
+
+	// Полнотекстовый и нечеткий поиск по местам (не критично для остального API)
+	for _, stmt := range searchMigrations {
+		if err := db.Exec(stmt).Error; err != nil {
+			fmt.Printf("Warning: Could not set up POI search: %v\n", err)
+			break
+		}
+	}
+
 	return nil
 }
+
+// searchMigrations - индексы для поиска мест: tsvector на русском и английском
+// (название важнее описания) и триграммы для опечаток и транслитерации
+var searchMigrations = []string{
+	"CREATE EXTENSION IF NOT EXISTS pg_trgm",
+	`ALTER TABLE pois ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('russian', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('english', coalesce(name, '')), 'A') ||
+		setweight(to_tsvector('russian', coalesce(architect, '') || ' ' || coalesce(style, '')), 'B') ||
+		setweight(to_tsvector('russian', coalesce(description, '')), 'C') ||
+		setweight(to_tsvector('english', coalesce(description, '')), 'D')
+	) STORED`,
+	"CREATE INDEX IF NOT EXISTS idx_pois_search_vector ON pois USING gin (search_vector)",
+	"CREATE INDEX IF NOT EXISTS idx_pois_name_trgm ON pois USING gin (lower(name) gin_trgm_ops)",
+}
@@ -22,11 +22,22 @@ type POI struct {
 	Style        string                  `json:"style,omitempty"`
 	Photos       pq.StringArray          `gorm:"type:text[]" json:"photos" swaggertype:"array,string"`
 	WikipediaURL string                  `json:"wikipedia_url,omitempty"`
-	Metadata     *map[string]interface{} `gorm:"type:jsonb" json:"metadata,omitempty" swaggerignore:"true"`
-	CreatedAt    time.Time               `json:"created_at"`
-	UpdatedAt    time.Time               `json:"updated_at"`
+	Metadata     *map[string]interface{} `gorm:"type:jsonb;serializer:json" json:"metadata,omitempty" swaggerignore:"true"`
+	// Видимость: public - общий каталог, private - пользовательское место одного маршрута
+	Visibility   string     `gorm:"index;not null;default:public" json:"visibility"`
+	OwnerRouteID *uuid.UUID `gorm:"type:uuid;index" json:"owner_route_id,omitempty"`
+	// Радиус срабатывания рассказа при навигации, м (0 - по умолчанию для способа передвижения)
+	TriggerRadius int       `gorm:"not null;default:0" json:"trigger_radius,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// Видимость POI
+const (
+	POIVisibilityPublic  = "public"
+	POIVisibilityPrivate = "private"
+)
+
 // TableName overrides the default table name (optional, pois is default)
 // func (POI) TableName() string {
 // 	return "pois"
@@ -42,31 +53,66 @@ type Route struct {
 	Waypoints         []Waypoint     `gorm:"foreignKey:RouteID"`
 	Epochs            pq.StringArray `gorm:"type:text[]"`
 	Categories        pq.StringArray `gorm:"type:text[]"`
-	CreatedAt         time.Time
+	StartLat          float64
+	StartLon          float64
+	EndLat            *float64 // финиш маршрута (nil - заканчивается на последней точке)
+	EndLon            *float64
+	RoundTrip         bool        `gorm:"default:false"`              // возврат в точку старта
+	TransportMode     string      `gorm:"default:walking"`            // walking, cycling, public_transport, car
+	Geometry          [][]float64 `gorm:"type:jsonb;serializer:json"` // линия маршрута, пары [lon, lat]
+	UserID            *uuid.UUID  `gorm:"type:uuid;index"`            // автор маршрута (nil - создан по API-ключу)
+	APIKeyID          *uuid.UUID  `gorm:"type:uuid;index"`            // API-ключ, которым создан маршрут
+	AudioKey          string      // объединенное аудио в хранилище (пусто - еще не собрано)
+	FreeRoam          bool        `gorm:"default:false"` // свободная прогулка: точки добавляются по мере движения
+	// Последний отданный HLS-плейлист: адреса сегментов и номер первого из них (EXT-X-MEDIA-SEQUENCE)
+	PlaylistSegments pq.StringArray `gorm:"type:text[]"`
+	PlaylistSequence int            `gorm:"default:0"`
+	CreatedAt        time.Time
 }
 
 // Waypoint - точка на маршруте
 type Waypoint struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
-	RouteID   uuid.UUID `gorm:"type:uuid;not null;index"`
-	POIID     uuid.UUID `gorm:"type:uuid;not null"`
-	POI       POI       `gorm:"foreignKey:POIID"`
-	Order     int       `gorm:"not null"`
-	Content   *Content  `gorm:"foreignKey:WaypointID"`
-	CreatedAt time.Time
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	RouteID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	POIID       uuid.UUID `gorm:"type:uuid;not null"`
+	POI         POI       `gorm:"foreignKey:POIID"`
+	Order       int       `gorm:"not null"`
+	LegDuration int       // время в пути от предыдущей точки (или старта), секунды
+	Content     *Content  `gorm:"foreignKey:WaypointID"`
+	CreatedAt   time.Time
 }
 
+// Статусы контента в редакционном процессе
+const (
+	ContentStatusDraft         = "draft" // без аудио: текст отклонен проверкой фактов или генерация не удалась
+	ContentStatusPendingReview = "pending_review"
+	ContentStatusApproved      = "approved"
+	ContentStatusRejected      = "rejected"
+)
+
 // Content - контент для точки (текст + аудио)
 type Content struct {
 	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
 	WaypointID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex"`
 	Text       string    `gorm:"type:text;not null"`
 	AudioURL   string
-	AudioPath  string
+	AudioKey   string         // ключ объекта в хранилище аудио (services.AudioStore)
 	Duration   int            // секунды
 	Photos     pq.StringArray `gorm:"type:text[]"`
+	Sources    pq.StringArray `gorm:"type:text[]"` // URL источников, использованных при генерации
 	Generated  bool           `gorm:"default:false"`
-	CreatedAt  time.Time
+	// Длительность рассказа, под которую сгенерирован текст, секунды
+	NarrationSeconds int
+	// Проверка фактов: passed, flagged, rejected (пусто - не проводилась)
+	FactCheckVerdict string         `gorm:"index"`
+	FactCheckIssues  pq.StringArray `gorm:"type:text[]"`
+	// Редакционная проверка
+	Status        string `gorm:"index;default:pending_review"`
+	ReviewComment string `gorm:"type:text"`
+	ReviewedBy    string
+	ReviewedAt    *time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
 }
 
 // RouteRequest - запрос на создание маршрута
@@ -77,18 +123,131 @@ type RouteRequest struct {
 	Interests       []string `json:"interests"`
 	MaxWaypoints    int      `json:"max_waypoints"`
 	// Конкретные места для маршрута (опционально)
-	POIIDs     []string    `json:"poi_ids,omitempty"`     // UUID мест из базы
-	CustomPOIs []CustomPOI `json:"custom_pois,omitempty"` // Свои места с координатами
+	POIIDs     []string    `json:"poi_ids,omitempty"`                    // UUID мест из базы
+	CustomPOIs []CustomPOI `json:"custom_pois,omitempty" binding:"dive"` // Свои места с координатами
+	// Дополнить обязательные места автоподбором на оставшееся время
+	FillRemaining bool `json:"fill_remaining,omitempty"`
+	// Упорядочить обязательные места по близости; по умолчанию порядок как в запросе:
+	// сначала poi_ids, затем custom_pois
+	OptimizeOrder bool `json:"optimize_order,omitempty"`
+	// Точка финиша (отель, метро, ресторан); без нее маршрут заканчивается на последнем месте
+	EndPoint *Point `json:"end_point,omitempty"`
+	// Вернуться в точку старта (несовместимо с end_point)
+	RoundTrip bool `json:"round_trip,omitempty"`
+	// Способ передвижения: walking (по умолчанию), cycling, public_transport, car
+	TransportMode string `json:"transport_mode,omitempty" binding:"omitempty,oneof=walking cycling public_transport car"`
 }
 
 // CustomPOI - пользовательское место для маршрута
 type CustomPOI struct {
-	Name        string  `json:"name" binding:"required"`
-	Description string  `json:"description"`
+	Name        string  `json:"name" binding:"required,max=200"`
+	Description string  `json:"description" binding:"max=2000"`
 	Latitude    float64 `json:"latitude" binding:"required"`
 	Longitude   float64 `json:"longitude" binding:"required"`
 	Epoch       string  `json:"epoch,omitempty"`
 	Category    string  `json:"category,omitempty"`
+	// Радиус срабатывания рассказа, м (по умолчанию - по способу передвижения)
+	TriggerRadius int `json:"trigger_radius,omitempty" binding:"omitempty,min=5,max=1000"`
+}
+
+// RouteImportRequest - параметры импорта маршрута из файла (поля multipart-формы рядом с file)
+type RouteImportRequest struct {
+	// Радиус сопоставления с местами каталога, метры (по умолчанию 50)
+	MatchRadius float64 `form:"match_radius" binding:"omitempty,min=0,max=500"`
+	// Способ передвижения: walking (по умолчанию), cycling, public_transport, car
+	TransportMode string `form:"transport_mode" binding:"omitempty,oneof=walking cycling public_transport car"`
+}
+
+// RouteImportResponse - импортированный маршрут и то, как сопоставлены места из файла
+type RouteImportResponse struct {
+	RouteResponse
+	Format   string          `json:"format"`
+	Imported []ImportedPlace `json:"imported"`
+}
+
+// ImportedPlace - место из файла: найдено в каталоге или создано как пользовательское
+type ImportedPlace struct {
+	Name          string  `json:"name"`
+	POIID         string  `json:"poi_id"`
+	Matched       bool    `json:"matched"`                  // совпало с местом каталога
+	MatchDistance float64 `json:"match_distance,omitempty"` // расстояние до места каталога, метры
+	Duplicate     bool    `json:"duplicate,omitempty"`      // повтор уже импортированного места, в маршрут не попал
+}
+
+// RoamRequest - запрос мест рядом в режиме свободной прогулки
+type RoamRequest struct {
+	Location Point    `json:"location" binding:"required"`
+	Heading  *float64 `json:"heading,omitempty" binding:"omitempty,min=0,max=360"` // курс, градусы от севера
+	// Радиус поиска, метры (по умолчанию - 6 минут пути выбранным способом)
+	Radius    float64  `json:"radius,omitempty" binding:"omitempty,min=50,max=5000"`
+	Epochs    []string `json:"epochs,omitempty"`
+	Interests []string `json:"interests,omitempty"`
+	// Места (POI ID), рассказ о которых уже прослушан
+	RecentlyPlayed []string `json:"recently_played,omitempty"`
+	Limit          int      `json:"limit,omitempty" binding:"omitempty,min=1,max=10"` // по умолчанию 3
+	// Прогулка из предыдущего ответа: новые точки добавляются в нее
+	RoamID        string `json:"roam_id,omitempty"`
+	TransportMode string `json:"transport_mode,omitempty" binding:"omitempty,oneof=walking cycling public_transport car"`
+}
+
+// RoamResponse - ближайшие непрослушанные места с готовым аудио
+type RoamResponse struct {
+	RoamID     string    `json:"roam_id,omitempty"`
+	POIs       []RoamPOI `json:"pois"`
+	Generating []string  `json:"generating"` // места (POI ID), рассказ о которых готовится - повторите запрос позже
+}
+
+// RoamPOI - место рядом с готовым рассказом
+type RoamPOI struct {
+	POIID           string   `json:"poi_id"`
+	WaypointID      string   `json:"waypoint_id"` // точка, чей рассказ звучит (может быть с другого маршрута)
+	Name            string   `json:"name"`
+	Epoch           string   `json:"epoch"`
+	Category        string   `json:"category"`
+	Coordinates     Point    `json:"coordinates"`
+	Distance        float64  `json:"distance"`                   // метры
+	Bearing         float64  `json:"bearing"`                    // азимут на место, градусы
+	RelativeBearing *float64 `json:"relative_bearing,omitempty"` // поворот от курса: плюс - направо
+	Text            string   `json:"text"`
+	AudioURL        string   `json:"audio_url"`
+	DurationSeconds int      `json:"duration_seconds"`
+}
+
+// NavigationRequest - текущее положение пользователя на маршруте
+type NavigationRequest struct {
+	Location Point    `json:"location" binding:"required"`
+	Heading  *float64 `json:"heading,omitempty" binding:"omitempty,min=0,max=360"` // курс, градусы от севера
+	Accuracy float64  `json:"accuracy,omitempty" binding:"omitempty,min=0"`        // точность GPS, метры
+	// Точки, рассказ о которых уже прослушан
+	Visited []string `json:"visited,omitempty"`
+}
+
+// NavigationResponse - состояние навигации: какую точку играть сейчас и куда идти дальше
+type NavigationResponse struct {
+	RouteID           string              `json:"route_id"`
+	OffRoute          bool                `json:"off_route"`
+	DistanceFromRoute float64             `json:"distance_from_route"` // до линии маршрута, метры
+	NearestRoutePoint *Point              `json:"nearest_route_point"` // куда вернуться на маршрут
+	Progress          float64             `json:"progress"`            // пройденная доля маршрута, 0-1
+	RemainingDistance float64             `json:"remaining_distance"`  // до конца маршрута, метры
+	Active            *NavigationWaypoint `json:"active"`              // пользователь в радиусе срабатывания - играть рассказ
+	Next              *NavigationWaypoint `json:"next"`                // следующая непрослушанная точка
+	Finished          bool                `json:"finished"`            // все точки прослушаны
+}
+
+// NavigationWaypoint - точка маршрута относительно пользователя
+type NavigationWaypoint struct {
+	WaypointID      string   `json:"waypoint_id"`
+	Order           int      `json:"order"`
+	Name            string   `json:"name"`
+	Coordinates     Point    `json:"coordinates"`
+	Distance        float64  `json:"distance"`                   // метры
+	ETASeconds      int      `json:"eta_seconds"`                // время в пути
+	Bearing         float64  `json:"bearing"`                    // азимут на точку, градусы
+	RelativeBearing *float64 `json:"relative_bearing,omitempty"` // поворот от курса: плюс - направо
+	TriggerRadius   float64  `json:"trigger_radius"`             // метры
+	InsideTrigger   bool     `json:"inside_trigger"`
+	AudioURL        string   `json:"audio_url,omitempty"` // пусто - аудио еще не готово
 }
 
 // Point - географическая точка
@@ -104,6 +263,11 @@ type RouteResponse struct {
 	TotalDistance     float64           `json:"total_distance"`
 	EstimatedDuration int               `json:"estimated_duration"`
 	Waypoints         []WaypointDetails `json:"waypoints"`
+	StartPoint        *Point            `json:"start_point,omitempty"`
+	EndPoint          *Point            `json:"end_point,omitempty"`
+	RoundTrip         bool              `json:"round_trip,omitempty"`
+	TransportMode     string            `json:"transport_mode"`
+	Geometry          [][]float64       `json:"geometry,omitempty"`
 }
 
 // WaypointDetails - детали точки маршрута
@@ -115,6 +279,7 @@ type WaypointDetails struct {
 	Epoch       string          `json:"epoch"`
 	Category    string          `json:"category"`
 	Order       int             `json:"order"`
+	LegDuration int             `json:"leg_duration_seconds,omitempty"` // время в пути от предыдущей точки
 	Content     *ContentDetails `json:"content,omitempty"`
 }
 
@@ -124,4 +289,357 @@ type ContentDetails struct {
 	AudioURL        string   `json:"audio_url,omitempty"`
 	DurationSeconds int      `json:"duration_seconds"`
 	Photos          []string `json:"photos"`
+	Sources         []string `json:"sources,omitempty"`
+}
+
+// ContentReview - контент для редактора
+type ContentReview struct {
+	ID               string     `json:"id"`
+	WaypointID       string     `json:"waypoint_id"`
+	RouteID          string     `json:"route_id,omitempty"`
+	POIID            string     `json:"poi_id,omitempty"`
+	POIName          string     `json:"poi_name,omitempty"`
+	Text             string     `json:"text"`
+	AudioURL         string     `json:"audio_url,omitempty"`
+	Status           string     `json:"status"`
+	FactCheckVerdict string     `json:"fact_check_verdict,omitempty"`
+	FactCheckIssues  []string   `json:"fact_check_issues,omitempty"`
+	Sources          []string   `json:"sources,omitempty"`
+	ReviewComment    string     `json:"review_comment,omitempty"`
+	ReviewedBy       string     `json:"reviewed_by,omitempty"`
+	ReviewedAt       *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// ContentReviewList - страница контента для редактора
+type ContentReviewList struct {
+	Items []ContentReview `json:"items"`
+	Total int64           `json:"total"`
+}
+
+// ContentEditRequest - правка текста редактором (редактор - аутентифицированный клиент)
+type ContentEditRequest struct {
+	Text string `json:"text" binding:"required"`
+}
+
+// ContentDecisionRequest - решение редактора (одобрить / отклонить)
+type ContentDecisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+// POIListQuery - параметры списка мест (GET /api/pois).
+// Фильтры-списки можно повторять (?epoch=soviet&epoch=modern) или перечислять через запятую.
+type POIListQuery struct {
+	Epochs        []string `form:"epoch"`
+	Categories    []string `form:"category"`
+	Styles        []string `form:"style"`
+	Architects    []string `form:"architect"` // поиск по части имени
+	YearFrom      int      `form:"year_from"`
+	YearTo        int      `form:"year_to"`
+	MinImportance int      `form:"min_importance" binding:"omitempty,min=1,max=10"`
+	BBox          string   `form:"bbox"` // minLon,minLat,maxLon,maxLat
+	Lat           *float64 `form:"lat"`
+	Lon           *float64 `form:"lon"`
+	Radius        float64  `form:"radius" binding:"omitempty,gt=0"` // метры, вместе с lat/lon
+	Sort          string   `form:"sort" binding:"omitempty,oneof=importance distance name year"`
+	Order         string   `form:"order" binding:"omitempty,oneof=asc desc"`
+	Limit         int      `form:"limit" binding:"omitempty,min=1,max=200"`
+	Cursor        string   `form:"cursor"`
+}
+
+// POIList - страница списка мест
+type POIList struct {
+	Items      []POI  `json:"items"`
+	Total      int64  `json:"total"`                 // всего мест по фильтрам
+	NextCursor string `json:"next_cursor,omitempty"` // пусто - последняя страница
+}
+
+// POISearchQuery - параметры полнотекстового поиска мест (GET /api/pois/search)
+type POISearchQuery struct {
+	Query      string   `form:"q" binding:"required,max=200"`
+	Epochs     []string `form:"epoch"`
+	Categories []string `form:"category"`
+	Limit      int      `form:"limit" binding:"omitempty,min=1,max=50"`
+	Offset     int      `form:"offset" binding:"omitempty,min=0"`
+}
+
+// POISearchResult - найденное место с релевантностью и подсветкой совпадений.
+// В подсветке совпадения обернуты в <mark>, остальной текст экранирован.
+type POISearchResult struct {
+	POI           POI     `json:"poi"`
+	Score         float64 `json:"score"`
+	NameHighlight string  `json:"name_highlight"`
+	Snippet       string  `json:"snippet,omitempty"` // фрагмент описания
+}
+
+// POISearchList - страница результатов поиска
+type POISearchList struct {
+	Items []POISearchResult `json:"items"`
+	Total int64             `json:"total"`
+}
+
+// POIAutocompleteQuery - параметры подсказок по префиксу названия
+type POIAutocompleteQuery struct {
+	Query string `form:"q" binding:"required,max=100"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=20"`
+}
+
+// POIAutocompleteItem - облегченная подсказка для поисковой строки
+type POIAutocompleteItem struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Epoch    string    `json:"epoch,omitempty"`
+	Category string    `json:"category,omitempty"`
+}
+
+// POIPromoteRequest - перенос пользовательского места в общий каталог
+type POIPromoteRequest struct {
+	Importance int    `json:"importance" binding:"omitempty,min=1,max=10"`
+	Epoch      string `json:"epoch"`
+	Category   string `json:"category"`
+}
+
+// POITriggerRadiusRequest - радиус срабатывания рассказа о месте
+type POITriggerRadiusRequest struct {
+	TriggerRadius int `json:"trigger_radius" binding:"min=0,max=1000"` // 0 - по умолчанию для способа передвижения
+}
+
+// WaypointInsertRequest - добавление точки в маршрут
+type WaypointInsertRequest struct {
+	POIID     string     `json:"poi_id,omitempty"`     // место из каталога
+	CustomPOI *CustomPOI `json:"custom_poi,omitempty"` // или свое место
+	Position  int        `json:"position,omitempty"`   // порядковый номер (с 1), по умолчанию - в конец
+}
+
+// WaypointReplaceRequest - замена места в точке маршрута
+type WaypointReplaceRequest struct {
+	POIID     string     `json:"poi_id,omitempty"`
+	CustomPOI *CustomPOI `json:"custom_poi,omitempty"`
+}
+
+// WaypointReorderRequest - новый порядок точек маршрута
+type WaypointReorderRequest struct {
+	WaypointIDs []string `json:"waypoint_ids" binding:"required,min=1"`
+}
+
+// Права доступа API-ключей и токенов
+const (
+	ScopeRoutesGenerate = "routes:generate" // генерация и редактирование маршрутов
+	ScopePOIsWrite      = "pois:write"      // изменение каталога мест
+	ScopeAdmin          = "admin"           // администрирование, включает все права
+)
+
+// APIKey - ключ доступа клиента (партнера, мобильного приложения).
+// Сам ключ не хранится: только SHA-256 и короткий префикс для поиска в списке.
+type APIKey struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Name       string         `gorm:"not null"`
+	Prefix     string         `gorm:"index;not null"`
+	KeyHash    string         `gorm:"uniqueIndex;not null"`
+	Scopes     pq.StringArray `gorm:"type:text[]"`
+	CreatedBy  string
+	ExpiresAt  *time.Time
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// APIKeyCreateRequest - выпуск API-ключа
+type APIKeyCreateRequest struct {
+	Name          string   `json:"name" binding:"required,max=200"`
+	Scopes        []string `json:"scopes" binding:"required,min=1,dive,oneof=routes:generate pois:write admin"`
+	ExpiresInDays int      `json:"expires_in_days,omitempty" binding:"omitempty,min=1,max=3650"` // без срока - бессрочный
+}
+
+// APIKeyResponse - API-ключ без секрета
+type APIKeyResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedBy  string     `json:"created_by,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// APIKeyCreated - выпущенный ключ; секрет показывается только один раз
+type APIKeyCreated struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+// StaleAudio - замененная версия объединенного аудио маршрута; объект удалит фоновая очистка,
+// когда его перестанут дослушивать
+type StaleAudio struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Key       string    `gorm:"not null;uniqueIndex"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// Периоды квот
+const (
+	QuotaPeriodDay   = "day"
+	QuotaPeriodMonth = "month"
+)
+
+// QuotaUsage - расход квоты клиента за период: сгенерированные точки и озвученные символы
+type QuotaUsage struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Client      string    `gorm:"not null;uniqueIndex:idx_quota_usage_period"` // key:<id> или user:<sub>
+	Period      string    `gorm:"not null;uniqueIndex:idx_quota_usage_period"`
+	PeriodStart time.Time `gorm:"not null;uniqueIndex:idx_quota_usage_period"`
+	Waypoints   int64     `gorm:"not null;default:0"`
+	Characters  int64     `gorm:"not null;default:0"`
+	UpdatedAt   time.Time
+}
+
+// QuotaPeriodStatus - остаток квоты за период (limit 0 - без ограничения)
+type QuotaPeriodStatus struct {
+	Period          string    `json:"period"`
+	WaypointsUsed   int64     `json:"waypoints_used"`
+	WaypointsLimit  int64     `json:"waypoints_limit"`
+	CharactersUsed  int64     `json:"characters_used"`
+	CharactersLimit int64     `json:"characters_limit"`
+	ResetAt         time.Time `json:"reset_at"`
+}
+
+// QuotaStatus - квоты клиента на генерацию
+type QuotaStatus struct {
+	Client    string              `json:"client"`
+	Unlimited bool                `json:"unlimited,omitempty"`
+	Periods   []QuotaPeriodStatus `json:"periods"`
+}
+
+// User - пользователь приложения. Учетные записи ведет внешний провайдер,
+// пользователь создается при первом запросе с его JWT.
+type User struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	Subject    string    `gorm:"uniqueIndex;not null"` // sub из JWT
+	Name       string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+}
+
+// Типы избранного
+const (
+	FavoriteKindPOI   = "poi"
+	FavoriteKindRoute = "route"
+)
+
+// Favorite - место или маршрут в избранном пользователя
+type Favorite struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_favorites_target"`
+	Kind      string    `gorm:"not null;uniqueIndex:idx_favorites_target"`
+	TargetID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_favorites_target;index"`
+	CreatedAt time.Time
+}
+
+// Статусы маршрута в истории пользователя
+const (
+	RouteStatusGenerating  = "generating"  // рассказы еще генерируются
+	RouteStatusReady       = "ready"       // аудио готово для всех точек
+	RouteStatusPartial     = "partial"     // часть точек без аудио (отклонены проверками)
+	RouteStatusUnavailable = "unavailable" // ни одна точка не озвучена
+)
+
+// RouteSummary - маршрут в истории и избранном пользователя
+type RouteSummary struct {
+	RouteID           string    `json:"route_id"`
+	Name              string    `json:"name"`
+	TotalDistance     float64   `json:"total_distance"`
+	EstimatedDuration int       `json:"estimated_duration"`
+	TransportMode     string    `json:"transport_mode"`
+	Status            string    `json:"status"`
+	WaypointsTotal    int       `json:"waypoints_total"`
+	AudioReady        int       `json:"audio_ready"`
+	Favorite          bool      `json:"favorite"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// RouteHistory - страница истории маршрутов пользователя
+type RouteHistory struct {
+	Items []RouteSummary `json:"items"`
+	Total int64          `json:"total"`
+}
+
+// Favorites - избранное пользователя
+type Favorites struct {
+	POIs   []POI          `json:"pois"`
+	Routes []RouteSummary `json:"routes"`
+}
+
+// GeoJSONFeatureCollection - набор объектов GeoJSON (RFC 7946), координаты [lon, lat]
+type GeoJSONFeatureCollection struct {
+	Type     string           `json:"type"`
+	Features []GeoJSONFeature `json:"features"`
+}
+
+// GeoJSONFeature - объект GeoJSON
+type GeoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   GeoJSONGeometry        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// GeoJSONGeometry - геометрия Point ([lon, lat]) или LineString ([[lon, lat], ...])
+type GeoJSONGeometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates" swaggertype:"array,number"`
+}
+
+// PackageSchemaVersion - версия схемы manifest.json офлайн-пакета.
+// Увеличивается при несовместимых изменениях; приложение проверяет ее перед разбором.
+const PackageSchemaVersion = 1
+
+// PackageManifest - manifest.json офлайн-пакета маршрута. Пути файлов - относительно корня архива.
+type PackageManifest struct {
+	SchemaVersion int               `json:"schema_version"`
+	GeneratedAt   time.Time         `json:"generated_at"`
+	Route         PackageRoute      `json:"route"`
+	Waypoints     []PackageWaypoint `json:"waypoints"`
+	Audio         string            `json:"audio,omitempty"` // аудиогид целиком
+	GeoJSON       string            `json:"geojson"`         // линия маршрута и точки
+	Files         []PackageFile     `json:"files"`           // все файлы пакета, кроме manifest.json и checksums.sha256
+}
+
+// PackageRoute - маршрут в офлайн-пакете
+type PackageRoute struct {
+	ID                string      `json:"id"`
+	Name              string      `json:"name"`
+	Description       string      `json:"description,omitempty"`
+	TotalDistance     float64     `json:"total_distance"`     // метры
+	EstimatedDuration int         `json:"estimated_duration"` // минуты
+	TransportMode     string      `json:"transport_mode"`
+	RoundTrip         bool        `json:"round_trip"`
+	StartPoint        *Point      `json:"start_point,omitempty"`
+	EndPoint          *Point      `json:"end_point,omitempty"`
+	Geometry          [][]float64 `json:"geometry,omitempty"` // пары [lon, lat]
+}
+
+// PackageWaypoint - точка маршрута в офлайн-пакете
+type PackageWaypoint struct {
+	ID              string   `json:"id"`
+	Order           int      `json:"order"`
+	Name            string   `json:"name"`
+	Description     string   `json:"description,omitempty"`
+	Coordinates     Point    `json:"coordinates"`
+	Epoch           string   `json:"epoch,omitempty"`
+	Category        string   `json:"category,omitempty"`
+	LegDuration     int      `json:"leg_duration_seconds,omitempty"`
+	Text            string   `json:"text,omitempty"`
+	Audio           string   `json:"audio,omitempty"` // путь к MP3 в архиве; пусто - точка без аудио
+	DurationSeconds int      `json:"duration_seconds,omitempty"`
+	Photos          []string `json:"photos"` // ссылки на фото (в пакет не включаются)
+	Sources         []string `json:"sources,omitempty"`
+}
+
+// PackageFile - файл пакета с контрольной суммой
+type PackageFile struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
 }
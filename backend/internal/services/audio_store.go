@@ -0,0 +1,182 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AudioObject - метаданные аудиофайла в хранилище
+type AudioObject struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// AudioStore - хранилище аудиофайлов. Ключи - относительные пути вида waypoints/<id>/<hash>.mp3,
+// одинаковые для всех реализаций, поэтому в БД хранится ключ, а не путь на диске.
+type AudioStore interface {
+	// Put сохраняет объект; size - длина данных (нужна S3 для запроса без chunked-кодирования)
+	Put(key string, data io.Reader, size int64) error
+	// Get открывает объект на чтение с перемоткой (для Range-запросов);
+	// для отсутствующего объекта возвращает ErrNotFound
+	Get(key string) (io.ReadSeekCloser, *AudioObject, error)
+	// Stat возвращает метаданные объекта или ErrNotFound
+	Stat(key string) (*AudioObject, error)
+	// Delete удаляет объект; отсутствие объекта не считается ошибкой
+	Delete(key string) error
+	// PresignedURL - временная ссылка для скачивания напрямую из хранилища.
+	// Пустая строка - хранилище не выдает ссылок, аудио отдается через API.
+	PresignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// NewAudioStore создает хранилище по AUDIO_STORE: local (по умолчанию, каталог AUDIO_DIR) или s3
+func NewAudioStore() (AudioStore, error) {
+	switch backend := os.Getenv("AUDIO_STORE"); backend {
+	case "", "local":
+		dir := os.Getenv("AUDIO_DIR")
+		if dir == "" {
+			dir = "./audio"
+		}
+		return NewLocalAudioStore(dir)
+	case "s3":
+		return NewS3AudioStore()
+	default:
+		return nil, fmt.Errorf("unknown AUDIO_STORE %q (expected local or s3)", backend)
+	}
+}
+
+// WaypointAudioKey - ключ аудио точки, адресуемый содержимым: новое аудио получает новый ключ,
+// поэтому однажды выданный файл по ключу не меняется и его можно кэшировать бессрочно
+func WaypointAudioKey(waypointID string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return "waypoints/" + waypointID + "/" + hex.EncodeToString(sum[:]) + ".mp3"
+}
+
+// AudioVersion - версия аудио для ETag и параметра ?v=: хэш из ключа
+// (для ключей до перехода на адресацию содержимым - имя файла)
+func AudioVersion(key string) string {
+	return strings.TrimSuffix(path.Base(key), path.Ext(key))
+}
+
+// WaypointAudioURL - ссылка на аудио точки с версией; по ней аудио отдается с бессрочным кэшем
+func WaypointAudioURL(waypointID, key string) string {
+	return fmt.Sprintf("/api/audio/%s?v=%s", waypointID, AudioVersion(key))
+}
+
+// RouteAudioVersion - версия объединенного аудио маршрута: хэш ключей частей по порядку.
+// Ключи частей адресуются содержимым, поэтому версия меняется вместе с любой частью.
+func RouteAudioVersion(partKeys []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(partKeys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// LocalAudioStore хранит аудио в каталоге на диске (одна реплика или общий том)
+type LocalAudioStore struct {
+	dir string
+}
+
+func NewLocalAudioStore(dir string) (*LocalAudioStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audio directory: %w", err)
+	}
+	return &LocalAudioStore{dir: dir}, nil
+}
+
+func (s *LocalAudioStore) Put(key string, data io.Reader, size int64) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create audio directory: %w", err)
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы читатели не видели недописанный файл
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create audio file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write audio file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write audio file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save audio file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalAudioStore) Get(key string) (io.ReadSeekCloser, *AudioObject, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil, fmt.Errorf("%w: audio %s", ErrNotFound, key)
+		}
+		return nil, nil, fmt.Errorf("failed to open audio: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to stat audio: %w", err)
+	}
+
+	return file, &AudioObject{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalAudioStore) Stat(key string) (*AudioObject, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: audio %s", ErrNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to stat audio: %w", err)
+	}
+	return &AudioObject{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *LocalAudioStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove audio: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalAudioStore) PresignedURL(key string, ttl time.Duration) (string, error) {
+	return "", nil
+}
+
+// path переводит ключ в путь внутри каталога хранилища
+func (s *LocalAudioStore) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if key == "" || strings.HasSuffix(key, "/") || clean == "/" {
+		return "", fmt.Errorf("invalid audio key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(clean)), nil
+}
@@ -0,0 +1,264 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyPrefix = "ag_"
+	// Отметка last_used_at обновляется не чаще раза в минуту, чтобы не писать в БД на каждый запрос
+	apiKeyTouchInterval = time.Minute
+)
+
+// Типы субъектов запроса
+const (
+	PrincipalAPIKey    = "api_key"
+	PrincipalUser      = "user"
+	PrincipalBootstrap = "bootstrap"
+)
+
+// Principal - аутентифицированный клиент: API-ключ или пользователь с JWT
+type Principal struct {
+	Kind   string
+	ID     string // ID ключа или subject токена
+	Name   string
+	Scopes []string
+}
+
+// HasScope проверяет право доступа; admin включает все права
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == models.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthService проверяет API-ключи и JWT пользователей, выпускает и отзывает ключи
+type AuthService struct {
+	db           *gorm.DB
+	jwtSecret    []byte
+	jwtIssuer    string
+	jwtAudience  string
+	bootstrapKey string   // ADMIN_API_KEY - ключ администратора для выпуска первых ключей
+	userScopes   []string // права пользователя, если в токене нет claim scope
+}
+
+func NewAuthService(db *gorm.DB) *AuthService {
+	return &AuthService{
+		db:           db,
+		jwtSecret:    []byte(os.Getenv("JWT_SECRET")),
+		jwtIssuer:    os.Getenv("JWT_ISSUER"),
+		jwtAudience:  os.Getenv("JWT_AUDIENCE"),
+		bootstrapKey: os.Getenv("ADMIN_API_KEY"),
+		userScopes:   []string{models.ScopeRoutesGenerate},
+	}
+}
+
+// IsAPIKey отличает API-ключ от JWT в заголовке Authorization
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, apiKeyPrefix)
+}
+
+// IssueKey создает API-ключ и возвращает его секрет (в БД остается только хеш)
+func (s *AuthService) IssueKey(name string, scopes []string, expiresAt *time.Time, createdBy string) (*models.APIKey, string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	raw := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	key := &models.APIKey{
+		Name:      name,
+		Prefix:    raw[:len(apiKeyPrefix)+8],
+		KeyHash:   hashAPIKey(raw),
+		Scopes:    scopes,
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.Create(key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to save API key: %w", err)
+	}
+
+	return key, raw, nil
+}
+
+// ListKeys возвращает все ключи, новые сверху
+func (s *AuthService) ListKeys() ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to query API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeKey отзывает ключ; повторный отзыв не меняет дату
+func (s *AuthService) RevokeKey(id uuid.UUID) (*models.APIKey, error) {
+	var key models.APIKey
+	if err := s.db.First(&key, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+
+	if key.RevokedAt == nil {
+		now := time.Now()
+		if err := s.db.Model(&key).Update("revoked_at", now).Error; err != nil {
+			return nil, fmt.Errorf("failed to revoke API key: %w", err)
+		}
+		key.RevokedAt = &now
+	}
+
+	return &key, nil
+}
+
+// AuthenticateKey проверяет API-ключ
+func (s *AuthService) AuthenticateKey(raw string) (*Principal, error) {
+	if s.bootstrapKey != "" && subtle.ConstantTimeCompare([]byte(raw), []byte(s.bootstrapKey)) == 1 {
+		return &Principal{Kind: PrincipalBootstrap, ID: "bootstrap", Name: "bootstrap", Scopes: []string{models.ScopeAdmin}}, nil
+	}
+
+	var key models.APIKey
+	if err := s.db.Where("key_hash = ?", hashAPIKey(raw)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: unknown API key", ErrUnauthorized)
+		}
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: API key revoked", ErrUnauthorized)
+	}
+	if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+		return nil, fmt.Errorf("%w: API key expired", ErrUnauthorized)
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		s.db.Model(&key).UpdateColumn("last_used_at", now)
+	}
+
+	return &Principal{Kind: PrincipalAPIKey, ID: key.ID.String(), Name: key.Name, Scopes: key.Scopes}, nil
+}
+
+// jwtClaims - поддерживаемые поля токена пользователя.
+// scope - права через пробел (RFC 8693); без него пользователь получает права по умолчанию.
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Name      string      `json:"name"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt int64       `json:"exp"`
+	NotBefore int64       `json:"nbf"`
+	Scope     string      `json:"scope"`
+}
+
+// jwtAudience - claim aud: одна строка или массив строк (RFC 7519, 4.1.3)
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a jwtAudience) contains(audience string) bool {
+	for _, aud := range a {
+		if aud == audience {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthenticateToken проверяет JWT пользователя (HS256, секрет JWT_SECRET;
+// если заданы JWT_ISSUER и JWT_AUDIENCE - еще iss и aud)
+func (s *AuthService) AuthenticateToken(token string) (*Principal, error) {
+	if len(s.jwtSecret) == 0 {
+		return nil, fmt.Errorf("%w: user tokens are not configured", ErrUnauthorized)
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrUnauthorized)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported token", ErrUnauthorized)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, s.sign(parts[0]+"."+parts[1])) {
+		return nil, fmt.Errorf("%w: invalid token signature", ErrUnauthorized)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed token claims", ErrUnauthorized)
+	}
+
+	now := time.Now().Unix()
+	switch {
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: token has no subject", ErrUnauthorized)
+	case claims.ExpiresAt == 0 || now >= claims.ExpiresAt:
+		return nil, fmt.Errorf("%w: token expired", ErrUnauthorized)
+	case claims.NotBefore != 0 && now < claims.NotBefore:
+		return nil, fmt.Errorf("%w: token not yet valid", ErrUnauthorized)
+	case s.jwtIssuer != "" && claims.Issuer != s.jwtIssuer:
+		return nil, fmt.Errorf("%w: unexpected token issuer", ErrUnauthorized)
+	case s.jwtAudience != "" && !claims.Audience.contains(s.jwtAudience):
+		return nil, fmt.Errorf("%w: unexpected token audience", ErrUnauthorized)
+	}
+
+	scopes := s.userScopes
+	if claims.Scope != "" {
+		scopes = strings.Fields(claims.Scope)
+	}
+
+	return &Principal{Kind: PrincipalUser, ID: claims.Subject, Name: claims.Name, Scopes: scopes}, nil
+}
+
+func (s *AuthService) sign(data string) []byte {
+	mac := hmac.New(sha256.New, s.jwtSecret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func hashAPIKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
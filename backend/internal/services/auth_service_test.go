@@ -0,0 +1,342 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+const testJWTSecret = "test-secret"
+
+// signTestJWT собирает токен из заголовка и claims, подписывая его HS256 секретом secret
+func signTestJWT(t *testing.T, secret string, header, claims interface{}) string {
+	t.Helper()
+	encode := func(v interface{}) string {
+		if raw, ok := v.(string); ok {
+			return base64.RawURLEncoding.EncodeToString([]byte(raw))
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+
+	signed := encode(header) + "." + encode(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	now := time.Now().Unix()
+	hs256 := map[string]string{"alg": "HS256", "typ": "JWT"}
+	claims := func(extra map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{"sub": "user-1", "name": "Анна", "exp": now + 3600}
+		for k, v := range extra {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	valid := signTestJWT(t, testJWTSecret, hs256, claims(nil))
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name       string
+		issuer     string
+		audience   string
+		token      string
+		wantErr    string
+		wantScopes []string
+	}{
+		{name: "valid", token: valid, wantScopes: []string{models.ScopeRoutesGenerate}},
+		{name: "scope claim", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"scope": "routes:generate pois:write"})),
+			wantScopes: []string{models.ScopeRoutesGenerate, models.ScopePOIsWrite}},
+		{name: "not yet valid in the past", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"nbf": now - 60})),
+			wantScopes: []string{models.ScopeRoutesGenerate}},
+
+		// Подпись
+		{name: "other secret", token: signTestJWT(t, "other-secret", hs256, claims(nil)), wantErr: "invalid token signature"},
+		{name: "tampered claims", token: parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"admin","exp":9999999999,"scope":"admin"}`)) + "." + parts[2],
+			wantErr: "invalid token signature"},
+		{name: "empty signature", token: parts[0] + "." + parts[1] + ".", wantErr: "invalid token signature"},
+		{name: "signature not base64", token: parts[0] + "." + parts[1] + ".!!!", wantErr: "invalid token signature"},
+
+		// Алгоритм
+		{name: "alg none", token: signTestJWT(t, testJWTSecret, map[string]string{"alg": "none"}, claims(nil)), wantErr: "unsupported token"},
+		{name: "alg none unsigned", token: base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + ".", wantErr: "unsupported token"},
+		{name: "alg HS512", token: signTestJWT(t, testJWTSecret, map[string]string{"alg": "HS512"}, claims(nil)), wantErr: "unsupported token"},
+		{name: "alg RS256", token: signTestJWT(t, testJWTSecret, map[string]string{"alg": "RS256"}, claims(nil)), wantErr: "unsupported token"},
+		{name: "alg lowercase", token: signTestJWT(t, testJWTSecret, map[string]string{"alg": "hs256"}, claims(nil)), wantErr: "unsupported token"},
+		{name: "alg missing", token: signTestJWT(t, testJWTSecret, map[string]string{"typ": "JWT"}, claims(nil)), wantErr: "unsupported token"},
+
+		// Срок действия
+		{name: "expired", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"exp": now - 1})), wantErr: "token expired"},
+		{name: "no exp", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"exp": nil})), wantErr: "token expired"},
+		{name: "nbf in the future", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"nbf": now + 600})), wantErr: "token not yet valid"},
+
+		// Издатель и аудитория
+		{name: "issuer matches", issuer: "https://id.example", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"iss": "https://id.example"})),
+			wantScopes: []string{models.ScopeRoutesGenerate}},
+		{name: "wrong issuer", issuer: "https://id.example", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"iss": "https://evil.example"})),
+			wantErr: "unexpected token issuer"},
+		{name: "missing issuer", issuer: "https://id.example", token: valid, wantErr: "unexpected token issuer"},
+		{name: "audience string", audience: "audioguid", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"aud": "audioguid"})),
+			wantScopes: []string{models.ScopeRoutesGenerate}},
+		{name: "audience array", audience: "audioguid", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"aud": []string{"maps", "audioguid"}})),
+			wantScopes: []string{models.ScopeRoutesGenerate}},
+		{name: "wrong audience", audience: "audioguid", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"aud": []string{"maps"}})),
+			wantErr: "unexpected token audience"},
+		{name: "missing audience", audience: "audioguid", token: valid, wantErr: "unexpected token audience"},
+		{name: "audience not checked when not configured", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"aud": "maps"})),
+			wantScopes: []string{models.ScopeRoutesGenerate}},
+
+		// Формат
+		{name: "empty", token: "", wantErr: "malformed token"},
+		{name: "two segments", token: parts[0] + "." + parts[1], wantErr: "malformed token"},
+		{name: "four segments", token: valid + ".x", wantErr: "malformed token"},
+		{name: "header not base64", token: "!!!." + parts[1] + "." + parts[2], wantErr: "unsupported token"},
+		{name: "header not JSON", token: signTestJWT(t, testJWTSecret, "not json", claims(nil)), wantErr: "unsupported token"},
+		{name: "claims not JSON", token: signTestJWT(t, testJWTSecret, hs256, "not json"), wantErr: "malformed token claims"},
+		{name: "exp not a number", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"exp": "tomorrow"})), wantErr: "malformed token claims"},
+		{name: "no subject", token: signTestJWT(t, testJWTSecret, hs256, claims(map[string]interface{}{"sub": nil})), wantErr: "token has no subject"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &AuthService{
+				jwtSecret:   []byte(testJWTSecret),
+				jwtIssuer:   tt.issuer,
+				jwtAudience: tt.audience,
+				userScopes:  []string{models.ScopeRoutesGenerate},
+			}
+
+			principal, err := service.AuthenticateToken(tt.token)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrUnauthorized) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want ErrUnauthorized with %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthenticateToken: %v", err)
+			}
+			if principal.Kind != PrincipalUser || principal.ID != "user-1" || principal.Name != "Анна" {
+				t.Errorf("principal = %+v, want user-1", principal)
+			}
+			if strings.Join(principal.Scopes, " ") != strings.Join(tt.wantScopes, " ") {
+				t.Errorf("scopes = %v, want %v", principal.Scopes, tt.wantScopes)
+			}
+		})
+	}
+}
+
+func TestAuthenticateTokenWithoutSecret(t *testing.T) {
+	service := &AuthService{}
+	token := signTestJWT(t, "", map[string]string{"alg": "HS256"}, map[string]interface{}{"sub": "user-1", "exp": time.Now().Unix() + 60})
+	if _, err := service.AuthenticateToken(token); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("err = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestAuthenticateKey(t *testing.T) {
+	hour := time.Hour
+	ago := func(d time.Duration) *time.Time { at := time.Now().Add(-d); return &at }
+
+	tests := []struct {
+		name      string
+		key       *models.APIKey // nil - ключа нет в БД
+		raw       string
+		wantErr   string
+		wantKind  string
+		wantTouch bool
+	}{
+		{name: "bootstrap key", raw: "bootstrap-secret", wantKind: PrincipalBootstrap},
+		{name: "valid key", key: &models.APIKey{Name: "partner", Scopes: []string{models.ScopeRoutesGenerate}},
+			raw: "ag_valid", wantKind: PrincipalAPIKey, wantTouch: true},
+		{name: "valid key used recently", key: &models.APIKey{Name: "partner", Scopes: []string{models.ScopeRoutesGenerate}, LastUsedAt: ago(time.Second)},
+			raw: "ag_recent", wantKind: PrincipalAPIKey},
+		{name: "expires later", key: &models.APIKey{Name: "partner", Scopes: []string{models.ScopeRoutesGenerate}, ExpiresAt: ago(-hour)},
+			raw: "ag_later", wantKind: PrincipalAPIKey, wantTouch: true},
+		{name: "unknown key", raw: "ag_unknown", wantErr: "unknown API key"},
+		{name: "revoked key", key: &models.APIKey{Name: "partner", RevokedAt: ago(hour)}, raw: "ag_revoked", wantErr: "API key revoked"},
+		{name: "revoked key with future expiry", key: &models.APIKey{Name: "partner", RevokedAt: ago(hour), ExpiresAt: ago(-hour)},
+			raw: "ag_revoked_later", wantErr: "API key revoked"},
+		{name: "expired key", key: &models.APIKey{Name: "partner", ExpiresAt: ago(hour)}, raw: "ag_expired", wantErr: "API key expired"},
+		{name: "bootstrap key mismatch", raw: "bootstrap-secreT", wantErr: "unknown API key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeAPIKeyStore{keys: map[string]*models.APIKey{}}
+			if tt.key != nil {
+				tt.key.ID = uuid.New()
+				tt.key.KeyHash = hashAPIKey(tt.raw)
+				store.keys[tt.key.KeyHash] = tt.key
+			}
+			service := &AuthService{db: openFakeAPIKeyDB(t, store), bootstrapKey: "bootstrap-secret"}
+
+			principal, err := service.AuthenticateKey(tt.raw)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrUnauthorized) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want ErrUnauthorized with %q", err, tt.wantErr)
+				}
+				if store.touched != 0 {
+					t.Errorf("rejected key touched %d times", store.touched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("AuthenticateKey: %v", err)
+			}
+			if principal.Kind != tt.wantKind {
+				t.Errorf("kind = %q, want %q", principal.Kind, tt.wantKind)
+			}
+			if tt.key != nil && (principal.ID != tt.key.ID.String() || principal.Name != tt.key.Name ||
+				strings.Join(principal.Scopes, " ") != strings.Join(tt.key.Scopes, " ")) {
+				t.Errorf("principal = %+v, want key %+v", principal, tt.key)
+			}
+			if got := store.touched > 0; got != tt.wantTouch {
+				t.Errorf("last_used_at updated = %v, want %v", got, tt.wantTouch)
+			}
+		})
+	}
+}
+
+// Минимальный драйвер database/sql для AuthenticateKey: отвечает на поиск ключа по хешу
+// и считает обновления last_used_at
+
+type fakeAPIKeyStore struct {
+	keys    map[string]*models.APIKey // по key_hash
+	touched int
+}
+
+var (
+	fakeAPIKeyStoresMu sync.Mutex
+	fakeAPIKeyStores   = map[string]*fakeAPIKeyStore{}
+)
+
+func init() {
+	sql.Register("fake_api_keys", fakeAPIKeyDriver{})
+}
+
+func openFakeAPIKeyDB(t *testing.T, store *fakeAPIKeyStore) *gorm.DB {
+	t.Helper()
+	fakeAPIKeyStoresMu.Lock()
+	fakeAPIKeyStores[t.Name()] = store
+	fakeAPIKeyStoresMu.Unlock()
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DriverName: "fake_api_keys", DSN: t.Name()}),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+type fakeAPIKeyDriver struct{}
+
+func (fakeAPIKeyDriver) Open(name string) (driver.Conn, error) {
+	fakeAPIKeyStoresMu.Lock()
+	defer fakeAPIKeyStoresMu.Unlock()
+	store, ok := fakeAPIKeyStores[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown fake database %q", name)
+	}
+	return &fakeAPIKeyConn{store: store}, nil
+}
+
+type fakeAPIKeyConn struct {
+	store *fakeAPIKeyStore
+}
+
+func (c *fakeAPIKeyConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeAPIKeyStmt{store: c.store, query: query}, nil
+}
+
+func (c *fakeAPIKeyConn) Close() error { return nil }
+
+func (c *fakeAPIKeyConn) Begin() (driver.Tx, error) { return fakeAPIKeyTx{}, nil }
+
+type fakeAPIKeyTx struct{}
+
+func (fakeAPIKeyTx) Commit() error   { return nil }
+func (fakeAPIKeyTx) Rollback() error { return nil }
+
+type fakeAPIKeyStmt struct {
+	store *fakeAPIKeyStore
+	query string
+}
+
+func (s *fakeAPIKeyStmt) Close() error  { return nil }
+func (s *fakeAPIKeyStmt) NumInput() int { return -1 }
+
+func (s *fakeAPIKeyStmt) Exec(args []driver.Value) (driver.Result, error) {
+	if strings.HasPrefix(s.query, `UPDATE "api_keys"`) && strings.Contains(s.query, "last_used_at") {
+		s.store.touched++
+		return driver.RowsAffected(1), nil
+	}
+	return nil, fmt.Errorf("unexpected exec %q", s.query)
+}
+
+func (s *fakeAPIKeyStmt) Query(args []driver.Value) (driver.Rows, error) {
+	if !strings.HasPrefix(s.query, `SELECT * FROM "api_keys" WHERE key_hash = $1`) || len(args) == 0 {
+		return nil, fmt.Errorf("unexpected query %q", s.query)
+	}
+
+	rows := &fakeAPIKeyRows{}
+	if key, ok := s.store.keys[fmt.Sprint(args[0])]; ok {
+		scopes := "{" + strings.Join(key.Scopes, ",") + "}"
+		timeValue := func(at *time.Time) driver.Value {
+			if at == nil {
+				return nil
+			}
+			return *at
+		}
+		rows.values = append(rows.values, []driver.Value{
+			key.ID.String(), key.Name, key.Prefix, key.KeyHash, []byte(scopes), key.CreatedBy,
+			timeValue(key.ExpiresAt), timeValue(key.RevokedAt), timeValue(key.LastUsedAt), time.Now(),
+		})
+	}
+	return rows, nil
+}
+
+type fakeAPIKeyRows struct {
+	values [][]driver.Value
+	next   int
+}
+
+func (r *fakeAPIKeyRows) Columns() []string {
+	return []string{"id", "name", "prefix", "key_hash", "scopes", "created_by", "expires_at", "revoked_at", "last_used_at", "created_at"}
+}
+
+func (r *fakeAPIKeyRows) Close() error { return nil }
+
+func (r *fakeAPIKeyRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -8,11 +8,14 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"strings"
+	"strconv"
 
 	"github.com/dimmy-kor/audioguid/internal/models"
 )
 
+// defaultMaxTokens - лимит токенов ответа YandexGPT по умолчанию
+const defaultMaxTokens = 1000
+
 // ContentService генерирует контент через YandexGPT
 type ContentService struct {
 	apiKey     string
@@ -21,10 +24,18 @@ type ContentService struct {
 	searchAPI  string
 	searchUser string
 	searchKey  string
+	searchMode string // always, fallback (только без справки из энциклопедии), off
+	enrichment *EnrichmentService
+	factCheck  *FactCheckService
 	client     *http.Client
 }
 
-func NewContentService() *ContentService {
+func NewContentService(enrichment *EnrichmentService, factCheck *FactCheckService) *ContentService {
+	searchMode := os.Getenv("YANDEX_SEARCH_MODE")
+	if searchMode == "" {
+		searchMode = "always"
+	}
+
 	return &ContentService{
 		apiKey:     os.Getenv("YANDEX_API_KEY"),
 		folderID:   os.Getenv("YANDEX_FOLDER_ID"),
@@ -32,30 +43,90 @@ func NewContentService() *ContentService {
 		searchAPI:  "https://yandex.ru/search/xml",
 		searchUser: os.Getenv("YANDEX_SEARCH_USER"),
 		searchKey:  os.Getenv("YANDEX_SEARCH_KEY"),
+		searchMode: searchMode,
+		enrichment: enrichment,
+		factCheck:  factCheck,
 		client:     &http.Client{},
 	}
 }
 
-// GenerateDescription генерирует описание для места
-func (s *ContentService) GenerateDescription(poi models.POI) (string, error) {
-	// Сначала ищем дополнительную информацию через Yandex Search (опционально)
+// Description - сгенерированный рассказ о месте и источники, на которые он опирается
+type Description struct {
+	Text      string
+	Sources   []string         // URL документов, использованных при генерации
+	FactCheck *FactCheckResult // nil, если проверка фактов выключена
+	Revised   bool             // текст исправлен LLM после проверки фактов
+}
+
+// GenerateDescription генерирует описание для места.
+// narrationSeconds - желаемая длительность рассказа (0 - стандартные 2-3 минуты).
+func (s *ContentService) GenerateDescription(poi models.POI, narrationSeconds int) (*Description, error) {
+	if narrationSeconds <= 0 {
+		narrationSeconds = defaultNarrationSeconds
+	}
+
+	var sources []string
+
+	// Справка из Википедии или локальной базы знаний (опционально)
+	reference := ""
+	if s.enrichment != nil {
+		summary, err := s.enrichment.GetSummary(&poi)
+		if err == nil && summary.Extract != "" {
+			reference = truncateRunes(summary.Extract, 3000)
+			sources = append(sources, summary.URL)
+		}
+	}
+
+	// Ищем дополнительную информацию через Yandex Search (опционально)
 	additionalInfo := ""
-	if s.searchUser != "" && s.searchKey != "" {
-		info, err := s.searchForPOI(poi)
-		if err == nil && info != "" {
-			additionalInfo = info
+	if s.searchUser != "" && s.searchKey != "" && s.shouldSearch(reference) {
+		results, err := s.searchForPOI(poi)
+		if err == nil && len(results) > 0 {
+			var searchSources []string
+			additionalInfo, searchSources = formatSearchResults(results, 3)
+			sources = append(sources, searchSources...)
 		}
 	}
 
 	// Генерируем описание через YandexGPT
-	prompt := s.buildPrompt(poi, additionalInfo)
+	prompt := s.buildPrompt(poi, reference, additionalInfo, narrationSeconds)
+
+	text, err := s.complete(prompt, 0.7, maxTokensFor(narrationSeconds))
+	if err != nil {
+		return nil, err
+	}
 
+	description := &Description{
+		Text:    text,
+		Sources: sources,
+	}
+
+	// Сверяем факты с данными о месте и источниками
+	if s.factCheck != nil && s.factCheck.Enabled() {
+		references := []string{reference, additionalInfo}
+		description.FactCheck = s.factCheck.Check(text, poi, references)
+
+		if s.factCheck.ShouldRevise(description.FactCheck) {
+			revised, err := s.complete(s.buildRevisionPrompt(poi, text, reference, description.FactCheck), 0.3, maxTokensFor(narrationSeconds))
+			if err == nil && revised != "" {
+				description.Text = revised
+				description.FactCheck = s.factCheck.Check(revised, poi, references)
+				description.Revised = true
+			}
+		}
+	}
+
+	return description, nil
+}
+
+// complete отправляет промпт в YandexGPT и возвращает текст ответа
+func (s *ContentService) complete(prompt string, temperature float64, maxTokens int) (string, error) {
 	request := YandexGPTRequest{
 		ModelURI: fmt.Sprintf("gpt://%s/yandexgpt/latest", s.folderID),
 		CompletionOptions: CompletionOptions{
 			Stream:      false,
-			Temperature: 0.7,
-			MaxTokens:   "1000",
+			Temperature: temperature,
+			MaxTokens:   strconv.Itoa(maxTokens),
 		},
 		Messages: []YandexMessage{
 			{
@@ -85,13 +156,12 @@ func (s *ContentService) GenerateDescription(poi models.POI) (string, error) {
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to call YandexGPT API: %w", err)
+		return "", upstreamCallError("YandexGPT", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("YandexGPT API error (status %d): %s", resp.StatusCode, string(body))
+		return "", upstreamResponseError("YandexGPT", resp)
 	}
 
 	var result YandexGPTResponse
@@ -107,7 +177,7 @@ func (s *ContentService) GenerateDescription(poi models.POI) (string, error) {
 }
 
 // searchForPOI ищет дополнительную информацию о месте через Yandex Search API
-func (s *ContentService) searchForPOI(poi models.POI) (string, error) {
+func (s *ContentService) searchForPOI(poi models.POI) ([]SearchResult, error) {
 	// Формируем поисковый запрос
 	query := fmt.Sprintf("%s Москва история", poi.Name)
 
@@ -125,39 +195,40 @@ func (s *ContentService) searchForPOI(poi models.POI) (string, error) {
 
 	req, err := http.NewRequest("GET", searchURL, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, upstreamCallError("Yandex Search", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("search API error: status %d", resp.StatusCode)
+		return nil, upstreamResponseError("Yandex Search", resp)
 	}
 
-	// Читаем XML ответ (базовая обработка)
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	// Извлекаем текстовые фрагменты (упрощенная версия)
-	// В продакшене нужен полноценный XML парсер
-	bodyStr := string(body)
+	return parseSearchResponse(body)
+}
 
-	// Ищем теги <passage> с текстом
-	passages := extractPassages(bodyStr)
-	if len(passages) > 0 {
-		return strings.Join(passages[:min(3, len(passages))], " "), nil
+// shouldSearch решает, нужен ли Yandex Search при уже найденной справке
+func (s *ContentService) shouldSearch(reference string) bool {
+	switch s.searchMode {
+	case "off":
+		return false
+	case "fallback":
+		return reference == ""
+	default:
+		return true
 	}
-
-	return "", nil
 }
 
-func (s *ContentService) buildPrompt(poi models.POI, additionalInfo string) string {
+func (s *ContentService) buildPrompt(poi models.POI, reference, additionalInfo string, narrationSeconds int) string {
 	epochNames := map[string]string{
 		"medieval": "средневековье",
 		"imperial": "имперский период",
@@ -197,14 +268,20 @@ func (s *ContentService) buildPrompt(poi models.POI, additionalInfo string) stri
 		prompt += fmt.Sprintf("\nСтиль: %s", poi.Style)
 	}
 
+	if reference != "" {
+		prompt += fmt.Sprintf("\n\nСправка из энциклопедии:\n%s", reference)
+	}
+
 	if additionalInfo != "" {
 		prompt += fmt.Sprintf("\n\nДополнительная информация из интернета:\n%s", additionalInfo)
 	}
 
-	prompt += `
+	minWords, maxWords := narrationWords(narrationSeconds)
+	prompt += fmt.Sprintf(`
 
 Требования к рассказу:
-- Длина: 2-3 минуты чтения (300-400 слов)
+- Длина: около %d мин чтения (%d-%d слов)`, (narrationSeconds+30)/60, minWords, maxWords)
+	prompt += `
 - Стиль: живой, увлекательный, но точный
 - Включи интересные факты и легенды
 - Без речевых ошибок и анахронизмов
@@ -218,6 +295,34 @@ func (s *ContentService) buildPrompt(poi models.POI, additionalInfo string) stri
 	return prompt
 }
 
+// buildRevisionPrompt просит исправить найденные проверкой фактические ошибки
+func (s *ContentService) buildRevisionPrompt(poi models.POI, text, reference string, check *FactCheckResult) string {
+	prompt := "Исправь фактические ошибки в тексте аудиогида, не меняя стиль и длину.\n\nНайденные расхождения:"
+	for _, issue := range check.Issues {
+		if issue.Severity == FactIssueError {
+			prompt += "\n- " + issue.Message
+		}
+	}
+
+	prompt += fmt.Sprintf("\n\nДостоверные данные о месте:\nНазвание: %s", poi.Name)
+	if poi.YearBuilt > 0 {
+		prompt += fmt.Sprintf("\nГод постройки: %d", poi.YearBuilt)
+	}
+	if poi.Architect != "" {
+		prompt += fmt.Sprintf("\nАрхитектор: %s", poi.Architect)
+	}
+	if poi.Style != "" {
+		prompt += fmt.Sprintf("\nСтиль: %s", poi.Style)
+	}
+	if reference != "" {
+		prompt += fmt.Sprintf("\n\nСправка из энциклопедии:\n%s", reference)
+	}
+
+	prompt += fmt.Sprintf("\n\nТекст:\n%s\n\nВерни только исправленный текст без пояснений.", text)
+
+	return prompt
+}
+
 // Структуры для YandexGPT API
 
 type YandexMessage struct {
@@ -254,43 +359,28 @@ type YandexGPTResponse struct {
 
 // Вспомогательные функции
 
-func extractPassages(xmlContent string) []string {
-	// Упрощенная экстракция текста из XML
-	// В продакшене использовать encoding/xml
-	passages := []string{}
-
-	start := 0
-	for {
-		idx := strings.Index(xmlContent[start:], "<passage>")
-		if idx == -1 {
-			break
-		}
-		start += idx + 9
-
-		end := strings.Index(xmlContent[start:], "</passage>")
-		if end == -1 {
-			break
-		}
-
-		passage := xmlContent[start : start+end]
-		// Убираем HTML теги
-		passage = strings.ReplaceAll(passage, "<hlword>", "")
-		passage = strings.ReplaceAll(passage, "</hlword>", "")
-		passage = strings.TrimSpace(passage)
-
-		if passage != "" {
-			passages = append(passages, passage)
-		}
+// narrationWords - диапазон числа слов для рассказа заданной длительности
+// (диктор читает около 140 слов в минуту)
+func narrationWords(seconds int) (int, int) {
+	words := seconds * 140 / 60
+	return words * 85 / 100, words * 115 / 100
+}
 
-		start += end + 10
+// maxTokensFor - лимит токенов ответа с запасом на рассказ заданной длительности
+func maxTokensFor(narrationSeconds int) int {
+	_, maxWords := narrationWords(narrationSeconds)
+	tokens := maxWords * 3
+	if tokens < defaultMaxTokens {
+		return defaultMaxTokens
 	}
-
-	return passages
+	return tokens
 }
 
-func min(a, b int) int {
-	if a < b {
-		return a
+// truncateRunes обрезает строку до n символов (не байт)
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
 	}
-	return b
+	return string(runes[:n]) + "…"
 }
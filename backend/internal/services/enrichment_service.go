@@ -0,0 +1,276 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"gorm.io/gorm"
+)
+
+// Ключ в POI.Metadata, под которым кэшируется выжимка статьи
+const wikiMetadataKey = "wikipedia"
+
+const (
+	// Сколько результатов поиска проверять на соответствие месту
+	wikiSearchLimit = 5
+	// Статья без совпадения названия подходит, если ее координаты не дальше этого от места, м
+	wikiMaxDistance = 1000
+)
+
+// EnrichmentService подтягивает справочные данные о месте из MediaWiki-совместимого API
+// (Википедия, её локальное зеркало или собственная база знаний на MediaWiki)
+type EnrichmentService struct {
+	db          *gorm.DB
+	apiURL      string
+	cacheTTL    time.Duration
+	negativeTTL time.Duration // статья не найдена - ищем снова раньше: ее могли написать
+	client      *http.Client
+}
+
+func NewEnrichmentService(db *gorm.DB) *EnrichmentService {
+	apiURL := os.Getenv("WIKIPEDIA_API_URL")
+	if apiURL == "" {
+		apiURL = "https://ru.wikipedia.org/w/api.php"
+	}
+
+	return &EnrichmentService{
+		db:          db,
+		apiURL:      apiURL,
+		cacheTTL:    30 * 24 * time.Hour,
+		negativeTTL: 24 * time.Hour,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// WikiSummary - краткая выжимка статьи о месте
+type WikiSummary struct {
+	Title     string    `json:"title"`
+	Extract   string    `json:"extract"`
+	URL       string    `json:"url"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// GetSummary возвращает выжимку статьи о месте.
+// Результат кэшируется в POI.Metadata, в том числе пустой - чтобы не искать повторно каждый раз.
+// Для пользовательских мест без ссылки на статью поиск не выполняется: "Мой отель" или
+// "Точка 3" найдут статью о чем-то другом.
+func (s *EnrichmentService) GetSummary(poi *models.POI) (*WikiSummary, error) {
+	if poi.Visibility == models.POIVisibilityPrivate && poi.WikipediaURL == "" {
+		return &WikiSummary{}, nil
+	}
+
+	if cached := cachedWikiSummary(poi); cached != nil {
+		ttl := s.cacheTTL
+		if cached.Extract == "" {
+			ttl = s.negativeTTL
+		}
+		if time.Since(cached.FetchedAt) < ttl {
+			return cached, nil
+		}
+	}
+
+	summary, err := s.fetchSummary(poi)
+	if err != nil {
+		return nil, err
+	}
+	summary.FetchedAt = time.Now()
+
+	if err := s.saveSummary(poi, summary); err != nil {
+		return nil, err
+	}
+
+	return summary, nil
+}
+
+// fetchSummary запрашивает вступление статьи через MediaWiki API (prop=extracts).
+// Найденная поиском статья принимается, только если ее название совпадает с названием места
+// или ее координаты (prop=coordinates) рядом с местом.
+func (s *EnrichmentService) fetchSummary(poi *models.POI) (*WikiSummary, error) {
+	params := url.Values{}
+	params.Set("action", "query")
+	params.Set("format", "json")
+	params.Set("formatversion", "2")
+	params.Set("prop", "extracts|info")
+	params.Set("inprop", "url")
+	params.Set("exintro", "1")
+	params.Set("explaintext", "1")
+	params.Set("redirects", "1")
+
+	// Если ссылка на статью известна - берем ее, иначе ищем по названию
+	title := wikiTitleFromURL(poi.WikipediaURL)
+	if title != "" {
+		params.Set("titles", title)
+	} else {
+		params.Set("prop", "extracts|info|coordinates")
+		params.Set("generator", "search")
+		params.Set("gsrsearch", poi.Name)
+		params.Set("gsrlimit", strconv.Itoa(wikiSearchLimit))
+		params.Set("exlimit", strconv.Itoa(wikiSearchLimit))
+	}
+
+	req, err := http.NewRequest("GET", s.apiURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	// Политика Wikimedia требует осмысленный User-Agent
+	req.Header.Set("User-Agent", "Audioguid/1.0 (support@audioguid.ru)")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, upstreamCallError("MediaWiki", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, upstreamResponseError("MediaWiki", resp)
+	}
+
+	var result mediaWikiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode MediaWiki response: %w", err)
+	}
+
+	// Результаты поиска приходят не по порядку релевантности
+	pages := result.Query.Pages
+	sort.SliceStable(pages, func(i, j int) bool { return pages[i].Index < pages[j].Index })
+
+	summary := &WikiSummary{}
+	for _, page := range pages {
+		if page.Missing || page.Extract == "" {
+			continue
+		}
+		if title == "" && !wikiPageMatches(poi, page.Title, page.Coordinates) {
+			continue
+		}
+		summary.Title = page.Title
+		summary.Extract = strings.TrimSpace(page.Extract)
+		summary.URL = page.FullURL
+		break
+	}
+
+	return summary, nil
+}
+
+// saveSummary кладет выжимку в POI.Metadata и сохраняет ее в БД
+func (s *EnrichmentService) saveSummary(poi *models.POI, summary *WikiSummary) error {
+	metadata := map[string]interface{}{}
+	if poi.Metadata != nil {
+		for k, v := range *poi.Metadata {
+			metadata[k] = v
+		}
+	}
+	metadata[wikiMetadataKey] = summary
+	poi.Metadata = &metadata
+
+	if err := s.db.Model(poi).Select("metadata").Updates(models.POI{Metadata: poi.Metadata}).Error; err != nil {
+		return fmt.Errorf("failed to cache wiki summary: %w", err)
+	}
+
+	return nil
+}
+
+// cachedWikiSummary достает выжимку из POI.Metadata, если она там есть
+func cachedWikiSummary(poi *models.POI) *WikiSummary {
+	if poi.Metadata == nil {
+		return nil
+	}
+
+	raw, ok := (*poi.Metadata)[wikiMetadataKey]
+	if !ok {
+		return nil
+	}
+
+	// После чтения из jsonb значение приходит как map[string]interface{}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+
+	var summary WikiSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil
+	}
+
+	return &summary
+}
+
+// wikiPageMatches проверяет, что найденная поиском статья - о том же месте:
+// название совпадает (без уточнения в скобках) или координаты статьи рядом с местом
+func wikiPageMatches(poi *models.POI, title string, coordinates []mediaWikiCoordinates) bool {
+	if normalizeWikiTitle(title) == normalizeWikiTitle(poi.Name) {
+		return true
+	}
+	for _, coord := range coordinates {
+		if calculateDistance(poi.Latitude, poi.Longitude, coord.Lat, coord.Lon) <= wikiMaxDistance {
+			return true
+		}
+	}
+	return false
+}
+
+var wikiTitleQualifier = regexp.MustCompile(`\s*\([^)]*\)\s*$`)
+
+// normalizeWikiTitle приводит название к сравнимому виду: "Исаакиевский собор (Санкт-Петербург)",
+// «Исаакиевский собор» и "исаакиевский  собор" совпадают
+func normalizeWikiTitle(title string) string {
+	title = wikiTitleQualifier.ReplaceAllString(title, "")
+	title = strings.ReplaceAll(strings.ToLower(title), "ё", "е")
+	title = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, title)
+	return strings.Join(strings.Fields(title), " ")
+}
+
+// wikiTitleFromURL извлекает название статьи из ссылки вида https://ru.wikipedia.org/wiki/Название
+func wikiTitleFromURL(rawURL string) string {
+	if rawURL == "" {
+		return ""
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+
+	idx := strings.Index(u.Path, "/wiki/")
+	if idx == -1 {
+		// Ссылки вида /w/index.php?title=Название
+		return u.Query().Get("title")
+	}
+
+	return strings.ReplaceAll(u.Path[idx+len("/wiki/"):], "_", " ")
+}
+
+// Структуры для MediaWiki API
+
+type mediaWikiResponse struct {
+	Query struct {
+		Pages []struct {
+			PageID      int                    `json:"pageid"`
+			Index       int                    `json:"index"` // место в результатах поиска
+			Title       string                 `json:"title"`
+			Extract     string                 `json:"extract"`
+			FullURL     string                 `json:"fullurl"`
+			Missing     bool                   `json:"missing"`
+			Coordinates []mediaWikiCoordinates `json:"coordinates"`
+		} `json:"pages"`
+	} `json:"query"`
+}
+
+type mediaWikiCoordinates struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
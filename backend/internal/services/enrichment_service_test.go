@@ -0,0 +1,131 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+)
+
+// Ответ поиска: страницы идут не по порядку релевантности (index)
+const wikiSearchResponse = `{
+  "batchcomplete": true,
+  "query": {
+    "pages": [
+      {"pageid": 3, "index": 3, "title": "Исаакиевский собор (значения)", "extract": "Исаакиевский собор может означать...",
+        "fullurl": "https://ru.wikipedia.org/wiki/3"},
+      {"pageid": 1, "index": 1, "title": "Отель «Астория»", "extract": "Гостиница в Санкт-Петербурге.",
+        "fullurl": "https://ru.wikipedia.org/wiki/1", "coordinates": [{"lat": 59.9323, "lon": 30.3087, "primary": true}]},
+      {"pageid": 2, "index": 2, "title": "Исаакиевский собор", "extract": "Крупнейший православный храм Санкт-Петербурга.",
+        "fullurl": "https://ru.wikipedia.org/wiki/2", "coordinates": [{"lat": 59.9341, "lon": 30.3061, "primary": true}]}
+    ]
+  }
+}`
+
+func newTestEnrichmentService(t *testing.T, body string) (*EnrichmentService, *int) {
+	t.Helper()
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	return &EnrichmentService{
+		apiURL:      server.URL,
+		cacheTTL:    30 * 24 * time.Hour,
+		negativeTTL: 24 * time.Hour,
+		client:      server.Client(),
+	}, &requests
+}
+
+func TestFetchSummaryRelevance(t *testing.T) {
+	tests := []struct {
+		name      string
+		poi       models.POI
+		wantTitle string
+	}{
+		{
+			// Первый результат - гостиница: название другое, и она далеко от места
+			name:      "title match",
+			poi:       models.POI{Name: "исаакиевский  собор", Latitude: 55.75, Longitude: 37.61},
+			wantTitle: "Исаакиевский собор",
+		},
+		{
+			name:      "coordinates nearby",
+			poi:       models.POI{Name: "Гостиница Астория", Latitude: 59.9325, Longitude: 30.3090},
+			wantTitle: "Отель «Астория»",
+		},
+		{
+			name: "nothing relevant",
+			poi:  models.POI{Name: "Собор на Сенной", Latitude: 55.75, Longitude: 37.61},
+		},
+		{
+			// По явной ссылке на статью релевантность не проверяется
+			name:      "explicit article",
+			poi:       models.POI{Name: "Что-то другое", WikipediaURL: "https://ru.wikipedia.org/wiki/Отель_«Астория»"},
+			wantTitle: "Отель «Астория»",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newTestEnrichmentService(t, wikiSearchResponse)
+			summary, err := service.fetchSummary(&tt.poi)
+			if err != nil {
+				t.Fatalf("fetchSummary: %v", err)
+			}
+			if summary.Title != tt.wantTitle {
+				t.Errorf("title = %q, want %q", summary.Title, tt.wantTitle)
+			}
+			if tt.wantTitle == "" && summary.Extract != "" {
+				t.Errorf("extract = %q, want empty", summary.Extract)
+			}
+		})
+	}
+}
+
+func TestGetSummarySkipsSearch(t *testing.T) {
+	fresh := map[string]interface{}{wikiMetadataKey: map[string]interface{}{"fetched_at": time.Now().Add(-time.Hour)}}
+
+	tests := []struct {
+		name string
+		poi  models.POI
+	}{
+		{"private POI without article", models.POI{Name: "Мой отель", Visibility: models.POIVisibilityPrivate}},
+		{"fresh negative cache", models.POI{Name: "Точка 3", Visibility: models.POIVisibilityPublic, Metadata: &fresh}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, requests := newTestEnrichmentService(t, wikiSearchResponse)
+			summary, err := service.GetSummary(&tt.poi)
+			if err != nil {
+				t.Fatalf("GetSummary: %v", err)
+			}
+			if summary.Extract != "" || *requests != 0 {
+				t.Errorf("summary = %+v after %d requests, want empty without requests", summary, *requests)
+			}
+		})
+	}
+}
+
+func TestNormalizeWikiTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Исаакиевский собор", "исаакиевский собор"},
+		{"Исаакиевский собор (Санкт-Петербург)", "исаакиевский собор"},
+		{"«Ёлка»  на площади", "елка на площади"},
+		{"Дом-музей Чехова", "дом музей чехова"},
+	}
+
+	for _, tt := range tests {
+		if got := normalizeWikiTitle(tt.title); got != tt.want {
+			t.Errorf("normalizeWikiTitle(%q) = %q, want %q", tt.title, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Категории ошибок сервисов. Хендлеры сопоставляют их со статусами HTTP.
+var (
+	ErrNotFound            = errors.New("not found")
+	ErrValidation          = errors.New("validation failed")
+	ErrUpstreamUnavailable = errors.New("upstream service unavailable")
+	ErrQuotaExceeded       = errors.New("quota exceeded")
+	ErrUnauthorized        = errors.New("unauthorized")
+	ErrForbidden           = errors.New("forbidden")
+)
+
+// UpstreamError - сбой внешнего API (2GIS, YandexGPT, SpeechKit и др.).
+// Тело ответа провайдера нужно только для логов и клиенту не отдается.
+type UpstreamError struct {
+	Service    string
+	StatusCode int // 0 - сетевой сбой, ответа нет
+	Body       string
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("failed to call %s API: %v", e.Service, e.Err)
+	}
+	return fmt.Sprintf("%s API error (status %d): %s", e.Service, e.StatusCode, e.Body)
+}
+
+func (e *UpstreamError) Unwrap() error { return e.Err }
+
+func (e *UpstreamError) Is(target error) bool { return target == ErrUpstreamUnavailable }
+
+// upstreamCallError - запрос к внешнему API не дошел до провайдера
+func upstreamCallError(service string, err error) error {
+	return &UpstreamError{Service: service, Err: err}
+}
+
+// upstreamResponseError - внешнее API ответило ошибкой. Тело ответа обрезается для логов.
+func upstreamResponseError(service string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+	return &UpstreamError{
+		Service:    service,
+		StatusCode: resp.StatusCode,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+// validationError - некорректные входные данные; текст безопасно отдавать клиенту
+func validationError(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrValidation, fmt.Sprintf(format, args...))
+}
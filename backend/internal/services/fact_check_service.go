@@ -0,0 +1,375 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+)
+
+// Вердикты проверки фактов
+const (
+	FactCheckPassed   = "passed"   // расхождений не найдено
+	FactCheckFlagged  = "flagged"  // есть непроверенные или сомнительные факты
+	FactCheckRejected = "rejected" // есть явные противоречия данным о месте
+)
+
+// Серьезность найденного расхождения
+const (
+	FactIssueError   = "error"   // противоречит полям POI
+	FactIssueWarning = "warning" // не подтверждается источниками
+)
+
+// FactCheckService сверяет годы, числа, имена и стили в сгенерированном тексте
+// с полями POI и справочными источниками
+type FactCheckService struct {
+	mode   string // off, flag (только пометить), reject (отклонять при ошибках)
+	revise bool   // просить LLM исправить текст при ошибках
+}
+
+func NewFactCheckService() *FactCheckService {
+	mode := os.Getenv("FACT_CHECK_MODE")
+	if mode == "" {
+		mode = "flag"
+	}
+
+	return &FactCheckService{
+		mode:   mode,
+		revise: os.Getenv("FACT_CHECK_REVISE") != "false",
+	}
+}
+
+// FactIssue - найденное расхождение
+type FactIssue struct {
+	Severity string
+	Message  string
+}
+
+func (i FactIssue) String() string {
+	return i.Severity + ": " + i.Message
+}
+
+// FactCheckResult - результат проверки текста
+type FactCheckResult struct {
+	Verdict string
+	Issues  []FactIssue
+}
+
+// HasErrors сообщает, есть ли среди расхождений явные ошибки
+func (r *FactCheckResult) HasErrors() bool {
+	for _, issue := range r.Issues {
+		if issue.Severity == FactIssueError {
+			return true
+		}
+	}
+	return false
+}
+
+// IssueStrings возвращает расхождения в виде строк для сохранения в БД
+func (r *FactCheckResult) IssueStrings() []string {
+	issues := make([]string, len(r.Issues))
+	for i, issue := range r.Issues {
+		issues[i] = issue.String()
+	}
+	return issues
+}
+
+// Enabled сообщает, включена ли проверка
+func (s *FactCheckService) Enabled() bool {
+	return s.mode != "off"
+}
+
+// ShouldRevise сообщает, нужно ли просить LLM исправить текст
+func (s *FactCheckService) ShouldRevise(result *FactCheckResult) bool {
+	return s.revise && result.HasErrors()
+}
+
+var (
+	numberPattern    = regexp.MustCompile(`\d+(?:[.,]\d+)?`)
+	measurePattern   = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*(метр\p{L}*|км|этаж\p{L}*|тонн\p{L}*|колонн\p{L}*|ступен\p{L}*|куп\p{L}*)`)
+	personPattern    = regexp.MustCompile(`([Аа]рхитектор\p{L}*|[Сс]кульптор\p{L}*|[Ии]нженер\p{L}*|[Зз]одч\p{L}*)\s+((?:\p{Lu}\.\s?){0,2}\p{Lu}\p{Ll}+(?:\s+\p{Lu}\p{Ll}+){0,2})`)
+	sentenceSplitter = regexp.MustCompile(`[.!?…]+\s+`)
+	// Единица или счетное слово после числа: "1000 метров", "2500 мест" - количество, а не год
+	quantitySuffix = regexp.MustCompile(`^\s*(?:(?:метр|километр|гектар|тонн|этаж|колонн|ступен|куп|мест|человек|жител|посетител|экспонат|штук|рубл)|(?:км|м|га|кг|кв|лет)(?:[^\p{L}]|$))`)
+)
+
+// Слова, по которым предложение считается рассказом о постройке
+var constructionStems = []string{"постро", "возвед", "сооруж", "заложен", "основан", "воздвиг"}
+
+// Известные архитектурные стили (основы слов)
+var knownStyles = []string{
+	"модерн", "ампир", "барокко", "классицизм", "готи", "конструктивизм", "эклектик",
+	"ренессанс", "неоклассиц", "псевдорусск", "брутализм", "хай-тек", "рококо", "романск",
+}
+
+// Check проверяет текст. references - справочные тексты, использованные при генерации.
+func (s *FactCheckService) Check(text string, poi models.POI, references []string) *FactCheckResult {
+	result := &FactCheckResult{Verdict: FactCheckPassed}
+	if !s.Enabled() {
+		return result
+	}
+
+	corpus := strings.ToLower(strings.Join(append([]string{
+		poi.Name, poi.Description, poi.Architect, poi.Style,
+	}, references...), "\n"))
+
+	result.Issues = append(result.Issues, checkYears(text, poi, corpus)...)
+	result.Issues = append(result.Issues, checkMeasures(text, corpus)...)
+	result.Issues = append(result.Issues, checkPeople(text, poi, corpus)...)
+	result.Issues = append(result.Issues, checkStyles(text, poi, corpus)...)
+
+	switch {
+	case result.HasErrors() && s.mode == "reject":
+		result.Verdict = FactCheckRejected
+	case len(result.Issues) > 0:
+		result.Verdict = FactCheckFlagged
+	}
+
+	return result
+}
+
+// checkYears сверяет годы в тексте с годом постройки и источниками
+func checkYears(text string, poi models.POI, corpus string) []FactIssue {
+	var issues []FactIssue
+	reported := map[int]bool{}
+
+	for _, sentence := range sentenceSplitter.Split(text, -1) {
+		years := extractYears(sentence)
+		if len(years) == 0 {
+			continue
+		}
+
+		aboutConstruction := containsAny(strings.ToLower(sentence), constructionStems)
+		mentionsYearBuilt := false
+		for _, year := range years {
+			if poi.YearBuilt > 0 && abs(year-poi.YearBuilt) <= 1 {
+				mentionsYearBuilt = true
+			}
+		}
+
+		for _, year := range years {
+			if reported[year] || containsNumber(corpus, strconv.Itoa(year)) {
+				continue
+			}
+			if poi.YearBuilt > 0 && abs(year-poi.YearBuilt) <= 1 {
+				continue
+			}
+			reported[year] = true
+
+			if aboutConstruction && poi.YearBuilt > 0 && !mentionsYearBuilt {
+				issues = append(issues, FactIssue{
+					Severity: FactIssueError,
+					Message:  fmt.Sprintf("год постройки %d не совпадает с указанным %d", year, poi.YearBuilt),
+				})
+				continue
+			}
+
+			issues = append(issues, FactIssue{
+				Severity: FactIssueWarning,
+				Message:  fmt.Sprintf("год %d не подтверждается источниками", year),
+			})
+		}
+	}
+
+	return issues
+}
+
+// checkMeasures проверяет числа с единицами измерения (высота, этажность и т.п.)
+func checkMeasures(text, corpus string) []FactIssue {
+	var issues []FactIssue
+	reported := map[string]bool{}
+
+	for _, match := range measurePattern.FindAllStringSubmatch(text, -1) {
+		number := match[1]
+		if reported[number] || containsNumber(corpus, number) {
+			continue
+		}
+		reported[number] = true
+
+		issues = append(issues, FactIssue{
+			Severity: FactIssueWarning,
+			Message:  fmt.Sprintf("число «%s» не подтверждается источниками", strings.TrimSpace(match[0])),
+		})
+	}
+
+	return issues
+}
+
+// checkPeople сверяет упомянутых архитекторов и скульпторов с POI.Architect и источниками
+func checkPeople(text string, poi models.POI, corpus string) []FactIssue {
+	var issues []FactIssue
+	reported := map[string]bool{}
+	corpusWords := strings.Fields(corpus)
+	architectWords := capitalizedWords(poi.Architect)
+
+	for _, match := range personPattern.FindAllStringSubmatch(text, -1) {
+		role := strings.ToLower(match[1])
+		name := strings.TrimSpace(match[2])
+		if reported[name] {
+			continue
+		}
+
+		nameWords := capitalizedWords(name)
+		if len(nameWords) == 0 {
+			continue
+		}
+		surname := nameWords[len(nameWords)-1]
+
+		isArchitect := strings.HasPrefix(role, "архитектор") || strings.HasPrefix(role, "зодч")
+		if isArchitect && len(architectWords) > 0 && anyNameMatches(nameWords, architectWords) {
+			continue
+		}
+		if anyNameMatches([]string{strings.ToLower(surname)}, corpusWords) {
+			continue
+		}
+		reported[name] = true
+
+		if isArchitect && len(architectWords) > 0 {
+			issues = append(issues, FactIssue{
+				Severity: FactIssueError,
+				Message:  fmt.Sprintf("архитектор «%s» не совпадает с указанным «%s»", name, poi.Architect),
+			})
+			continue
+		}
+
+		issues = append(issues, FactIssue{
+			Severity: FactIssueWarning,
+			Message:  fmt.Sprintf("упоминание «%s» не подтверждается источниками", name),
+		})
+	}
+
+	return issues
+}
+
+// checkStyles ищет в предложениях о стиле стили, не совпадающие с POI.Style
+func checkStyles(text string, poi models.POI, corpus string) []FactIssue {
+	if poi.Style == "" {
+		return nil
+	}
+
+	var issues []FactIssue
+	style := strings.ToLower(poi.Style)
+	reported := map[string]bool{}
+
+	for _, sentence := range sentenceSplitter.Split(strings.ToLower(text), -1) {
+		if !strings.Contains(sentence, "стил") {
+			continue
+		}
+
+		for _, stem := range knownStyles {
+			if reported[stem] || !strings.Contains(sentence, stem) {
+				continue
+			}
+			if strings.Contains(style, stem) || strings.Contains(corpus, stem) {
+				continue
+			}
+			reported[stem] = true
+
+			issues = append(issues, FactIssue{
+				Severity: FactIssueWarning,
+				Message:  fmt.Sprintf("стиль «%s» не совпадает с указанным «%s»", stem, poi.Style),
+			})
+		}
+	}
+
+	return issues
+}
+
+// extractYears находит в тексте четырехзначные числа, похожие на годы.
+// Дробные числа и количества с единицей измерения ("1000 метров") годами не считаются.
+func extractYears(text string) []int {
+	var years []int
+	for _, loc := range numberPattern.FindAllStringIndex(text, -1) {
+		match := text[loc[0]:loc[1]]
+		if len(match) != 4 || quantitySuffix.MatchString(text[loc[1]:]) {
+			continue
+		}
+		year, _ := strconv.Atoi(match)
+		if year >= 1000 && year <= 2099 {
+			years = append(years, year)
+		}
+	}
+	return years
+}
+
+// containsNumber ищет в тексте число целиком: "5" не находится в "1.5" или "25",
+// дробная часть может быть записана через точку или запятую
+func containsNumber(text, number string) bool {
+	number = strings.ReplaceAll(number, ",", ".")
+	for _, match := range numberPattern.FindAllString(text, -1) {
+		if strings.ReplaceAll(match, ",", ".") == number {
+			return true
+		}
+	}
+	return false
+}
+
+// capitalizedWords возвращает слова с заглавной буквы (без инициалов) в нижнем регистре
+func capitalizedWords(s string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '-'
+	}) {
+		runes := []rune(word)
+		if len(runes) < 3 || !unicode.IsUpper(runes[0]) {
+			continue
+		}
+		words = append(words, strings.ToLower(word))
+	}
+	return words
+}
+
+// anyNameMatches сравнивает слова с учетом падежных окончаний
+func anyNameMatches(names, candidates []string) bool {
+	for _, name := range names {
+		for _, candidate := range candidates {
+			if sameNameStem(strings.ToLower(name), strings.Trim(candidate, ".,;:!?«»\"()")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// sameNameStem считает слова одной фамилией, если они различаются только окончанием
+// (Казаков / Казакова, Шехтель / Шехтеля)
+func sameNameStem(a, b string) bool {
+	ra, rb := []rune(a), []rune(b)
+	shortest := len(ra)
+	if len(rb) < shortest {
+		shortest = len(rb)
+	}
+	if shortest < 3 {
+		return false
+	}
+
+	common := 0
+	for common < shortest && ra[common] == rb[common] {
+		common++
+	}
+
+	if shortest <= 4 {
+		return common == shortest && abs(len(ra)-len(rb)) <= 2
+	}
+	return common >= shortest-2
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,319 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+)
+
+// issueMessages - сообщения расхождений для сравнения в тестах
+func issueMessages(issues []FactIssue) []string {
+	var messages []string
+	for _, issue := range issues {
+		messages = append(messages, issue.String())
+	}
+	return messages
+}
+
+func TestExtractYears(t *testing.T) {
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"Собор построен в 1818 году и освящен в 1858-м.", []int{1818, 1858}},
+		{"В 2000-х годах здание отреставрировали", []int{2000}},
+		{"Высота башни 1000 метров", nil},
+		{"Зал вмещает 2500 мест", nil},
+		{"Длина стены 2235 м, площадь 1200 кв. м", nil},
+		{"Дубу больше 1000 лет", nil},
+		{"Здесь работали 1500 человек", nil},
+		{"Коэффициент 1.2000", nil},
+		{"В 1812 мы знаем о пожаре", []int{1812}},
+		{"Номер 12345 и год 999", nil},
+		{"Планы на 2150 год", nil},
+	}
+
+	for _, tt := range tests {
+		if got := extractYears(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("extractYears(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCheckYears(t *testing.T) {
+	poi := models.POI{Name: "Исаакиевский собор", YearBuilt: 1858}
+
+	tests := []struct {
+		name   string
+		text   string
+		corpus string
+		want   []string
+	}{
+		{
+			name: "year built matches",
+			text: "Собор построен в 1858 году.",
+			want: nil,
+		},
+		{
+			name: "off by one year is accepted",
+			text: "Строительство завершили в 1857 году.",
+			want: nil,
+		},
+		{
+			name: "wrong year built",
+			text: "Собор построен в 1818 году.",
+			want: []string{"error: год постройки 1818 не совпадает с указанным 1858"},
+		},
+		{
+			name: "construction sentence with the right year too",
+			text: "Собор заложен в 1818 году и построен к 1858 году.",
+			want: []string{"warning: год 1818 не подтверждается источниками"},
+		},
+		{
+			name:   "year from sources",
+			text:   "Собор построен в 1818 году.",
+			corpus: "строительство началось в 1818 году",
+			want:   nil,
+		},
+		{
+			name: "unrelated year",
+			text: "В 1931 году в соборе открыли музей.",
+			want: []string{"warning: год 1931 не подтверждается источниками"},
+		},
+		{
+			// Год не должен подтверждаться частью другого числа в источниках
+			name:   "year inside a longer number",
+			text:   "В 1931 году в соборе открыли музей.",
+			corpus: "инвентарный номер 19310",
+			want:   []string{"warning: год 1931 не подтверждается источниками"},
+		},
+		{
+			name: "quantities are not years",
+			text: "Высота купола 1000 метров, собор вмещает 1200 человек.",
+			want: nil,
+		},
+		{
+			name: "repeated year is reported once",
+			text: "В 1931 году открыли музей. Музей 1931 года был первым.",
+			want: []string{"warning: год 1931 не подтверждается источниками"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := issueMessages(checkYears(tt.text, poi, tt.corpus))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkYears = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMeasures(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		corpus string
+		want   []string
+	}{
+		{
+			name:   "confirmed by sources",
+			text:   "Высота собора 101,5 метра.",
+			corpus: "высота 101,5 м",
+			want:   nil,
+		},
+		{
+			name:   "decimal separator differs",
+			text:   "Высота собора 101.5 метра.",
+			corpus: "высота 101,5 м",
+			want:   nil,
+		},
+		{
+			name:   "digit inside another number",
+			text:   "У собора 5 куполов.",
+			corpus: "построен в 1858 году, высота 101,5 м, 25 метров",
+			want:   []string{"warning: число «5 куполов» не подтверждается источниками"},
+		},
+		{
+			name:   "number inside a year",
+			text:   "В соборе 12 колонн.",
+			corpus: "освящен в 1712 году",
+			want:   []string{"warning: число «12 колонн» не подтверждается источниками"},
+		},
+		{
+			name:   "whole number in sources",
+			text:   "В соборе 112 колонн.",
+			corpus: "портики из 112 колонн",
+			want:   nil,
+		},
+		{
+			name: "each number reported once",
+			text: "Четыре портика по 8 колонн, 8 этажей.",
+			want: []string{"warning: число «8 колонн» не подтверждается источниками"},
+		},
+		{
+			name: "numbers without units are ignored",
+			text: "Собор входит в 10 самых известных.",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := issueMessages(checkMeasures(tt.text, tt.corpus))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkMeasures = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPeople(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		poi    models.POI
+		corpus string
+		want   []string
+	}{
+		{
+			name: "architect matches in another case",
+			text: "Проект архитектора Монферрана утвердили сразу.",
+			poi:  models.POI{Architect: "Огюст Монферран"},
+			want: nil,
+		},
+		{
+			name: "architect with initials",
+			text: "Собор построил архитектор О. Монферран.",
+			poi:  models.POI{Architect: "Огюст Монферран"},
+			want: nil,
+		},
+		{
+			name: "wrong architect",
+			text: "Собор построил архитектор Растрелли.",
+			poi:  models.POI{Architect: "Огюст Монферран"},
+			want: []string{"error: архитектор «Растрелли» не совпадает с указанным «Огюст Монферран»"},
+		},
+		{
+			name:   "other architect from sources",
+			text:   "Первый проект предлагал архитектор Ринальди.",
+			poi:    models.POI{Architect: "Огюст Монферран"},
+			corpus: "предыдущее здание строил антонио ринальди",
+			want:   nil,
+		},
+		{
+			name: "unknown sculptor",
+			text: "Скульптор Витали украсил фронтоны.",
+			poi:  models.POI{Architect: "Огюст Монферран"},
+			want: []string{"warning: упоминание «Витали» не подтверждается источниками"},
+		},
+		{
+			name:   "sculptor from sources",
+			text:   "Скульптор Витали украсил фронтоны.",
+			corpus: "рельефы фронтонов выполнил иван витали.",
+			want:   nil,
+		},
+		{
+			name: "architect unknown without POI architect",
+			text: "Архитектор Монферран работал над собором 40 лет.",
+			want: []string{"warning: упоминание «Монферран» не подтверждается источниками"},
+		},
+		{
+			name: "similar surname is not the architect",
+			text: "Проект подготовил архитектор Казанцев.",
+			poi:  models.POI{Architect: "Матвей Казаков"},
+			want: []string{"error: архитектор «Казанцев» не совпадает с указанным «Матвей Казаков»"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := issueMessages(checkPeople(tt.text, tt.poi, tt.corpus))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkPeople = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckStyles(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		poi    models.POI
+		corpus string
+		want   []string
+	}{
+		{
+			name: "style matches",
+			text: "Собор построен в стиле позднего классицизма.",
+			poi:  models.POI{Style: "Поздний классицизм"},
+			want: nil,
+		},
+		{
+			name: "wrong style",
+			text: "Собор выполнен в стиле барокко.",
+			poi:  models.POI{Style: "Классицизм"},
+			want: []string{"warning: стиль «барокко» не совпадает с указанным «Классицизм»"},
+		},
+		{
+			name:   "style from sources",
+			text:   "В интерьере заметны черты стиля барокко.",
+			poi:    models.POI{Style: "Классицизм"},
+			corpus: "убранство в духе барокко",
+			want:   nil,
+		},
+		{
+			name: "style word outside a sentence about style",
+			text: "Рядом стоит дом в модерне. Собор выдержан в стиле классицизма.",
+			poi:  models.POI{Style: "Классицизм"},
+			want: nil,
+		},
+		{
+			name: "no style on POI",
+			text: "Собор выполнен в стиле барокко.",
+			want: nil,
+		},
+		{
+			name: "several styles in one sentence",
+			text: "Стиль смешивает ампир и готику.",
+			poi:  models.POI{Style: "Классицизм"},
+			want: []string{
+				"warning: стиль «ампир» не совпадает с указанным «Классицизм»",
+				"warning: стиль «готи» не совпадает с указанным «Классицизм»",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := issueMessages(checkStyles(tt.text, tt.poi, tt.corpus))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkStyles = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFactCheckVerdict(t *testing.T) {
+	poi := models.POI{Name: "Исаакиевский собор", YearBuilt: 1858, Architect: "Огюст Монферран"}
+	text := "Собор построен в 1818 году архитектором Монферраном."
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"off", FactCheckPassed},
+		{"flag", FactCheckFlagged},
+		{"reject", FactCheckRejected},
+	}
+
+	for _, tt := range tests {
+		result := (&FactCheckService{mode: tt.mode}).Check(text, poi, nil)
+		if result.Verdict != tt.want {
+			t.Errorf("mode %s: verdict = %s, want %s (%s)", tt.mode, result.Verdict, tt.want, strings.Join(result.IssueStrings(), "; "))
+		}
+	}
+}
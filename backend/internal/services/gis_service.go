@@ -1,27 +1,34 @@
 package services
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // GISService работает с 2GIS API
 type GISService struct {
-	apiKey  string
-	appID   string
-	baseURL string
-	client  *http.Client
+	apiKey     string
+	appID      string
+	baseURL    string
+	routingURL string
+	client     *http.Client
 }
 
 func NewGISService() *GISService {
 	return &GISService{
-		apiKey:  os.Getenv("GAPIS_API_KEY"),
-		appID:   os.Getenv("GAPIS_APP_ID"),
-		baseURL: "https://catalog.api.2gis.com",
-		client:  &http.Client{},
+		apiKey:     os.Getenv("GAPIS_API_KEY"),
+		appID:      os.Getenv("GAPIS_APP_ID"),
+		baseURL:    "https://catalog.api.2gis.com",
+		routingURL: "https://routing.api.2gis.com",
+		client:     &http.Client{Timeout: 15 * time.Second},
 	}
 }
 
@@ -32,13 +39,12 @@ func (s *GISService) FindPlacesNearby(lat, lon, radius float64, query string) ([
 
 	resp, err := s.client.Get(url)
 	if err != nil {
-		return nil, fmt.Errorf("failed to call 2GIS API: %w", err)
+		return nil, upstreamCallError("2GIS", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("2GIS API error: %s", string(body))
+		return nil, upstreamResponseError("2GIS", resp)
 	}
 
 	var result PlacesResponse
@@ -49,41 +55,77 @@ func (s *GISService) FindPlacesNearby(lat, lon, radius float64, query string) ([
 	return result.Result.Items, nil
 }
 
-// BuildRoute строит маршрут между точками
+// BuildRoute строит маршрут между точками через 2GIS Routing API.
+// routeType - способ передвижения в терминах API (walking, bicycle, driving).
 func (s *GISService) BuildRoute(points []RoutePoint, routeType string) (*RouteResult, error) {
-	// Формируем строку точек
-	pointsStr := ""
-	for i, p := range points {
-		if i > 0 {
-			pointsStr += ";"
-		}
-		pointsStr += fmt.Sprintf("%f,%f", p.Lon, p.Lat)
+	request := routingRequest{Transport: routeType, Output: "detailed", Locale: "ru"}
+	for _, p := range points {
+		request.Points = append(request.Points, routingPoint{Type: "stop", Lon: p.Lon, Lat: p.Lat})
 	}
 
-	url := fmt.Sprintf("%s/routing/7.0.0/global?key=%s&type=%s&points=%s&output=json",
-		s.baseURL, s.apiKey, routeType, pointsStr)
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode route request: %w", err)
+	}
 
-	resp, err := s.client.Get(url)
+	endpoint := fmt.Sprintf("%s/routing/7.0.0/global?key=%s", s.routingURL, url.QueryEscape(s.apiKey))
+	resp, err := s.client.Post(endpoint, "application/json", bytes.NewReader(body))
 	if err != nil {
-		return nil, fmt.Errorf("failed to call routing API: %w", err)
+		return nil, upstreamCallError("2GIS Routing", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("routing API error: %s", string(body))
+		return nil, upstreamResponseError("2GIS Routing", resp)
 	}
 
-	var result RouteResponse
+	var result routingResponse
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
 		return nil, fmt.Errorf("failed to decode route response: %w", err)
 	}
 
-	if len(result.Result) == 0 {
-		return nil, fmt.Errorf("no route found")
+	// Маршрут не найден приходит с кодом 200 и статусом в теле
+	if result.Status != "OK" || len(result.Result) == 0 {
+		return nil, fmt.Errorf("no route found: %s %s", result.Status, result.Message)
 	}
 
-	return &result.Result[0], nil
+	route := result.Result[0]
+	geometry, err := route.geometry()
+	if err != nil {
+		return nil, err
+	}
+	return &RouteResult{
+		TotalDuration: route.TotalDuration,
+		TotalDistance: route.TotalDistance,
+		Type:          routeType,
+		Geometry:      geometry,
+	}, nil
+}
+
+// EstimateRoute строит маршрут через 2GIS, а если API недоступно - по прямым между точками
+func (s *GISService) EstimateRoute(points []RoutePoint, profile TransportProfile) *RouteResult {
+	if len(points) >= 2 {
+		result, err := s.BuildRoute(points, profile.RoutingType)
+		if err == nil {
+			if profile.EstimateDuration {
+				result.TotalDuration = profile.TravelSeconds(float64(result.TotalDistance))
+			}
+			return result
+		}
+		log.Printf("Warning: 2GIS routing failed, estimating by straight lines: %v", err)
+	}
+
+	result := &RouteResult{Type: profile.RoutingType}
+	for i, p := range points {
+		result.Geometry = append(result.Geometry, []float64{p.Lon, p.Lat})
+		if i > 0 {
+			prev := points[i-1]
+			result.TotalDistance += int(calculateDistance(prev.Lat, prev.Lon, p.Lat, p.Lon))
+		}
+	}
+	result.TotalDuration = profile.TravelSeconds(float64(result.TotalDistance))
+
+	return result
 }
 
 // Структуры для 2GIS API
@@ -117,13 +159,95 @@ type RoutePoint struct {
 }
 
 type RouteResult struct {
-	TotalDuration int     `json:"total_duration"` // секунды
-	TotalDistance int     `json:"total_distance"` // метры
-	Type          string  `json:"type"`
-	Geometry      [][]float64 `json:"geometry"`
+	TotalDuration int         `json:"total_duration"` // секунды
+	TotalDistance int         `json:"total_distance"` // метры
+	Type          string      `json:"type"`
+	Geometry      [][]float64 `json:"geometry"` // пары [lon, lat]
+}
+
+// Запрос и ответ 2GIS Routing API 7.0.0
+
+type routingRequest struct {
+	Points    []routingPoint `json:"points"`
+	Transport string         `json:"transport"`
+	Output    string         `json:"output"`
+	Locale    string         `json:"locale"`
+}
+
+type routingPoint struct {
+	Type string  `json:"type"`
+	Lon  float64 `json:"lon"`
+	Lat  float64 `json:"lat"`
+}
+
+type routingResponse struct {
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  []routingResult `json:"result"`
 }
 
-type RouteResponse struct {
-	Result []RouteResult `json:"result"`
+type routingResult struct {
+	TotalDuration int `json:"total_duration"` // секунды
+	TotalDistance int `json:"total_distance"` // метры
+	Maneuvers     []struct {
+		OutcomingPath *struct {
+			Geometry []struct {
+				Selection string `json:"selection"` // WKT LINESTRING
+			} `json:"geometry"`
+		} `json:"outcoming_path"`
+	} `json:"maneuvers"`
 }
 
+// geometry склеивает линии маневров в одну ломаную из пар [lon, lat]
+func (r routingResult) geometry() ([][]float64, error) {
+	var line [][]float64
+	for _, maneuver := range r.Maneuvers {
+		if maneuver.OutcomingPath == nil {
+			continue
+		}
+		for _, part := range maneuver.OutcomingPath.Geometry {
+			coords, err := parseWKTLineString(part.Selection)
+			if err != nil {
+				return nil, err
+			}
+			for _, coord := range coords {
+				// Соседние линии начинаются там, где закончилась предыдущая
+				if n := len(line); n > 0 && line[n-1][0] == coord[0] && line[n-1][1] == coord[1] {
+					continue
+				}
+				line = append(line, coord)
+			}
+		}
+	}
+	return line, nil
+}
+
+// parseWKTLineString разбирает "LINESTRING(lon lat, lon lat, ...)"
+func parseWKTLineString(wkt string) ([][]float64, error) {
+	body := strings.TrimSpace(wkt)
+	if !strings.HasPrefix(strings.ToUpper(body), "LINESTRING") {
+		return nil, fmt.Errorf("unsupported route geometry %q", wkt)
+	}
+	body = strings.TrimSpace(body[len("LINESTRING"):])
+	if !strings.HasPrefix(body, "(") || !strings.HasSuffix(body, ")") {
+		return nil, fmt.Errorf("invalid route geometry %q", wkt)
+	}
+
+	var coords [][]float64
+	for _, pair := range strings.Split(body[1:len(body)-1], ",") {
+		fields := strings.Fields(pair)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("invalid route geometry %q", wkt)
+		}
+		lon, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route geometry %q", wkt)
+		}
+		lat, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid route geometry %q", wkt)
+		}
+		coords = append(coords, []float64{lon, lat})
+	}
+	return coords, nil
+}
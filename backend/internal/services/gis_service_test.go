@@ -0,0 +1,194 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fake2GISRouting отвечает на запросы Routing API заранее заданным телом и запоминает запрос
+type fake2GISRouting struct {
+	t       *testing.T
+	status  int
+	body    string
+	request routingRequest
+}
+
+func (f *fake2GISRouting) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != "/routing/7.0.0/global" {
+		f.t.Errorf("request %s %s, want POST /routing/7.0.0/global", r.Method, r.URL.Path)
+	}
+	if key := r.URL.Query().Get("key"); key != "test-key" {
+		f.t.Errorf("key = %q, want test-key", key)
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+		f.t.Errorf("Content-Type = %q, want application/json", ct)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&f.request); err != nil {
+		f.t.Errorf("decode request: %v", err)
+	}
+
+	w.WriteHeader(f.status)
+	w.Write([]byte(f.body))
+}
+
+func newTestGISService(t *testing.T, status int, body string) (*GISService, *fake2GISRouting) {
+	t.Helper()
+	fake := &fake2GISRouting{t: t, status: status, body: body}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return &GISService{
+		apiKey:     "test-key",
+		routingURL: server.URL,
+		client:     &http.Client{Timeout: 5 * time.Second},
+	}, fake
+}
+
+const routingOKResponse = `{
+  "query": {},
+  "status": "OK",
+  "type": "result",
+  "result": [{
+    "id": "1",
+    "total_distance": 1520,
+    "total_duration": 1140,
+    "maneuvers": [
+      {"comment": "start", "outcoming_path": {"distance": 700, "duration": 520,
+        "geometry": [{"selection": "LINESTRING(37.6173 55.7558, 37.6190 55.7570)"}, {"selection": "LINESTRING(37.6190 55.7570, 37.6201 55.7581)"}]}},
+      {"comment": "turn", "outcoming_path": {"distance": 820, "duration": 620,
+        "geometry": [{"selection": "LINESTRING (37.6201 55.7581, 37.6230 55.7600)"}]}},
+      {"comment": "finish"}
+    ]
+  }]
+}`
+
+var routingPoints = []RoutePoint{{Lat: 55.7558, Lon: 37.6173}, {Lat: 55.7581, Lon: 37.6201}, {Lat: 55.7600, Lon: 37.6230}}
+
+func TestBuildRoute(t *testing.T) {
+	gis, fake := newTestGISService(t, http.StatusOK, routingOKResponse)
+
+	got, err := gis.BuildRoute(routingPoints, "bicycle")
+	if err != nil {
+		t.Fatalf("BuildRoute: %v", err)
+	}
+
+	want := &RouteResult{
+		TotalDuration: 1140,
+		TotalDistance: 1520,
+		Type:          "bicycle",
+		Geometry: [][]float64{
+			{37.6173, 55.7558}, {37.6190, 55.7570}, {37.6201, 55.7581}, {37.6230, 55.7600},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BuildRoute =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if fake.request.Transport != "bicycle" {
+		t.Errorf("transport = %q, want bicycle", fake.request.Transport)
+	}
+	if len(fake.request.Points) != len(routingPoints) {
+		t.Fatalf("sent %d points, want %d", len(fake.request.Points), len(routingPoints))
+	}
+	for i, p := range fake.request.Points {
+		if p.Type != "stop" || p.Lat != routingPoints[i].Lat || p.Lon != routingPoints[i].Lon {
+			t.Errorf("point %d = %+v, want stop at %+v", i, p, routingPoints[i])
+		}
+	}
+}
+
+func TestBuildRouteErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"upstream error", http.StatusInternalServerError, `{"message": "internal error"}`},
+		{"forbidden key", http.StatusForbidden, `{"message": "Invalid key"}`},
+		{"route not found", http.StatusOK, `{"status": "ROUTE_NOT_FOUND", "message": "no route", "result": []}`},
+		{"bad geometry", http.StatusOK, `{"status": "OK", "result": [{"total_distance": 1, "total_duration": 1,
+			"maneuvers": [{"outcoming_path": {"geometry": [{"selection": "POINT(37.6 55.7)"}]}}]}]}`},
+		{"broken JSON", http.StatusOK, `{"status": "OK", "result": [`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gis, _ := newTestGISService(t, tt.status, tt.body)
+			if _, err := gis.BuildRoute(routingPoints, "walking"); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestEstimateRoute(t *testing.T) {
+	t.Run("routing result", func(t *testing.T) {
+		gis, fake := newTestGISService(t, http.StatusOK, routingOKResponse)
+		got := gis.EstimateRoute(routingPoints, TransportProfileFor(TransportCar))
+		if got.TotalDuration != 1140 || got.TotalDistance != 1520 || len(got.Geometry) != 4 {
+			t.Errorf("EstimateRoute = %+v, want 2GIS route", got)
+		}
+		if fake.request.Transport != "driving" {
+			t.Errorf("transport = %q, want driving", fake.request.Transport)
+		}
+	})
+
+	t.Run("public transport time by speed", func(t *testing.T) {
+		gis, _ := newTestGISService(t, http.StatusOK, routingOKResponse)
+		profile := TransportProfileFor(TransportPublicTransport)
+		got := gis.EstimateRoute(routingPoints, profile)
+		if want := profile.TravelSeconds(1520); got.TotalDuration != want {
+			t.Errorf("TotalDuration = %d, want %d", got.TotalDuration, want)
+		}
+	})
+
+	t.Run("fallback to straight lines", func(t *testing.T) {
+		gis, _ := newTestGISService(t, http.StatusServiceUnavailable, `{}`)
+		profile := TransportProfileFor(TransportWalking)
+		got := gis.EstimateRoute(routingPoints, profile)
+
+		distance := int(calculateDistance(routingPoints[0].Lat, routingPoints[0].Lon, routingPoints[1].Lat, routingPoints[1].Lon)) +
+			int(calculateDistance(routingPoints[1].Lat, routingPoints[1].Lon, routingPoints[2].Lat, routingPoints[2].Lon))
+		if got.TotalDistance != distance {
+			t.Errorf("TotalDistance = %d, want %d", got.TotalDistance, distance)
+		}
+		if got.TotalDuration != profile.TravelSeconds(float64(distance)) {
+			t.Errorf("TotalDuration = %d, want %d", got.TotalDuration, profile.TravelSeconds(float64(distance)))
+		}
+		if len(got.Geometry) != len(routingPoints) {
+			t.Errorf("geometry has %d points, want %d", len(got.Geometry), len(routingPoints))
+		}
+	})
+}
+
+func TestParseWKTLineString(t *testing.T) {
+	tests := []struct {
+		wkt     string
+		want    [][]float64
+		wantErr bool
+	}{
+		{wkt: "LINESTRING(37.1 55.1, 37.2 55.2)", want: [][]float64{{37.1, 55.1}, {37.2, 55.2}}},
+		{wkt: " LINESTRING (37.1 55.1,37.2 55.2 140) ", want: [][]float64{{37.1, 55.1}, {37.2, 55.2}}},
+		{wkt: "linestring(37.1 55.1)", want: [][]float64{{37.1, 55.1}}},
+		{wkt: "POINT(37.1 55.1)", wantErr: true},
+		{wkt: "LINESTRING(37.1)", wantErr: true},
+		{wkt: "LINESTRING(37.1 55.1", wantErr: true},
+		{wkt: "LINESTRING(a b)", wantErr: true},
+		{wkt: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseWKTLineString(tt.wkt)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseWKTLineString(%q) err = %v, wantErr %v", tt.wkt, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseWKTLineString(%q) = %v, want %v", tt.wkt, got, tt.want)
+		}
+	}
+}
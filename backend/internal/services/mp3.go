@@ -0,0 +1,127 @@
+package services
+
+import "encoding/binary"
+
+// Таблицы MPEG Audio Layer III: битрейт (кбит/с) по индексу и частота дискретизации
+var (
+	mp3BitratesV1 = [16]int{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0}
+	mp3BitratesV2 = [16]int{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0}
+	mp3SampleRate = map[byte][3]int{
+		3: {44100, 48000, 32000}, // MPEG 1
+		2: {22050, 24000, 16000}, // MPEG 2
+		0: {11025, 12000, 8000},  // MPEG 2.5
+	}
+)
+
+// MP3Duration считает длительность MP3 в секундах, суммируя кадры Layer III
+// (подходит и для CBR, и для VBR). Если первый кадр - заголовок Xing/Info с числом кадров,
+// длительность берется из него. false - в данных не нашлось ни одного целого кадра.
+func MP3Duration(data []byte) (float64, bool) {
+	offset := 0
+
+	// Тег ID3v2 в начале файла: 10 байт заголовка + размер в syncsafe-формате
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := int(data[6]&0x7f)<<21 | int(data[7]&0x7f)<<14 | int(data[8]&0x7f)<<7 | int(data[9]&0x7f)
+		offset = 10 + size
+		if data[5]&0x10 != 0 {
+			offset += 10 // футер
+		}
+	}
+
+	var seconds float64
+	frames := 0
+	for offset+4 <= len(data) {
+		length, samples, sampleRate := mp3Frame(data[offset : offset+4])
+		if length == 0 {
+			// Не заголовок кадра - ищем следующую синхронизацию
+			offset++
+			continue
+		}
+		if offset+length > len(data) {
+			// Обрезанный последний кадр не учитываем
+			break
+		}
+
+		if frames == 0 && seconds == 0 {
+			if count, ok := mp3XingFrames(data[offset : offset+length]); ok {
+				if count > 0 {
+					return float64(count) * float64(samples) / float64(sampleRate), true
+				}
+				// Числа кадров в заголовке нет - считаем дальше, пропустив сам заголовок (он без звука)
+				offset += length
+				continue
+			}
+		}
+
+		seconds += float64(samples) / float64(sampleRate)
+		frames++
+		offset += length
+	}
+
+	return seconds, frames > 0
+}
+
+// mp3Frame разбирает заголовок кадра Layer III: длина кадра в байтах, число сэмплов и частота.
+// Для не-кадра возвращает нулевую длину.
+func mp3Frame(header []byte) (length, samples, sampleRate int) {
+	if header[0] != 0xff || header[1]&0xe0 != 0xe0 {
+		return 0, 0, 0
+	}
+
+	version := header[1] >> 3 & 0x03
+	layer := header[1] >> 1 & 0x03
+	bitrateIndex := header[2] >> 4
+	sampleRateIndex := header[2] >> 2 & 0x03
+	padding := int(header[2] >> 1 & 0x01)
+
+	rates, ok := mp3SampleRate[version]
+	if !ok || layer != 1 || sampleRateIndex == 3 {
+		return 0, 0, 0
+	}
+	sampleRate = rates[sampleRateIndex]
+
+	if version == 3 {
+		bitrate := mp3BitratesV1[bitrateIndex] * 1000
+		if bitrate == 0 {
+			return 0, 0, 0
+		}
+		return 144*bitrate/sampleRate + padding, 1152, sampleRate
+	}
+
+	bitrate := mp3BitratesV2[bitrateIndex] * 1000
+	if bitrate == 0 {
+		return 0, 0, 0
+	}
+	return 72*bitrate/sampleRate + padding, 576, sampleRate
+}
+
+// mp3XingFrames ищет в кадре заголовок Xing/Info (его пишут кодеры VBR) и возвращает число кадров
+// из него (0 - если число не указано). false - кадр обычный.
+func mp3XingFrames(frame []byte) (int, bool) {
+	// Заголовок лежит сразу за side info, размер которой зависит от версии и числа каналов
+	version := frame[1] >> 3 & 0x03
+	mono := frame[3]>>6 == 3
+	sideInfo := 32
+	switch {
+	case version == 3 && mono:
+		sideInfo = 17
+	case version != 3 && mono:
+		sideInfo = 9
+	case version != 3:
+		sideInfo = 17
+	}
+
+	tag := 4 + sideInfo
+	if len(frame) < tag+8 {
+		return 0, false
+	}
+	if id := string(frame[tag : tag+4]); id != "Xing" && id != "Info" {
+		return 0, false
+	}
+
+	flags := binary.BigEndian.Uint32(frame[tag+4 : tag+8])
+	if flags&0x01 == 0 || len(frame) < tag+12 {
+		return 0, true
+	}
+	return int(binary.BigEndian.Uint32(frame[tag+8 : tag+12])), true
+}
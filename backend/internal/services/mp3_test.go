@@ -0,0 +1,103 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// Заголовки кадров: MPEG 1 Layer III 128 кбит/с 44,1 кГц стерео (417 байт, 1152 сэмпла)
+// и MPEG 2 Layer III 64 кбит/с 22,05 кГц (208 байт, 576 сэмплов)
+var (
+	mp3HeaderV1 = []byte{0xff, 0xfb, 0x90, 0x00}
+	mp3HeaderV2 = []byte{0xff, 0xf3, 0x80, 0x00}
+)
+
+const (
+	mp3FrameV1Seconds = 1152.0 / 44100
+	mp3FrameV2Seconds = 576.0 / 22050
+)
+
+// mp3Frames - count кадров с заголовком header и тишиной вместо звука
+func mp3Frames(header []byte, count int) []byte {
+	length, _, _ := mp3Frame(header)
+	frame := make([]byte, length)
+	copy(frame, header)
+	return bytes.Repeat(frame, count)
+}
+
+// id3Tag - тег ID3v2 с телом size байт (размер в syncsafe-формате)
+func id3Tag(size int, footer bool) []byte {
+	tag := []byte{'I', 'D', '3', 4, 0, 0,
+		byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+	if footer {
+		tag[5] = 0x10
+	}
+	tag = append(tag, bytes.Repeat([]byte{0xff}, size)...)
+	if footer {
+		tag = append(tag, '3', 'D', 'I', 4, 0, 0x10, tag[6], tag[7], tag[8], tag[9])
+	}
+	return tag
+}
+
+// xingFrame - первый кадр VBR-файла с заголовком id ("Xing" или "Info") и числом кадров frames (<0 - без числа)
+func xingFrame(id string, frames int) []byte {
+	frame := mp3Frames(mp3HeaderV1, 1)
+	tag := 4 + 32
+	copy(frame[tag:], id)
+	if frames >= 0 {
+		binary.BigEndian.PutUint32(frame[tag+4:], 0x01)
+		binary.BigEndian.PutUint32(frame[tag+8:], uint32(frames))
+	}
+	return frame
+}
+
+func joinMP3(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestMP3Duration(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		want   float64
+		wantOK bool
+	}{
+		{"MPEG 1 frames", mp3Frames(mp3HeaderV1, 100), 100 * mp3FrameV1Seconds, true},
+		{"MPEG 2 frames", mp3Frames(mp3HeaderV2, 50), 50 * mp3FrameV2Seconds, true},
+		{"ID3v2 tag", joinMP3(id3Tag(300, false), mp3Frames(mp3HeaderV1, 10)), 10 * mp3FrameV1Seconds, true},
+		{"ID3v2 tag with footer", joinMP3(id3Tag(64, true), mp3Frames(mp3HeaderV1, 10)), 10 * mp3FrameV1Seconds, true},
+		// Тело тега из 0xff не должно приниматься за кадры
+		{"ID3v2 tag only", id3Tag(1000, false), 0, false},
+		{"garbage before frames", joinMP3([]byte("junk data"), mp3Frames(mp3HeaderV1, 3)), 3 * mp3FrameV1Seconds, true},
+		{"Xing frame count", joinMP3(xingFrame("Xing", 1000), mp3Frames(mp3HeaderV1, 2)), 1000 * mp3FrameV1Seconds, true},
+		{"Info frame count", joinMP3(id3Tag(20, false), xingFrame("Info", 40), mp3Frames(mp3HeaderV1, 40)), 40 * mp3FrameV1Seconds, true},
+		// Без числа кадров заголовок пропускается как кадр без звука
+		{"Xing without frame count", joinMP3(xingFrame("Xing", -1), mp3Frames(mp3HeaderV1, 5)), 5 * mp3FrameV1Seconds, true},
+		{"truncated last frame", mp3Frames(mp3HeaderV1, 3)[:3*417-100], 2 * mp3FrameV1Seconds, true},
+		{"truncated single frame", mp3Frames(mp3HeaderV1, 1)[:200], 0, false},
+		{"truncated header", mp3HeaderV1[:3], 0, false},
+		{"truncated ID3 header", []byte("ID3\x04\x00"), 0, false},
+		{"ID3 size past the end", []byte("ID3\x04\x00\x00\x7f\x7f\x7f\x7f"), 0, false},
+		{"empty", nil, 0, false},
+		{"text", []byte("<html>Service unavailable</html>"), 0, false},
+		{"zeros", make([]byte, 4096), 0, false},
+		{"all sync bits", bytes.Repeat([]byte{0xff}, 4096), 0, false},
+		{"bad bitrate index", []byte{0xff, 0xfb, 0xf0, 0x00, 0, 0, 0, 0}, 0, false},
+		{"bad sample rate index", []byte{0xff, 0xfb, 0x9c, 0x00, 0, 0, 0, 0}, 0, false},
+		{"layer II frame", []byte{0xff, 0xfd, 0x90, 0x00, 0, 0, 0, 0}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := MP3Duration(tt.data)
+			if ok != tt.wantOK {
+				t.Fatalf("MP3Duration ok = %v, want %v (duration %v)", ok, tt.wantOK, got)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("MP3Duration = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
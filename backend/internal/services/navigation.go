@@ -0,0 +1,77 @@
+package services
+
+import "math"
+
+// PathPosition - положение точки относительно линии маршрута
+type PathPosition struct {
+	Distance float64    // расстояние до линии, м
+	Along    float64    // пройдено вдоль линии до ближайшей ее точки, м
+	Length   float64    // длина всей линии, м
+	Nearest  RoutePoint // ближайшая точка линии
+}
+
+// ProjectOnPath находит ближайшую к точке позицию на ломаной. Отрезки короткие,
+// поэтому каждый проецируется на плоскость (равнопромежуточная проекция у его начала).
+func ProjectOnPath(path []RoutePoint, lat, lon float64) PathPosition {
+	if len(path) == 0 {
+		return PathPosition{}
+	}
+
+	best := PathPosition{
+		Distance: calculateDistance(lat, lon, path[0].Lat, path[0].Lon),
+		Nearest:  path[0],
+	}
+	along := 0.0
+	for i := 1; i < len(path); i++ {
+		a, b := path[i-1], path[i]
+		segment := calculateDistance(a.Lat, a.Lon, b.Lat, b.Lon)
+
+		// Координаты в метрах относительно начала отрезка
+		scale := math.Cos(a.Lat * math.Pi / 180)
+		bx, by := (b.Lon-a.Lon)*scale*metersPerDegree, (b.Lat-a.Lat)*metersPerDegree
+		px, py := (lon-a.Lon)*scale*metersPerDegree, (lat-a.Lat)*metersPerDegree
+
+		t := 0.0
+		if lengthSq := bx*bx + by*by; lengthSq > 0 {
+			t = math.Max(0, math.Min(1, (px*bx+py*by)/lengthSq))
+		}
+		nearest := RoutePoint{Lat: a.Lat + (b.Lat-a.Lat)*t, Lon: a.Lon + (b.Lon-a.Lon)*t}
+
+		if distance := calculateDistance(lat, lon, nearest.Lat, nearest.Lon); distance < best.Distance {
+			best.Distance = distance
+			best.Along = along + segment*t
+			best.Nearest = nearest
+		}
+		along += segment
+	}
+	best.Length = along
+
+	return best
+}
+
+// metersPerDegree - длина градуса меридиана, м
+const metersPerDegree = 111320
+
+// Bearing - азимут направления из первой точки во вторую, градусы от севера по часовой стрелке [0, 360)
+func Bearing(lat1, lon1, lat2, lon2 float64) float64 {
+	lat1Rad := lat1 * math.Pi / 180
+	lat2Rad := lat2 * math.Pi / 180
+	deltaLon := (lon2 - lon1) * math.Pi / 180
+
+	y := math.Sin(deltaLon) * math.Cos(lat2Rad)
+	x := math.Cos(lat1Rad)*math.Sin(lat2Rad) - math.Sin(lat1Rad)*math.Cos(lat2Rad)*math.Cos(deltaLon)
+
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360)
+}
+
+// RelativeBearing - поворот от курса к направлению, градусы (-180, 180]: плюс - направо, минус - налево
+func RelativeBearing(heading, bearing float64) float64 {
+	turn := math.Mod(bearing-heading, 360)
+	switch {
+	case turn > 180:
+		turn -= 360
+	case turn <= -180:
+		turn += 360
+	}
+	return turn
+}
@@ -0,0 +1,166 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProjectOnPath(t *testing.T) {
+	a := RoutePoint{Lat: 55.75, Lon: 37.60}
+	b := RoutePoint{Lat: 55.75, Lon: 37.61}
+	c := RoutePoint{Lat: 55.76, Lon: 37.61}
+	ab := calculateDistance(a.Lat, a.Lon, b.Lat, b.Lon)
+	bc := calculateDistance(b.Lat, b.Lon, c.Lat, c.Lon)
+	mid := RoutePoint{Lat: a.Lat, Lon: (a.Lon + b.Lon) / 2}
+
+	// Точка на 100 м севернее середины AB
+	north := a.Lat + 100.0/metersPerDegree
+
+	tests := []struct {
+		name     string
+		path     []RoutePoint
+		lat, lon float64
+		want     PathPosition
+	}{
+		{
+			name: "empty path",
+			lat:  a.Lat, lon: a.Lon,
+			want: PathPosition{},
+		},
+		{
+			name: "single point",
+			path: []RoutePoint{a},
+			lat:  north, lon: a.Lon,
+			want: PathPosition{Distance: 100, Nearest: a},
+		},
+		{
+			name: "beside segment middle",
+			path: []RoutePoint{a, b},
+			lat:  north, lon: mid.Lon,
+			want: PathPosition{Distance: 100, Along: ab / 2, Length: ab, Nearest: mid},
+		},
+		{
+			name: "before start",
+			path: []RoutePoint{a, b},
+			lat:  a.Lat, lon: a.Lon - 0.001,
+			want: PathPosition{Distance: calculateDistance(a.Lat, a.Lon-0.001, a.Lat, a.Lon), Length: ab, Nearest: a},
+		},
+		{
+			name: "past end",
+			path: []RoutePoint{a, b},
+			lat:  b.Lat, lon: b.Lon + 0.001,
+			want: PathPosition{Distance: calculateDistance(b.Lat, b.Lon+0.001, b.Lat, b.Lon), Along: ab, Length: ab, Nearest: b},
+		},
+		{
+			name: "second segment",
+			path: []RoutePoint{a, b, c},
+			lat:  (b.Lat + c.Lat) / 2, lon: b.Lon,
+			want: PathPosition{Along: ab + bc/2, Length: ab + bc, Nearest: RoutePoint{Lat: (b.Lat + c.Lat) / 2, Lon: b.Lon}},
+		},
+		{
+			name: "zero-length segment at start",
+			path: []RoutePoint{a, a, b},
+			lat:  north, lon: mid.Lon,
+			want: PathPosition{Distance: 100, Along: ab / 2, Length: ab, Nearest: mid},
+		},
+		{
+			name: "zero-length segment in the middle",
+			path: []RoutePoint{a, b, b, c},
+			lat:  c.Lat, lon: c.Lon,
+			want: PathPosition{Along: ab + bc, Length: ab + bc, Nearest: c},
+		},
+		{
+			name: "zero-length segment at end",
+			path: []RoutePoint{a, b, b},
+			lat:  b.Lat, lon: b.Lon + 0.001,
+			want: PathPosition{Distance: calculateDistance(b.Lat, b.Lon+0.001, b.Lat, b.Lon), Along: ab, Length: ab, Nearest: b},
+		},
+		{
+			name: "path of repeated point",
+			path: []RoutePoint{a, a, a},
+			lat:  north, lon: a.Lon,
+			want: PathPosition{Distance: 100, Nearest: a},
+		},
+	}
+
+	const tolerance = 0.5 // м
+	const degreeTolerance = tolerance / metersPerDegree
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ProjectOnPath(tt.path, tt.lat, tt.lon)
+			if math.IsNaN(got.Distance) || math.IsNaN(got.Along) || math.IsNaN(got.Nearest.Lat) || math.IsNaN(got.Nearest.Lon) {
+				t.Fatalf("ProjectOnPath = %+v, contains NaN", got)
+			}
+			if math.Abs(got.Distance-tt.want.Distance) > tolerance ||
+				math.Abs(got.Along-tt.want.Along) > tolerance ||
+				math.Abs(got.Length-tt.want.Length) > tolerance ||
+				math.Abs(got.Nearest.Lat-tt.want.Nearest.Lat) > degreeTolerance ||
+				math.Abs(got.Nearest.Lon-tt.want.Nearest.Lon) > degreeTolerance {
+				t.Errorf("ProjectOnPath = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"north", 55, 37, 56, 37, 0},
+		{"east on equator", 0, 37, 0, 38, 90},
+		{"south", 56, 37, 55, 37, 180},
+		{"west on equator", 0, 38, 0, 37, 270},
+		{"just west of north", 55, 37, 56, 36.9999, 359.9968},
+		{"same point", 55, 37, 55, 37, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Bearing(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			if got < 0 || got >= 360 {
+				t.Fatalf("Bearing = %v, want within [0, 360)", got)
+			}
+			if math.Abs(got-tt.want) > 0.001 {
+				t.Errorf("Bearing = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRelativeBearing(t *testing.T) {
+	tests := []struct {
+		heading, bearing float64
+		want             float64
+	}{
+		{0, 0, 0},
+		{0, 360, 0},
+		{360, 0, 0},
+		{360, 360, 0},
+		{0, 90, 90},
+		{0, 270, -90},
+		{350, 10, 20},
+		{10, 350, -20},
+		{359.5, 0, 0.5},
+		{0, 359.5, -0.5},
+		{0, 180, 180},
+		{180, 0, 180},
+		{90, 270, 180},
+		{270, 90, 180},
+		{720, 10, 10},
+		{-90, 90, 180},
+	}
+
+	for _, tt := range tests {
+		got := RelativeBearing(tt.heading, tt.bearing)
+		if got <= -180 || got > 180 {
+			t.Errorf("RelativeBearing(%v, %v) = %v, want within (-180, 180]", tt.heading, tt.bearing, got)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("RelativeBearing(%v, %v) = %v, want %v", tt.heading, tt.bearing, got, tt.want)
+		}
+	}
+}
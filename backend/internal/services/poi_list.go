@@ -0,0 +1,268 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultPOIPageSize = 50
+	maxPOIPageSize     = 200
+)
+
+// Сортировки списка мест: колонка и порядок по умолчанию
+var poiSorts = map[string]struct {
+	column string
+	desc   bool
+}{
+	"importance": {"importance", true},
+	"name":       {"name", false},
+	"year":       {"year_built", false},
+	"distance":   {"", false}, // выражение строится от точки запроса
+}
+
+// poiCursor - позиция в списке: значение ключа сортировки и ID последнего места.
+// Сортировка и порядок сохраняются, чтобы курсор нельзя было применить к другому запросу.
+type poiCursor struct {
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"d"`
+	Value interface{} `json:"v"`
+	ID    string      `json:"id"`
+}
+
+// poiRow - место со значением ключа сортировки по расстоянию
+type poiRow struct {
+	models.POI   `gorm:"embedded"`
+	SortDistance float64
+}
+
+// List возвращает страницу публичных мест с фильтрами, сортировкой и курсорной пагинацией
+func (s *POIService) List(q models.POIListQuery) (*models.POIList, error) {
+	sortName := q.Sort
+	if sortName == "" {
+		sortName = "importance"
+	}
+	sort := poiSorts[sortName]
+	desc := sort.desc
+	if q.Order != "" {
+		desc = q.Order == "desc"
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > maxPOIPageSize {
+		limit = defaultPOIPageSize
+	}
+
+	hasPoint := q.Lat != nil && q.Lon != nil
+	if (sortName == "distance" || q.Radius > 0) && !hasPoint {
+		return nil, validationError("lat and lon are required for distance sorting and radius filter")
+	}
+
+	query, err := s.filterPOIs(q)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count POIs: %w", err)
+	}
+
+	// Ключ сортировки: колонка или расстояние до точки запроса
+	key := sort.column
+	var keyArgs []interface{}
+	query = query.Select("pois.*")
+	if hasPoint {
+		distance, args := distanceExpr(*q.Lat, *q.Lon)
+		query = query.Select("pois.*, "+distance+" AS sort_distance", args...)
+		if sortName == "distance" {
+			key, keyArgs = distance, args
+		}
+	}
+
+	if q.Cursor != "" {
+		cursor, err := decodePOICursor(q.Cursor)
+		if err != nil || cursor.Sort != sortName || cursor.Desc != desc {
+			return nil, validationError("invalid cursor")
+		}
+		op := ">"
+		if desc {
+			op = "<"
+		}
+		args := append(append([]interface{}{}, keyArgs...), cursor.Value)
+		args = append(args, keyArgs...)
+		args = append(args, cursor.Value, cursor.ID)
+		query = query.Where(fmt.Sprintf("((%s %s ?) OR (%s = ? AND pois.id > ?))", key, op, key), args...)
+	}
+
+	direction := "ASC"
+	if desc {
+		direction = "DESC"
+	}
+	query = query.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                key + " " + direction + ", pois.id ASC",
+		Vars:               keyArgs,
+		WithoutParentheses: true,
+	}})
+
+	var rows []poiRow
+	if err := query.Limit(limit + 1).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query POIs: %w", err)
+	}
+
+	result := &models.POIList{Items: make([]models.POI, 0, limit), Total: total}
+	for i, row := range rows {
+		if i == limit {
+			break
+		}
+		result.Items = append(result.Items, row.POI)
+	}
+
+	if len(rows) > limit {
+		last := rows[limit-1]
+		var value interface{}
+		switch sortName {
+		case "importance":
+			value = last.Importance
+		case "name":
+			value = last.Name
+		case "year":
+			value = last.YearBuilt
+		case "distance":
+			value = last.SortDistance
+		}
+		result.NextCursor = encodePOICursor(poiCursor{Sort: sortName, Desc: desc, Value: value, ID: last.ID.String()})
+	}
+
+	return result, nil
+}
+
+// filterPOIs применяет фильтры списка к публичным местам
+func (s *POIService) filterPOIs(q models.POIListQuery) (*gorm.DB, error) {
+	query := s.db.Model(&models.POI{}).Where("visibility = ?", models.POIVisibilityPublic)
+
+	if epochs := splitValues(q.Epochs); len(epochs) > 0 {
+		query = query.Where("epoch IN ?", epochs)
+	}
+	if categories := splitValues(q.Categories); len(categories) > 0 {
+		query = query.Where("category IN ?", categories)
+	}
+	if styles := splitValues(q.Styles); len(styles) > 0 {
+		for i := range styles {
+			styles[i] = strings.ToLower(styles[i])
+		}
+		query = query.Where("LOWER(style) IN ?", styles)
+	}
+	if architects := splitValues(q.Architects); len(architects) > 0 {
+		conditions := make([]string, len(architects))
+		args := make([]interface{}, len(architects))
+		for i, architect := range architects {
+			conditions[i] = "architect ILIKE ?"
+			args[i] = "%" + escapeLike(architect) + "%"
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+
+	if q.YearFrom > 0 {
+		query = query.Where("year_built >= ?", q.YearFrom)
+	}
+	if q.YearTo > 0 {
+		query = query.Where("year_built > 0 AND year_built <= ?", q.YearTo)
+	}
+	if q.MinImportance > 0 {
+		query = query.Where("importance >= ?", q.MinImportance)
+	}
+
+	if q.BBox != "" {
+		minLon, minLat, maxLon, maxLat, err := parseBBox(q.BBox)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("longitude BETWEEN ? AND ? AND latitude BETWEEN ? AND ?", minLon, maxLon, minLat, maxLat)
+	}
+
+	if q.Radius > 0 && q.Lat != nil && q.Lon != nil {
+		distance, args := distanceExpr(*q.Lat, *q.Lon)
+		query = query.Where(distance+" <= ?", append(args, q.Radius)...)
+	}
+
+	return query, nil
+}
+
+// distanceExpr - расстояние от точки до места в метрах (формула Haversine на стороне Postgres)
+func distanceExpr(lat, lon float64) (string, []interface{}) {
+	return "(6371000 * 2 * ASIN(SQRT(POWER(SIN(RADIANS(latitude - ?) / 2), 2) + " +
+			"COS(RADIANS(?)) * COS(RADIANS(latitude)) * POWER(SIN(RADIANS(longitude - ?) / 2), 2))))",
+		[]interface{}{lat, lat, lon}
+}
+
+// parseBBox разбирает bbox в формате minLon,minLat,maxLon,maxLat
+func parseBBox(value string) (minLon, minLat, maxLon, maxLat float64, err error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != 4 {
+		return 0, 0, 0, 0, validationError("bbox must be minLon,minLat,maxLon,maxLat")
+	}
+
+	var coords [4]float64
+	for i, part := range parts {
+		coords[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return 0, 0, 0, 0, validationError("bbox must contain numbers")
+		}
+	}
+
+	minLon, minLat, maxLon, maxLat = coords[0], coords[1], coords[2], coords[3]
+	if minLon > maxLon || minLat > maxLat {
+		return 0, 0, 0, 0, validationError("bbox min values must not exceed max values")
+	}
+	return minLon, minLat, maxLon, maxLat, nil
+}
+
+// splitValues объединяет повторяющиеся параметры и значения через запятую
+func splitValues(values []string) []string {
+	var result []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				result = append(result, part)
+			}
+		}
+	}
+	return result
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func encodePOICursor(cursor poiCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePOICursor(value string) (*poiCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor poiCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	if cursor.Value == nil {
+		return nil, fmt.Errorf("incomplete cursor")
+	}
+	if _, err := uuid.Parse(cursor.ID); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultSearchPageSize   = 20
+	maxSearchPageSize       = 50
+	defaultAutocompleteSize = 10
+	maxAutocompleteSize     = 20
+
+	// Порог сходства триграмм для запросов с опечатками
+	searchSimilarityThreshold = 0.3
+
+	// Маркеры подсветки ts_headline (символы из области частного использования Unicode):
+	// текст экранируется уже после подсветки, затем маркеры заменяются на <mark>
+	highlightStart = "\uE000"
+	highlightStop  = "\uE001"
+)
+
+var (
+	snippetOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop +
+		", MaxWords=30, MinWords=12, MaxFragments=2, FragmentDelimiter=\" … \""
+	nameHighlightOptions = "StartSel=" + highlightStart + ", StopSel=" + highlightStop + ", HighlightAll=true"
+)
+
+// poiSearchRow - место с релевантностью и подсвеченными фрагментами
+type poiSearchRow struct {
+	models.POI    `gorm:"embedded"`
+	Score         float64
+	NameHighlight string
+	Snippet       string
+}
+
+// Search ищет публичные места по названию, архитектору, стилю и описанию.
+// Полнотекстовый поиск (русский и английский) дополняется триграммами по названию,
+// чтобы находить места с опечатками и в транслитерации (kreml -> кремль).
+func (s *POIService) Search(q models.POISearchQuery) (*models.POISearchList, error) {
+	text := strings.TrimSpace(q.Query)
+	if text == "" {
+		return nil, validationError("search query is empty")
+	}
+
+	limit := q.Limit
+	if limit <= 0 || limit > maxSearchPageSize {
+		limit = defaultSearchPageSize
+	}
+
+	variants := queryVariants(text)
+	tsQuery, tsArgs := searchTSQuery(variants)
+	similarity, simArgs := nameSimilarityExpr(variants)
+
+	query := s.db.Model(&models.POI{}).
+		Where("visibility = ?", models.POIVisibilityPublic).
+		Where("(search_vector @@ "+tsQuery+" OR "+similarity+" > ?)",
+			append(append(append([]interface{}{}, tsArgs...), simArgs...), searchSimilarityThreshold)...)
+
+	if epochs := splitValues(q.Epochs); len(epochs) > 0 {
+		query = query.Where("epoch IN ?", epochs)
+	}
+	if categories := splitValues(q.Categories); len(categories) > 0 {
+		query = query.Where("category IN ?", categories)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	// Релевантность: полнотекстовый ранг (вес названия выше описания) плюс сходство названия
+	score := "(ts_rank_cd(search_vector, " + tsQuery + ") + " + similarity + ")"
+	selectArgs := append(append([]interface{}{}, tsArgs...), simArgs...)
+	selectArgs = append(selectArgs, tsArgs...)
+	selectArgs = append(selectArgs, nameHighlightOptions)
+	selectArgs = append(selectArgs, tsArgs...)
+	selectArgs = append(selectArgs, snippetOptions)
+
+	query = query.Select("pois.*, "+score+" AS score, "+
+		"ts_headline('russian', name, "+tsQuery+", ?) AS name_highlight, "+
+		"ts_headline('russian', coalesce(description, ''), "+tsQuery+", ?) AS snippet", selectArgs...).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "score DESC, importance DESC, pois.id ASC",
+			WithoutParentheses: true,
+		}})
+
+	var rows []poiSearchRow
+	if err := query.Limit(limit).Offset(q.Offset).Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to search POIs: %w", err)
+	}
+
+	result := &models.POISearchList{Items: make([]models.POISearchResult, 0, len(rows)), Total: total}
+	for _, row := range rows {
+		result.Items = append(result.Items, models.POISearchResult{
+			POI:           row.POI,
+			Score:         row.Score,
+			NameHighlight: renderHighlight(row.NameHighlight),
+			Snippet:       renderHighlight(row.Snippet),
+		})
+	}
+
+	return result, nil
+}
+
+// Autocomplete подсказывает места по началу названия или началу любого слова в нем
+func (s *POIService) Autocomplete(prefix string, limit int) ([]models.POIAutocompleteItem, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return nil, validationError("search query is empty")
+	}
+	if limit <= 0 || limit > maxAutocompleteSize {
+		limit = defaultAutocompleteSize
+	}
+
+	variants := queryVariants(prefix)
+
+	var conditions []string
+	var args []interface{}
+	var startsWith []string
+	var startsArgs []interface{}
+	for _, variant := range variants {
+		pattern := escapeLike(variant) + "%"
+		conditions = append(conditions, "lower(name) LIKE ?")
+		args = append(args, pattern)
+		startsWith = append(startsWith, "lower(name) LIKE ?")
+		startsArgs = append(startsArgs, pattern)
+
+		if words := prefixTSQuery(variant); words != "" {
+			conditions = append(conditions, "to_tsvector('simple', name) @@ to_tsquery('simple', ?)")
+			args = append(args, words)
+		}
+	}
+
+	similarity, simArgs := nameSimilarityExpr(variants)
+	orderArgs := append(append([]interface{}{}, startsArgs...), simArgs...)
+
+	var items []models.POIAutocompleteItem
+	err := s.db.Model(&models.POI{}).
+		Select("id, name, epoch, category").
+		Where("visibility = ?", models.POIVisibilityPublic).
+		Where("("+strings.Join(conditions, " OR ")+")", args...).
+		Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "(" + strings.Join(startsWith, " OR ") + ") DESC, " + similarity + " DESC, importance DESC, name ASC",
+			Vars:               orderArgs,
+			WithoutParentheses: true,
+		}}).
+		Limit(limit).
+		Find(&items).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to autocomplete POIs: %w", err)
+	}
+
+	return items, nil
+}
+
+// searchTSQuery объединяет запросы на русском и английском для всех вариантов написания
+func searchTSQuery(variants []string) (string, []interface{}) {
+	parts := make([]string, 0, len(variants)*2)
+	args := make([]interface{}, 0, len(variants)*2)
+	for _, variant := range variants {
+		parts = append(parts, "websearch_to_tsquery('russian', ?)", "websearch_to_tsquery('english', ?)")
+		args = append(args, variant, variant)
+	}
+	return "(" + strings.Join(parts, " || ") + ")", args
+}
+
+// nameSimilarityExpr - лучшее триграммное сходство вариантов запроса с названием места
+func nameSimilarityExpr(variants []string) (string, []interface{}) {
+	parts := make([]string, len(variants))
+	args := make([]interface{}, len(variants))
+	for i, variant := range variants {
+		parts[i] = "word_similarity(?, lower(name))"
+		args[i] = strings.ToLower(variant)
+	}
+	return "GREATEST(" + strings.Join(parts, ", ") + ")", args
+}
+
+// prefixTSQuery строит запрос по началу слов: "крас пл" -> "крас:* & пл:*"
+func prefixTSQuery(text string) string {
+	var words []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words = append(words, word+":*")
+	}
+	return strings.Join(words, " & ")
+}
+
+// renderHighlight экранирует текст и заменяет маркеры ts_headline на <mark>
+func renderHighlight(text string) string {
+	text = html.EscapeString(text)
+	text = strings.ReplaceAll(text, highlightStart, "<mark>")
+	return strings.ReplaceAll(text, highlightStop, "</mark>")
+}
+
+// queryVariants - запрос как есть и в транслитерации на другую раскладку алфавита
+func queryVariants(text string) []string {
+	variants := []string{text}
+	seen := map[string]bool{strings.ToLower(text): true}
+
+	add := func(variant string) {
+		key := strings.ToLower(variant)
+		if variant != "" && !seen[key] {
+			seen[key] = true
+			variants = append(variants, variant)
+		}
+	}
+
+	if hasScript(text, unicode.Latin) {
+		add(latinToCyrillic(text))
+	}
+	if hasScript(text, unicode.Cyrillic) {
+		add(cyrillicToLatin(text))
+	}
+	return variants
+}
+
+func hasScript(text string, script *unicode.RangeTable) bool {
+	for _, r := range text {
+		if unicode.Is(script, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Транслитерация: сочетания проверяются раньше одиночных букв
+var latinDigraphs = []struct {
+	latin    string
+	cyrillic string
+}{
+	{"shch", "щ"}, {"sch", "щ"}, {"zh", "ж"}, {"kh", "х"}, {"ts", "ц"}, {"ch", "ч"},
+	{"sh", "ш"}, {"yu", "ю"}, {"ya", "я"}, {"yo", "ё"}, {"ye", "е"}, {"iy", "ий"},
+}
+
+var latinLetters = map[rune]string{
+	'a': "а", 'b': "б", 'c': "к", 'd': "д", 'e': "е", 'f': "ф", 'g': "г", 'h': "х",
+	'i': "и", 'j': "й", 'k': "к", 'l': "л", 'm': "м", 'n': "н", 'o': "о", 'p': "п",
+	'q': "к", 'r': "р", 's': "с", 't': "т", 'u': "у", 'v': "в", 'w': "в", 'x': "кс",
+	'y': "ы", 'z': "з",
+}
+
+var cyrillicLetters = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya",
+}
+
+// latinToCyrillic переводит латиницу в кириллицу (kreml -> кремл)
+func latinToCyrillic(text string) string {
+	lower := strings.ToLower(text)
+	var b strings.Builder
+
+	for i := 0; i < len(lower); {
+		matched := false
+		for _, d := range latinDigraphs {
+			if strings.HasPrefix(lower[i:], d.latin) {
+				b.WriteString(d.cyrillic)
+				i += len(d.latin)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(lower[i:])
+		if letter, ok := latinLetters[r]; ok {
+			b.WriteString(letter)
+		} else {
+			b.WriteRune(r)
+		}
+		i += size
+	}
+	return b.String()
+}
+
+// cyrillicToLatin переводит кириллицу в латиницу (кремль -> kreml)
+func cyrillicToLatin(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if letter, ok := cyrillicLetters[r]; ok {
+			b.WriteString(letter)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQueryVariants(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Кремль", []string{"Кремль", "kreml"}},
+		{"kreml", []string{"kreml", "кремл"}},
+		{"Tverskaya", []string{"Tverskaya", "тверская"}},
+		{"Red площадь", []string{"Red площадь", "ред площадь", "red ploshchad"}},
+		{"1812", []string{"1812"}},
+		{"", []string{""}},
+	}
+
+	for _, tt := range tests {
+		if got := queryVariants(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("queryVariants(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLatinToCyrillic(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"kreml", "кремл"},
+		{"KREML", "кремл"},
+		{"Shchusev", "щусев"},
+		{"Zhukovsky", "жуковскы"},
+		{"Yekaterinburg", "екатеринбург"},
+		{"Dostoevskiy", "достоевский"},
+		{"Alexander", "александер"},
+		{"Chistoprudny bulvar", "чистопрудны булвар"},
+		{"Tsaritsyno", "царицыно"},
+		{"Red Square, 1", "ред скуаре, 1"},
+		{"Кремль", "кремль"},
+	}
+
+	for _, tt := range tests {
+		if got := latinToCyrillic(tt.text); got != tt.want {
+			t.Errorf("latinToCyrillic(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCyrillicToLatin(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Кремль", "kreml"},
+		{"Щусев", "shchusev"},
+		{"Большой театр", "bolshoy teatr"},
+		{"Объект", "obekt"},
+		{"Ёлка", "yolka"},
+		{"Цирк на Цветном, 13", "tsirk na tsvetnom, 13"},
+		{"ГУМ", "gum"},
+		{"kreml", "kreml"},
+	}
+
+	for _, tt := range tests {
+		if got := cyrillicToLatin(tt.text); got != tt.want {
+			t.Errorf("cyrillicToLatin(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestRenderHighlight(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"plain", "Красная площадь", "Красная площадь"},
+		{"highlighted", highlightStart + "Красная" + highlightStop + " площадь", "<mark>Красная</mark> площадь"},
+		{"several fragments", highlightStart + "Кремль" + highlightStop + " … " + highlightStart + "кремля" + highlightStop,
+			"<mark>Кремль</mark> … <mark>кремля</mark>"},
+		// Разметка из описания места экранируется до вставки <mark>
+		{"markup in text", "<script>alert(1)</script> " + highlightStart + "собор" + highlightStop,
+			"&lt;script&gt;alert(1)&lt;/script&gt; <mark>собор</mark>"},
+		{"markup inside highlight", highlightStart + "<b>собор</b>" + highlightStop, "<mark>&lt;b&gt;собор&lt;/b&gt;</mark>"},
+		{"fake mark tag", "<mark onmouseover=\"x()\">собор</mark>", "&lt;mark onmouseover=&#34;x()&#34;&gt;собор&lt;/mark&gt;"},
+		{"entities and quotes", "Дом «Рога & копыта» 'Ltd'", "Дом «Рога &amp; копыта» &#39;Ltd&#39;"},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderHighlight(tt.text); got != tt.want {
+				t.Errorf("renderHighlight(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrefixTSQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"крас пл", "крас:* & пл:*"},
+		{"кремль", "кремль:*"},
+		{"Red-Square!", "Red:* & Square:*"},
+		// Операторы tsquery и кавычки из ввода не попадают в запрос
+		{"a & b | !c", "a:* & b:* & c:*"},
+		{"'); drop table pois; --", "drop:* & table:* & pois:*"},
+		{"дом 1812", "дом:* & 1812:*"},
+		{"  ", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := prefixTSQuery(tt.text); got != tt.want {
+			t.Errorf("prefixTSQuery(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
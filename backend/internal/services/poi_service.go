@@ -2,9 +2,12 @@ package services
 
 import (
 	"fmt"
+	"log"
 	"math"
+	"time"
 
 	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -22,9 +25,86 @@ func (s *POIService) FindNearby(
 	lat, lon, radiusMeters float64,
 	epochs, categories []string,
 ) ([]models.POI, error) {
+	pois, err := s.findCandidates(epochs, categories)
+	if err != nil {
+		return nil, err
+	}
+
+	// Фильтруем по расстоянию
+	var nearby []models.POI
+	for _, poi := range pois {
+		distance := calculateDistance(lat, lon, poi.Latitude, poi.Longitude)
+		if distance <= radiusMeters {
+			nearby = append(nearby, poi)
+		}
+	}
+
+	// Сортируем по важности
+	sortPOIsByImportance(nearby)
+
+	return nearby, nil
+}
+
+// FindInCorridor находит места между стартом и финишем: путь старт -> место -> финиш
+// не длиннее maxPathMeters (эллипс с фокусами в начале и конце маршрута)
+func (s *POIService) FindInCorridor(
+	startLat, startLon, endLat, endLon, maxPathMeters float64,
+	epochs, categories []string,
+) ([]models.POI, error) {
+	pois, err := s.findCandidates(epochs, categories)
+	if err != nil {
+		return nil, err
+	}
+
+	var corridor []models.POI
+	for _, poi := range pois {
+		path := calculateDistance(startLat, startLon, poi.Latitude, poi.Longitude) +
+			calculateDistance(poi.Latitude, poi.Longitude, endLat, endLon)
+		if path <= maxPathMeters {
+			corridor = append(corridor, poi)
+		}
+	}
+
+	sortPOIsByImportance(corridor)
+
+	return corridor, nil
+}
+
+// FindNearest находит ближайшее к точке публичное место не дальше toleranceMeters.
+// Возвращает nil, если такого нет, и расстояние до найденного места.
+func (s *POIService) FindNearest(lat, lon, toleranceMeters float64) (*models.POI, float64, error) {
+	// Предварительный отбор по прямоугольнику вокруг точки, точное расстояние - по формуле
+	dLat := toleranceMeters / metersPerDegree
+	dLon := dLat / math.Max(math.Cos(lat*math.Pi/180), 0.01)
+
 	var pois []models.POI
+	if err := s.db.Where("visibility = ?", models.POIVisibilityPublic).
+		Where("latitude BETWEEN ? AND ? AND longitude BETWEEN ? AND ?", lat-dLat, lat+dLat, lon-dLon, lon+dLon).
+		Find(&pois).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to query POIs: %w", err)
+	}
 
-	query := s.db.Model(&models.POI{})
+	var nearest *models.POI
+	best := toleranceMeters
+	for i := range pois {
+		distance := calculateDistance(lat, lon, pois[i].Latitude, pois[i].Longitude)
+		if distance <= best {
+			nearest = &pois[i]
+			best = distance
+		}
+	}
+	if nearest == nil {
+		return nil, 0, nil
+	}
+	return nearest, best, nil
+}
+
+// findCandidates загружает публичные места с фильтром по эпохам и категориям
+func (s *POIService) findCandidates(epochs, categories []string) ([]models.POI, error) {
+	var pois []models.POI
+
+	// Пользовательские места других маршрутов в подбор не попадают
+	query := s.db.Model(&models.POI{}).Where("visibility = ?", models.POIVisibilityPublic)
 
 	// Фильтр по эпохе
 	if len(epochs) > 0 {
@@ -41,19 +121,7 @@ func (s *POIService) FindNearby(
 		return nil, fmt.Errorf("failed to query POIs: %w", err)
 	}
 
-	// Фильтруем по расстоянию
-	var nearby []models.POI
-	for _, poi := range pois {
-		distance := calculateDistance(lat, lon, poi.Latitude, poi.Longitude)
-		if distance <= radiusMeters {
-			nearby = append(nearby, poi)
-		}
-	}
-
-	// Сортируем по важности
-	sortPOIsByImportance(nearby)
-
-	return nearby, nil
+	return pois, nil
 }
 
 // GetByID получает POI по ID
@@ -70,8 +138,95 @@ func (s *POIService) Create(poi *models.POI) error {
 	return s.db.Create(poi).Error
 }
 
+// AssignOwner привязывает пользовательские места к маршруту
+func (s *POIService) AssignOwner(poiIDs []uuid.UUID, routeID uuid.UUID) error {
+	if len(poiIDs) == 0 {
+		return nil
+	}
+	return s.db.Model(&models.POI{}).
+		Where("id IN ? AND visibility = ?", poiIDs, models.POIVisibilityPrivate).
+		Update("owner_route_id", routeID).Error
+}
+
+// Promote переносит пользовательское место в общий каталог
+func (s *POIService) Promote(id string, importance int, epoch, category string) (*models.POI, error) {
+	poi, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"visibility":     models.POIVisibilityPublic,
+		"owner_route_id": nil,
+	}
+	if importance > 0 {
+		updates["importance"] = importance
+	}
+	if epoch != "" {
+		updates["epoch"] = epoch
+	}
+	if category != "" {
+		updates["category"] = category
+	}
+
+	if err := s.db.Model(poi).Updates(updates).Error; err != nil {
+		return nil, fmt.Errorf("failed to promote POI: %w", err)
+	}
+
+	return s.GetByID(id)
+}
+
+// SetTriggerRadius задает радиус срабатывания рассказа о месте (0 - по умолчанию)
+func (s *POIService) SetTriggerRadius(id string, radius int) (*models.POI, error) {
+	poi, err := s.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(poi).Update("trigger_radius", radius).Error; err != nil {
+		return nil, fmt.Errorf("failed to update trigger radius: %w", err)
+	}
+
+	return s.GetByID(id)
+}
+
+// CleanupPrivate удаляет пользовательские места, на которые больше не ссылается ни одна точка:
+// маршрут удален (или так и не был создан) либо место убрано из маршрута при редактировании
+func (s *POIService) CleanupPrivate(gracePeriod time.Duration) (int64, error) {
+	result := s.db.
+		Where("visibility = ? AND created_at < ?", models.POIVisibilityPrivate, time.Now().Add(-gracePeriod)).
+		Where("NOT EXISTS (SELECT 1 FROM waypoints WHERE waypoints.poi_id = pois.id)").
+		Delete(&models.POI{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to cleanup private POIs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// RunPrivateCleanup периодически запускает CleanupPrivate (вызывать в отдельной горутине)
+func (s *POIService) RunPrivateCleanup(interval, gracePeriod time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.CleanupPrivate(gracePeriod)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Printf("Removed %d orphaned private POIs", deleted)
+		}
+	}
+}
+
 // Вспомогательные функции
 
+// Distance возвращает расстояние между двумя точками в метрах
+func Distance(lat1, lon1, lat2, lon2 float64) float64 {
+	return calculateDistance(lat1, lon1, lat2, lon2)
+}
+
 // calculateDistance вычисляет расстояние между двумя точками (формула Haversine)
 func calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	const earthRadius = 6371000.0 // метры
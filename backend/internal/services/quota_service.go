@@ -0,0 +1,220 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// quotaLimit - лимиты за период; 0 - без ограничения
+type quotaLimit struct {
+	waypoints  int64
+	characters int64
+}
+
+// QuotaExceededError - исчерпана квота на генерацию
+type QuotaExceededError struct {
+	Period   string // day или month
+	Resource string // waypoints или characters
+	Limit    int64
+	ResetAt  time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s quota exceeded: %d %s", e.Period, e.Limit, e.Resource)
+}
+
+func (e *QuotaExceededError) Is(target error) bool { return target == ErrQuotaExceeded }
+
+// QuotaService учитывает дневные и месячные квоты клиентов на генерацию:
+// число сгенерированных точек и символов, отправленных на синтез речи
+type QuotaService struct {
+	db     *gorm.DB
+	limits map[string]quotaLimit
+	// Оценка символов озвучки на точку: текст известен только после генерации
+	charactersPerWaypoint int64
+}
+
+func NewQuotaService(db *gorm.DB) *QuotaService {
+	return &QuotaService{
+		db: db,
+		limits: map[string]quotaLimit{
+			models.QuotaPeriodDay: {
+				waypoints:  int64(envInt("QUOTA_DAILY_WAYPOINTS", 100)),
+				characters: int64(envInt("QUOTA_DAILY_CHARACTERS", 300000)),
+			},
+			models.QuotaPeriodMonth: {
+				waypoints:  int64(envInt("QUOTA_MONTHLY_WAYPOINTS", 1500)),
+				characters: int64(envInt("QUOTA_MONTHLY_CHARACTERS", 4000000)),
+			},
+		},
+		charactersPerWaypoint: int64(envInt("QUOTA_CHARACTERS_PER_WAYPOINT", 2000)),
+	}
+}
+
+var quotaPeriods = []string{models.QuotaPeriodDay, models.QuotaPeriodMonth}
+
+// Reserve списывает точки с квоты клиента до начала генерации.
+// Символы озвучки известны только после генерации текста, поэтому здесь проверяется,
+// что в квоту символов укладывается оценка для этих точек, а списываются они в AddCharacters.
+// Пустой client - без учета.
+func (s *QuotaService) Reserve(client string, waypoints int) (*models.QuotaStatus, error) {
+	if client == "" {
+		return &models.QuotaStatus{Unlimited: true}, nil
+	}
+
+	now := time.Now().UTC()
+	var usages []models.QuotaUsage
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		usages, err = s.lockUsages(tx, client, now)
+		if err != nil {
+			return err
+		}
+
+		estimate := int64(waypoints) * s.charactersPerWaypoint
+		for _, usage := range usages {
+			limit := s.limits[usage.Period]
+			resetAt := periodEnd(usage.Period, usage.PeriodStart)
+			if limit.waypoints > 0 && usage.Waypoints+int64(waypoints) > limit.waypoints {
+				return &QuotaExceededError{Period: usage.Period, Resource: "waypoints", Limit: limit.waypoints, ResetAt: resetAt}
+			}
+			if limit.characters > 0 && usage.Characters+estimate > limit.characters {
+				return &QuotaExceededError{Period: usage.Period, Resource: "characters", Limit: limit.characters, ResetAt: resetAt}
+			}
+		}
+
+		for i := range usages {
+			usages[i].Waypoints += int64(waypoints)
+			if err := tx.Model(&usages[i]).UpdateColumn("waypoints", gorm.Expr("waypoints + ?", waypoints)).Error; err != nil {
+				return fmt.Errorf("failed to update quota usage: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.status(client, usages), nil
+}
+
+// Release возвращает на квоту точки, которые не были озвучены:
+// маршрут не создан, генерация не удалась или рассказ отклонен проверкой
+func (s *QuotaService) Release(client string, waypoints int) error {
+	if client == "" || waypoints <= 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		usages, err := s.lockUsages(tx, client, now)
+		if err != nil {
+			return err
+		}
+		for i := range usages {
+			// Точки могли быть списаны в прошлом периоде - ниже нуля не уходим
+			if err := tx.Model(&usages[i]).UpdateColumn("waypoints", gorm.Expr("GREATEST(waypoints - ?, 0)", waypoints)).Error; err != nil {
+				return fmt.Errorf("failed to update quota usage: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// AddCharacters учитывает символы, отправленные на синтез речи
+func (s *QuotaService) AddCharacters(client string, characters int) error {
+	if client == "" || characters <= 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		usages, err := s.lockUsages(tx, client, now)
+		if err != nil {
+			return err
+		}
+		for i := range usages {
+			if err := tx.Model(&usages[i]).UpdateColumn("characters", gorm.Expr("characters + ?", characters)).Error; err != nil {
+				return fmt.Errorf("failed to update quota usage: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// Status возвращает расход квот клиента в текущих периодах
+func (s *QuotaService) Status(client string) (*models.QuotaStatus, error) {
+	if client == "" {
+		return &models.QuotaStatus{Unlimited: true}, nil
+	}
+
+	now := time.Now().UTC()
+	usages := make([]models.QuotaUsage, 0, len(quotaPeriods))
+	for _, period := range quotaPeriods {
+		usage := models.QuotaUsage{Client: client, Period: period, PeriodStart: periodStart(period, now)}
+		err := s.db.Where("client = ? AND period = ? AND period_start = ?", client, period, usage.PeriodStart).
+			Limit(1).Find(&usage).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to query quota usage: %w", err)
+		}
+		usages = append(usages, usage)
+	}
+
+	return s.status(client, usages), nil
+}
+
+// lockUsages создает при необходимости и блокирует записи расхода за текущие день и месяц
+func (s *QuotaService) lockUsages(tx *gorm.DB, client string, now time.Time) ([]models.QuotaUsage, error) {
+	usages := make([]models.QuotaUsage, 0, len(quotaPeriods))
+	for _, period := range quotaPeriods {
+		usage := models.QuotaUsage{Client: client, Period: period, PeriodStart: periodStart(period, now)}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&usage).Error; err != nil {
+			return nil, fmt.Errorf("failed to create quota usage: %w", err)
+		}
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("client = ? AND period = ? AND period_start = ?", client, period, usage.PeriodStart).
+			First(&usage).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock quota usage: %w", err)
+		}
+		usages = append(usages, usage)
+	}
+	return usages, nil
+}
+
+func (s *QuotaService) status(client string, usages []models.QuotaUsage) *models.QuotaStatus {
+	status := &models.QuotaStatus{Client: client, Periods: make([]models.QuotaPeriodStatus, len(usages))}
+	for i, usage := range usages {
+		limit := s.limits[usage.Period]
+		status.Periods[i] = models.QuotaPeriodStatus{
+			Period:          usage.Period,
+			WaypointsUsed:   usage.Waypoints,
+			WaypointsLimit:  limit.waypoints,
+			CharactersUsed:  usage.Characters,
+			CharactersLimit: limit.characters,
+			ResetAt:         periodEnd(usage.Period, usage.PeriodStart),
+		}
+	}
+	return status
+}
+
+// periodStart - начало дня или месяца по UTC
+func periodStart(period string, now time.Time) time.Time {
+	if period == models.QuotaPeriodMonth {
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func periodEnd(period string, start time.Time) time.Time {
+	if period == models.QuotaPeriodMonth {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
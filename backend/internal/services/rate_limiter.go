@@ -0,0 +1,107 @@
+package services
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Корзины, которые давно не использовались и успели наполниться, удаляются
+const rateLimiterSweepInterval = 10 * time.Minute
+
+// RateLimiter - ограничение частоты запросов по алгоритму token bucket.
+// Корзины хранятся в памяти процесса: у каждой реплики свой лимит.
+type RateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	perMinute int
+	burst     int
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateLimitResult - решение лимитера для одного запроса
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int // запросов в минуту
+	Remaining  int
+	RetryAfter time.Duration // через сколько появится токен, если запрос отклонен
+}
+
+// NewRateLimiter создает лимитер с настройками из <prefix>_PER_MINUTE и <prefix>_BURST
+// (например RATE_LIMIT_PER_MINUTE). 0 в PER_MINUTE отключает ограничение.
+func NewRateLimiter(envPrefix string, defaultPerMinute, defaultBurst int) *RateLimiter {
+	perMinute := envInt(envPrefix+"_PER_MINUTE", defaultPerMinute)
+	burst := envInt(envPrefix+"_BURST", defaultBurst)
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		buckets:   make(map[string]*tokenBucket),
+		perMinute: perMinute,
+		burst:     burst,
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow списывает токен из корзины клиента
+func (l *RateLimiter) Allow(key string) RateLimitResult {
+	if l.perMinute <= 0 {
+		return RateLimitResult{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	rate := float64(l.perMinute) / 60 // токенов в секунду
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.burst), updated: now}
+		l.buckets[key] = bucket
+	} else {
+		bucket.tokens = math.Min(float64(l.burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*rate)
+		bucket.updated = now
+	}
+
+	if now.Sub(l.lastSweep) > rateLimiterSweepInterval {
+		l.sweep(now, rate)
+	}
+
+	result := RateLimitResult{Limit: l.perMinute}
+	if bucket.tokens < 1 {
+		result.RetryAfter = time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+		return result
+	}
+
+	bucket.tokens--
+	result.Allowed = true
+	result.Remaining = int(bucket.tokens)
+	return result
+}
+
+// sweep удаляет корзины, которые за время простоя наполнились до конца
+func (l *RateLimiter) sweep(now time.Time, rate float64) {
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.updated).Seconds()*rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// envInt читает целое число из переменной окружения
+func envInt(name string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidTransition - недопустимая смена статуса контента
+var ErrInvalidTransition = errors.New("invalid content status transition")
+
+// ReviewService реализует редакционную проверку сгенерированного контента
+type ReviewService struct {
+	db              *gorm.DB
+	ttsService      *TTSService
+	audioStore      AudioStore
+	requireApproval bool // отдавать в публичных маршрутах только одобренный контент
+}
+
+func NewReviewService(db *gorm.DB, tts *TTSService, store AudioStore) *ReviewService {
+	return &ReviewService{
+		db:              db,
+		ttsService:      tts,
+		audioStore:      store,
+		requireApproval: os.Getenv("CONTENT_REQUIRE_APPROVAL") == "true",
+	}
+}
+
+// IsServable сообщает, можно ли отдавать контент в публичных маршрутах
+func (s *ReviewService) IsServable(content *models.Content) bool {
+	if content == nil {
+		return false
+	}
+	if !s.requireApproval {
+		// Черновик не озвучен и не проверен - показывать нечего
+		return content.Status != models.ContentStatusRejected && content.Status != models.ContentStatusDraft
+	}
+	return content.Status == models.ContentStatusApproved
+}
+
+// poiContentRow - контент точки вместе с местом, о котором он рассказывает
+type poiContentRow struct {
+	models.Content `gorm:"embedded"`
+	POIID          uuid.UUID
+}
+
+// ServableByPOI - кэш рассказов: для каждого места последний допустимый к показу контент
+// с аудио, с любого маршрута, сгенерированный под длительность narrationSeconds.
+// Места без готового рассказа в ответ не попадают.
+func (s *ReviewService) ServableByPOI(poiIDs []uuid.UUID, narrationSeconds int) (map[uuid.UUID]models.Content, error) {
+	cached := make(map[uuid.UUID]models.Content, len(poiIDs))
+	if len(poiIDs) == 0 {
+		return cached, nil
+	}
+
+	var rows []poiContentRow
+	if err := s.db.Table("contents").
+		Select("contents.*, waypoints.poi_id").
+		Joins("JOIN waypoints ON waypoints.id = contents.waypoint_id").
+		Where("waypoints.poi_id IN ? AND contents.audio_key <> ''", poiIDs).
+		Where("contents.narration_seconds = ?", narrationSeconds).
+		Order("contents.created_at DESC").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to query cached content: %w", err)
+	}
+
+	for _, row := range rows {
+		if _, ok := cached[row.POIID]; ok || !s.IsServable(&row.Content) {
+			continue
+		}
+		cached[row.POIID] = row.Content
+	}
+	return cached, nil
+}
+
+// CopyContent копирует готовый рассказ в точку другого маршрута вместе с аудиофайлом.
+// У копии свой ключ в хранилище, поэтому удаление исходного маршрута ее не затрагивает.
+func (s *ReviewService) CopyContent(source models.Content, waypointID uuid.UUID) (*models.Content, error) {
+	reader, object, err := s.audioStore.Get(source.AudioKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio %s: %w", source.AudioKey, err)
+	}
+	defer reader.Close()
+
+	// Имя файла - хэш содержимого, поэтому версия аудио у копии та же
+	key := path.Join("waypoints", waypointID.String(), path.Base(source.AudioKey))
+	if err := s.audioStore.Put(key, reader, object.Size); err != nil {
+		return nil, fmt.Errorf("failed to copy audio %s: %w", source.AudioKey, err)
+	}
+
+	content := source
+	content.ID = uuid.Nil
+	content.WaypointID = waypointID
+	content.AudioKey = key
+	content.AudioURL = WaypointAudioURL(waypointID.String(), key)
+	content.CreatedAt = time.Time{}
+	content.UpdatedAt = time.Time{}
+
+	if err := s.db.Create(&content).Error; err != nil {
+		if err := s.audioStore.Delete(key); err != nil {
+			log.Printf("Warning: failed to remove audio %s: %v", key, err)
+		}
+		return nil, fmt.Errorf("failed to save content: %w", err)
+	}
+
+	return &content, nil
+}
+
+// List возвращает контент с указанным статусом (пустой статус - любой), новые сверху
+func (s *ReviewService) List(status string, limit, offset int) ([]models.Content, int64, error) {
+	query := s.db.Model(&models.Content{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count content: %w", err)
+	}
+
+	var contents []models.Content
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&contents).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to query content: %w", err)
+	}
+
+	return contents, total, nil
+}
+
+// Get получает контент по ID
+func (s *ReviewService) Get(id string) (*models.Content, error) {
+	var content models.Content
+	if err := s.db.First(&content, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// UpdateText заменяет текст, заново синтезирует аудио и возвращает контент на проверку
+func (s *ReviewService) UpdateText(id, text, editor string) (*models.Content, error) {
+	content, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	audioKey, duration, err := s.ttsService.GenerateAudio(text, content.WaypointID.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to synthesize audio: %w", err)
+	}
+
+	now := time.Now()
+	previousKey := content.AudioKey
+	content.Text = text
+	content.AudioKey = audioKey
+	content.AudioURL = WaypointAudioURL(content.WaypointID.String(), audioKey)
+	content.Duration = duration
+	content.Generated = true
+	content.Status = models.ContentStatusPendingReview
+	// Текст написан редактором - результаты автоматической проверки больше не актуальны
+	content.FactCheckVerdict = ""
+	content.FactCheckIssues = nil
+	content.ReviewedBy = editor
+	content.ReviewedAt = &now
+
+	if err := s.db.Save(content).Error; err != nil {
+		return nil, fmt.Errorf("failed to save content: %w", err)
+	}
+
+	// Старое аудио лежит под другим ключом - удаляем его
+	if previousKey != "" && previousKey != audioKey {
+		if err := s.audioStore.Delete(previousKey); err != nil {
+			log.Printf("Warning: failed to remove audio %s: %v", previousKey, err)
+		}
+	}
+
+	return content, nil
+}
+
+// Approve одобряет контент
+func (s *ReviewService) Approve(id, reviewer, comment string) (*models.Content, error) {
+	return s.setStatus(id, models.ContentStatusApproved, reviewer, comment)
+}
+
+// Reject отклоняет контент
+func (s *ReviewService) Reject(id, reviewer, comment string) (*models.Content, error) {
+	return s.setStatus(id, models.ContentStatusRejected, reviewer, comment)
+}
+
+func (s *ReviewService) setStatus(id, status, reviewer, comment string) (*models.Content, error) {
+	content, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Одобрить можно только озвученный текст
+	if status == models.ContentStatusApproved && content.AudioKey == "" {
+		return nil, fmt.Errorf("%w: content has no audio", ErrInvalidTransition)
+	}
+
+	now := time.Now()
+	content.Status = status
+	content.ReviewComment = comment
+	content.ReviewedBy = reviewer
+	content.ReviewedAt = &now
+
+	if err := s.db.Save(content).Error; err != nil {
+		return nil, fmt.Errorf("failed to save content: %w", err)
+	}
+
+	return content, nil
+}
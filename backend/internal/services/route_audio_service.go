@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RouteAudioService собирает объединенное аудио маршрута и хранит его, пока не изменятся части.
+// Ключ объекта содержит хэш ключей частей (RouteAudioVersion), поэтому смена любой части
+// дает новый ключ, а уже собранный файл отдается без повторной склейки.
+type RouteAudioService struct {
+	db    *gorm.DB
+	store AudioStore
+
+	mu    sync.Mutex
+	locks map[uuid.UUID]*routeAudioLock
+}
+
+// routeAudioLock - блокировка сборки одного маршрута; refs - сколько горутин ее ждут
+type routeAudioLock struct {
+	sync.Mutex
+	refs int
+}
+
+func NewRouteAudioService(db *gorm.DB, store AudioStore) *RouteAudioService {
+	return &RouteAudioService{
+		db:    db,
+		store: store,
+		locks: make(map[uuid.UUID]*routeAudioLock),
+	}
+}
+
+// RouteAudioKey - ключ объединенного аудио для версии частей
+func RouteAudioKey(routeID, version string) string {
+	return "routes/" + routeID + "/" + version + ".mp3"
+}
+
+// Merged возвращает ключ объединенного аудио из частей partKeys (по порядку точек),
+// собирая его, только если аудио для этой версии частей еще нет.
+// Сборки одного маршрута в процессе идут по очереди под мьютексом, и параллельный запрос
+// дождется готового файла. Между репликами склейка идет без блокировок: ключ зависит только
+// от частей, а хранилище пишет объект атомарно, так что одновременные сборки дают один и тот же
+// файл. Строка маршрута блокируется лишь на короткую транзакцию записи ключа. Предыдущая версия
+// не удаляется сразу - ее еще могут дослушивать, - а уходит в очередь фоновой очистки (RunStaleCleanup).
+func (s *RouteAudioService) Merged(routeID uuid.UUID, partKeys []string) (string, error) {
+	key := RouteAudioKey(routeID.String(), RouteAudioVersion(partKeys))
+
+	lock := s.lock(routeID)
+	defer s.unlock(routeID, lock)
+
+	var route models.Route
+	err := s.db.Select("id", "audio_key").First(&route, "id = ?", routeID).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("%w: route %s", ErrNotFound, routeID)
+		}
+		return "", fmt.Errorf("failed to load route: %w", err)
+	}
+
+	// Файл этой версии мог уже собрать другой запрос или реплика
+	_, err = s.store.Stat(key)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return "", err
+	}
+	if err == nil && route.AudioKey == key {
+		return key, nil
+	}
+	if err != nil {
+		// Файла нет (еще не собран или удален вручную) - собираем
+		if err := s.merge(key, partKeys); err != nil {
+			return "", err
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Ключ перечитываем под блокировкой строки: пока шла склейка, его могла сменить другая реплика
+		var current models.Route
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Select("id", "audio_key").First(&current, "id = ?", routeID).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: route %s", ErrNotFound, routeID)
+			}
+			return fmt.Errorf("failed to load route: %w", err)
+		}
+
+		// Версия снова в деле (например, точки вернули в прежний порядок) - не удаляем ее
+		if err := tx.Where("key = ?", key).Delete(&models.StaleAudio{}).Error; err != nil {
+			return fmt.Errorf("failed to update stale audio: %w", err)
+		}
+		if current.AudioKey == key {
+			return nil
+		}
+
+		if err := tx.Model(&current).Update("audio_key", key).Error; err != nil {
+			return fmt.Errorf("failed to save route audio: %w", err)
+		}
+		if current.AudioKey == "" {
+			return nil
+		}
+		stale := models.StaleAudio{Key: current.AudioKey}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&stale).Error; err != nil {
+			return fmt.Errorf("failed to schedule audio removal: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+// CleanupStale удаляет из хранилища замененные версии объединенного аудио старше gracePeriod:
+// к этому времени их уже дослушали, а временные ссылки на них истекли
+func (s *RouteAudioService) CleanupStale(gracePeriod time.Duration) (int, error) {
+	var stale []models.StaleAudio
+	if err := s.db.Where("created_at < ?", time.Now().Add(-gracePeriod)).Find(&stale).Error; err != nil {
+		return 0, fmt.Errorf("failed to query stale audio: %w", err)
+	}
+
+	removed := 0
+	for _, item := range stale {
+		if err := s.store.Delete(item.Key); err != nil {
+			log.Printf("Warning: failed to remove merged audio %s: %v", item.Key, err)
+			continue
+		}
+		if err := s.db.Delete(&item).Error; err != nil {
+			return removed, fmt.Errorf("failed to delete stale audio: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunStaleCleanup периодически запускает CleanupStale (вызывать в отдельной горутине)
+func (s *RouteAudioService) RunStaleCleanup(interval, gracePeriod time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		removed, err := s.CleanupStale(gracePeriod)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		if removed > 0 {
+			log.Printf("Removed %d stale merged audio files", removed)
+		}
+	}
+}
+
+// Remove удаляет объединенное аудио удаленного маршрута
+func (s *RouteAudioService) Remove(route *models.Route) {
+	if route.AudioKey == "" {
+		return
+	}
+
+	lock := s.lock(route.ID)
+	defer s.unlock(route.ID, lock)
+
+	if err := s.store.Delete(route.AudioKey); err != nil {
+		log.Printf("Warning: failed to remove merged audio %s: %v", route.AudioKey, err)
+	}
+}
+
+// merge склеивает MP3-части в один объект хранилища, не держа результат в памяти
+func (s *RouteAudioService) merge(key string, partKeys []string) error {
+	// Размер нужен хранилищу заранее - складываем размеры частей
+	var size int64
+	for _, partKey := range partKeys {
+		object, err := s.store.Stat(partKey)
+		if err != nil {
+			return fmt.Errorf("failed to stat %s: %w", partKey, err)
+		}
+		size += object.Size
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		for _, partKey := range partKeys {
+			part, _, err := s.store.Get(partKey)
+			if err != nil {
+				writer.CloseWithError(fmt.Errorf("failed to open %s: %w", partKey, err))
+				return
+			}
+
+			_, err = io.Copy(writer, part)
+			part.Close()
+
+			if err != nil {
+				writer.CloseWithError(fmt.Errorf("failed to copy %s: %w", partKey, err))
+				return
+			}
+		}
+		writer.Close()
+	}()
+
+	// Хранилище пишет объект атомарно, так что читатели не увидят недописанный файл
+	if err := s.store.Put(key, reader, size); err != nil {
+		reader.CloseWithError(err)
+		return err
+	}
+	return nil
+}
+
+func (s *RouteAudioService) lock(routeID uuid.UUID) *routeAudioLock {
+	s.mu.Lock()
+	lock, ok := s.locks[routeID]
+	if !ok {
+		lock = &routeAudioLock{}
+		s.locks[routeID] = lock
+	}
+	lock.refs++
+	s.mu.Unlock()
+
+	lock.Lock()
+	return lock
+}
+
+func (s *RouteAudioService) unlock(routeID uuid.UUID, lock *routeAudioLock) {
+	lock.Unlock()
+
+	s.mu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(s.locks, routeID)
+	}
+	s.mu.Unlock()
+}
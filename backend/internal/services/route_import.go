@@ -0,0 +1,419 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Форматы импортируемых файлов
+const (
+	ImportFormatGPX     = "gpx"
+	ImportFormatKML     = "kml"
+	ImportFormatGeoJSON = "geojson"
+)
+
+// MaxImportPoints - сколько мест можно импортировать в один маршрут
+const MaxImportPoints = 25
+
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// ImportedPoint - место из файла: название, описание и координаты
+type ImportedPoint struct {
+	Name        string
+	Description string
+	Lat         float64
+	Lon         float64
+}
+
+// ImportedRoute - маршрут из файла: места в порядке файла и линия трека (если есть)
+type ImportedRoute struct {
+	Format string
+	Name   string
+	Points []ImportedPoint
+	Track  []RoutePoint
+}
+
+// ParseRouteFile разбирает GPX, KML или GeoJSON. Формат определяется по расширению,
+// а если оно неизвестно - по содержимому.
+func ParseRouteFile(filename string, data []byte) (*ImportedRoute, error) {
+	var route *ImportedRoute
+	var err error
+
+	// Блокнот Windows и некоторые экспортеры пишут UTF-8 с BOM, JSON-декодер его не пропускает
+	data = bytes.TrimPrefix(data, utf8BOM)
+
+	switch format := detectImportFormat(filename, data); format {
+	case ImportFormatGPX:
+		route, err = parseGPX(data)
+	case ImportFormatKML:
+		route, err = parseKML(data)
+	case ImportFormatGeoJSON:
+		route, err = parseGeoJSON(data)
+	default:
+		return nil, validationError("unsupported file format, expected GPX, KML or GeoJSON")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(route.Points) == 0 {
+		return nil, validationError("no points found in %s file", route.Format)
+	}
+	if len(route.Points) > MaxImportPoints {
+		return nil, validationError("too many points in file: %d (max %d)", len(route.Points), MaxImportPoints)
+	}
+	for i, point := range route.Points {
+		if !validCoordinates(point.Lat, point.Lon) {
+			return nil, validationError("point %d has invalid coordinates", i+1)
+		}
+	}
+	for _, point := range route.Track {
+		if !validCoordinates(point.Lat, point.Lon) {
+			return nil, validationError("track has invalid coordinates")
+		}
+	}
+
+	// Ограничения как у custom_pois: название до 200 символов, описание до 2000
+	route.Name = truncateRunes(strings.TrimSpace(route.Name), 199)
+	for i := range route.Points {
+		route.Points[i].Name = truncateRunes(strings.TrimSpace(route.Points[i].Name), 199)
+		route.Points[i].Description = truncateRunes(strings.TrimSpace(route.Points[i].Description), 1999)
+	}
+	return route, nil
+}
+
+// detectImportFormat - формат по расширению файла или по первому элементу содержимого
+func detectImportFormat(filename string, data []byte) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".gpx":
+		return ImportFormatGPX
+	case ".kml":
+		return ImportFormatKML
+	case ".geojson", ".json":
+		return ImportFormatGeoJSON
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return ImportFormatGeoJSON
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch strings.ToLower(start.Name.Local) {
+			case "gpx":
+				return ImportFormatGPX
+			case "kml":
+				return ImportFormatKML
+			}
+			return ""
+		}
+	}
+}
+
+// GPX: места - wpt, а если их нет - точки маршрута rtept; линия - трек trk или маршрут rte
+type gpxFile struct {
+	Metadata struct {
+		Name string `xml:"name"`
+	} `xml:"metadata"`
+	Waypoints []gpxFilePoint `xml:"wpt"`
+	Routes    []struct {
+		Name   string         `xml:"name"`
+		Points []gpxFilePoint `xml:"rtept"`
+	} `xml:"rte"`
+	Tracks []struct {
+		Name     string `xml:"name"`
+		Segments []struct {
+			Points []gpxFilePoint `xml:"trkpt"`
+		} `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+type gpxFilePoint struct {
+	Lat     float64 `xml:"lat,attr"`
+	Lon     float64 `xml:"lon,attr"`
+	Name    string  `xml:"name"`
+	Desc    string  `xml:"desc"`
+	Comment string  `xml:"cmt"`
+}
+
+func (p gpxFilePoint) imported() ImportedPoint {
+	description := p.Desc
+	if description == "" {
+		description = p.Comment
+	}
+	return ImportedPoint{Name: p.Name, Description: description, Lat: p.Lat, Lon: p.Lon}
+}
+
+func parseGPX(data []byte) (*ImportedRoute, error) {
+	var file gpxFile
+	if err := xml.Unmarshal(data, &file); err != nil {
+		return nil, validationError("invalid GPX: %v", err)
+	}
+
+	route := &ImportedRoute{Format: ImportFormatGPX, Name: file.Metadata.Name}
+
+	for _, wpt := range file.Waypoints {
+		route.Points = append(route.Points, wpt.imported())
+	}
+
+	for _, trk := range file.Tracks {
+		if route.Name == "" {
+			route.Name = trk.Name
+		}
+		for _, segment := range trk.Segments {
+			for _, point := range segment.Points {
+				route.Track = append(route.Track, RoutePoint{Lat: point.Lat, Lon: point.Lon})
+			}
+		}
+	}
+
+	for _, rte := range file.Routes {
+		if route.Name == "" {
+			route.Name = rte.Name
+		}
+		for _, point := range rte.Points {
+			// Маршрут без отдельных wpt - его точки и есть места
+			if len(file.Waypoints) == 0 {
+				route.Points = append(route.Points, point.imported())
+			}
+			if len(file.Tracks) == 0 {
+				route.Track = append(route.Track, RoutePoint{Lat: point.Lat, Lon: point.Lon})
+			}
+		}
+	}
+
+	return route, nil
+}
+
+// KML: метки Placemark могут быть вложены в Document и Folder на любую глубину
+type kmlFilePlacemark struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	Point       *struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"Point"`
+	LineString *struct {
+		Coordinates string `xml:"coordinates"`
+	} `xml:"LineString"`
+}
+
+func parseKML(data []byte) (*ImportedRoute, error) {
+	route := &ImportedRoute{Format: ImportFormatKML}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var parents []string
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, validationError("invalid KML: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case t.Name.Local == "Placemark":
+				var placemark kmlFilePlacemark
+				if err := decoder.DecodeElement(&placemark, &t); err != nil {
+					return nil, validationError("invalid KML placemark: %v", err)
+				}
+				if err := route.addKMLPlacemark(placemark); err != nil {
+					return nil, err
+				}
+				continue
+			case t.Name.Local == "name" && route.Name == "" && len(parents) > 0 && parents[len(parents)-1] == "Document":
+				var name string
+				if err := decoder.DecodeElement(&name, &t); err != nil {
+					return nil, validationError("invalid KML: %v", err)
+				}
+				route.Name = name
+				continue
+			}
+			parents = append(parents, t.Name.Local)
+		case xml.EndElement:
+			if len(parents) > 0 {
+				parents = parents[:len(parents)-1]
+			}
+		}
+	}
+
+	return route, nil
+}
+
+// addKMLPlacemark добавляет метку: точку - в места, линию - в трек
+func (r *ImportedRoute) addKMLPlacemark(placemark kmlFilePlacemark) error {
+	if placemark.Point != nil {
+		coords, err := parseKMLCoordinates(placemark.Point.Coordinates)
+		if err != nil || len(coords) != 1 {
+			return validationError("invalid KML point coordinates in %q", placemark.Name)
+		}
+		r.Points = append(r.Points, ImportedPoint{
+			Name:        placemark.Name,
+			Description: plainText(placemark.Description),
+			Lat:         coords[0].Lat,
+			Lon:         coords[0].Lon,
+		})
+	}
+	if placemark.LineString != nil {
+		coords, err := parseKMLCoordinates(placemark.LineString.Coordinates)
+		if err != nil {
+			return validationError("invalid KML line coordinates in %q", placemark.Name)
+		}
+		r.Track = append(r.Track, coords...)
+	}
+	return nil
+}
+
+// parseKMLCoordinates разбирает список "долгота,широта[,высота]" через пробелы
+func parseKMLCoordinates(value string) ([]RoutePoint, error) {
+	var coords []RoutePoint
+	for _, tuple := range strings.Fields(value) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid coordinate %q", tuple)
+		}
+		lon, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			return nil, err
+		}
+		lat, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		coords = append(coords, RoutePoint{Lat: lat, Lon: lon})
+	}
+	return coords, nil
+}
+
+// GeoJSON (RFC 7946): FeatureCollection, отдельный Feature или голая геометрия
+type geoJSONObject struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"` // нестандартное, но частое имя коллекции
+	Features    []geoJSONObject        `json:"features"`
+	Geometry    *geoJSONObject         `json:"geometry"`
+	Geometries  []geoJSONObject        `json:"geometries"`
+	Properties  map[string]interface{} `json:"properties"`
+	Coordinates json.RawMessage        `json:"coordinates"`
+}
+
+func parseGeoJSON(data []byte) (*ImportedRoute, error) {
+	var object geoJSONObject
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, validationError("invalid GeoJSON: %v", err)
+	}
+
+	route := &ImportedRoute{Format: ImportFormatGeoJSON, Name: object.Name}
+	if err := route.addGeoJSON(object, nil); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// addGeoJSON добавляет объект: точки - в места (название и описание из свойств Feature), линии - в трек
+func (r *ImportedRoute) addGeoJSON(object geoJSONObject, properties map[string]interface{}) error {
+	switch object.Type {
+	case "FeatureCollection":
+		for _, feature := range object.Features {
+			if err := r.addGeoJSON(feature, nil); err != nil {
+				return err
+			}
+		}
+	case "Feature":
+		if object.Geometry == nil {
+			return nil
+		}
+		return r.addGeoJSON(*object.Geometry, object.Properties)
+	case "GeometryCollection":
+		for _, geometry := range object.Geometries {
+			if err := r.addGeoJSON(geometry, properties); err != nil {
+				return err
+			}
+		}
+	case "Point":
+		var coord []float64
+		if err := json.Unmarshal(object.Coordinates, &coord); err != nil || len(coord) < 2 {
+			return validationError("invalid GeoJSON point coordinates")
+		}
+		r.Points = append(r.Points, ImportedPoint{
+			Name:        stringProperty(properties, "name", "title"),
+			Description: plainText(stringProperty(properties, "description", "desc")),
+			Lat:         coord[1],
+			Lon:         coord[0],
+		})
+	case "LineString":
+		var coords [][]float64
+		if err := json.Unmarshal(object.Coordinates, &coords); err != nil {
+			return validationError("invalid GeoJSON line coordinates")
+		}
+		return r.addGeoJSONLine(coords)
+	case "MultiLineString":
+		var lines [][][]float64
+		if err := json.Unmarshal(object.Coordinates, &lines); err != nil {
+			return validationError("invalid GeoJSON line coordinates")
+		}
+		for _, line := range lines {
+			if err := r.addGeoJSONLine(line); err != nil {
+				return err
+			}
+		}
+	case "":
+		return validationError("invalid GeoJSON: missing type")
+	}
+	// Полигоны и прочие геометрии к маршруту не относятся
+	return nil
+}
+
+func (r *ImportedRoute) addGeoJSONLine(coords [][]float64) error {
+	for _, coord := range coords {
+		if len(coord) < 2 {
+			return validationError("invalid GeoJSON line coordinates")
+		}
+		r.Track = append(r.Track, RoutePoint{Lat: coord[1], Lon: coord[0]})
+	}
+	return nil
+}
+
+// stringProperty - первое непустое строковое свойство из перечисленных
+func stringProperty(properties map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := properties[key].(string); ok && strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+var (
+	htmlTag       = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlLineBreak = regexp.MustCompile(`(?i)<br\s*/?>|</p>`)
+)
+
+// plainText убирает HTML-разметку из описаний (KML и экспорт из карт хранят описание в HTML)
+func plainText(value string) string {
+	if !strings.Contains(value, "<") {
+		return strings.TrimSpace(html.UnescapeString(value))
+	}
+	value = htmlLineBreak.ReplaceAllString(value, "\n")
+	return strings.TrimSpace(html.UnescapeString(htmlTag.ReplaceAllString(value, "")))
+}
+
+func validCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180 && (lat != 0 || lon != 0)
+}
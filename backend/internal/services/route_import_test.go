@@ -0,0 +1,214 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readImportFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "import", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseRouteFile(t *testing.T) {
+	gpxRoute := &ImportedRoute{
+		Format: ImportFormatGPX,
+		Name:   "Маршрут без мест",
+		Points: []ImportedPoint{
+			{Name: "Эрмитаж", Lat: 59.9398, Lon: 30.3146},
+			{Name: "Исаакиевский собор", Description: "Крупнейший православный храм города", Lat: 59.9343, Lon: 30.3061},
+		},
+		Track: []RoutePoint{{Lat: 59.9398, Lon: 30.3146}, {Lat: 59.9343, Lon: 30.3061}},
+	}
+	kmlRoute := &ImportedRoute{
+		Format: ImportFormatKML,
+		Name:   "Казань за день",
+		Points: []ImportedPoint{
+			{Name: "Кремль", Description: "Казанский кремль\n\nОбъект & наследие", Lat: 55.7989, Lon: 49.1064},
+			{Name: "Улица Баумана", Lat: 55.7880, Lon: 49.1177},
+		},
+		Track: []RoutePoint{{Lat: 55.7989, Lon: 49.1064}, {Lat: 55.7930, Lon: 49.1120}, {Lat: 55.7880, Lon: 49.1177}},
+	}
+
+	tests := []struct {
+		name     string
+		filename string
+		fixture  string
+		want     *ImportedRoute
+	}{
+		{
+			// wpt - места, rtept при этом местами не считаются, линия - из трека
+			name:     "GPX wpt with rte and trk",
+			filename: "waypoints.gpx",
+			fixture:  "waypoints.gpx",
+			want: &ImportedRoute{
+				Format: ImportFormatGPX,
+				Name:   "Прогулка по центру",
+				Points: []ImportedPoint{
+					{Name: "Красная площадь", Description: "Главная площадь Москвы", Lat: 55.7539, Lon: 37.6208},
+					{Name: "Собор Василия Блаженного", Description: "Покровский собор", Lat: 55.7525, Lon: 37.6231},
+				},
+				Track: []RoutePoint{{Lat: 55.7539, Lon: 37.6208}, {Lat: 55.7532, Lon: 37.6220}, {Lat: 55.7525, Lon: 37.6231}},
+			},
+		},
+		{
+			name:     "GPX rtept without wpt",
+			filename: "route.gpx",
+			fixture:  "route.gpx",
+			want:     gpxRoute,
+		},
+		{
+			name:     "KML Point and LineString",
+			filename: "route.kml",
+			fixture:  "route.kml",
+			want:     kmlRoute,
+		},
+		{
+			name:     "GeoJSON feature types",
+			filename: "route.geojson",
+			fixture:  "route.geojson",
+			want: &ImportedRoute{
+				Format: ImportFormatGeoJSON,
+				Name:   "Нижний Новгород",
+				Points: []ImportedPoint{
+					{Name: "Кремль", Description: "Нижегородский кремль", Lat: 56.3287, Lon: 44.0037},
+					{Name: "Чкаловская лестница", Description: "Лестница к Волге", Lat: 56.3310, Lon: 44.0090},
+					{Name: "Коллекция", Lat: 56.3400, Lon: 44.0200},
+				},
+				Track: []RoutePoint{
+					{Lat: 56.3287, Lon: 44.0037}, {Lat: 56.3310, Lon: 44.0090},
+					{Lat: 56.3310, Lon: 44.0090}, {Lat: 56.3320, Lon: 44.0100}, {Lat: 56.3330, Lon: 44.0110},
+				},
+			},
+		},
+		{
+			name:     "format detected by content",
+			filename: "export.xml",
+			fixture:  "route.kml",
+			want:     kmlRoute,
+		},
+		{
+			name:     "BOM GPX by content",
+			filename: "export",
+			fixture:  "bom.gpx",
+			want:     gpxRoute,
+		},
+		{
+			name:     "BOM KML by extension",
+			filename: "route.KML",
+			fixture:  "bom.kml",
+			want:     kmlRoute,
+		},
+		{
+			name:     "BOM GeoJSON by content",
+			filename: "export.txt",
+			fixture:  "bom.geojson",
+			want: &ImportedRoute{
+				Format: ImportFormatGeoJSON,
+				Points: []ImportedPoint{{Name: "Площадь Минина", Lat: 56.3269, Lon: 44.0059}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRouteFile(tt.filename, readImportFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("ParseRouteFile: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseRouteFile =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// geoJSONPoints - коллекция из n точек
+func geoJSONPoints(n int) []byte {
+	features := make([]string, n)
+	for i := range features {
+		features[i] = fmt.Sprintf(`{"type": "Feature", "properties": {"name": "Место %d"}, "geometry": {"type": "Point", "coordinates": [37.6, %f]}}`,
+			i+1, 55.7+float64(i)*0.001)
+	}
+	return []byte(`{"type": "FeatureCollection", "features": [` + strings.Join(features, ",") + `]}`)
+}
+
+func TestParseRouteFileLimits(t *testing.T) {
+	route, err := ParseRouteFile("max.geojson", geoJSONPoints(MaxImportPoints))
+	if err != nil {
+		t.Fatalf("%d points: %v", MaxImportPoints, err)
+	}
+	if len(route.Points) != MaxImportPoints {
+		t.Errorf("%d points parsed, want %d", len(route.Points), MaxImportPoints)
+	}
+
+	_, err = ParseRouteFile("max.geojson", geoJSONPoints(MaxImportPoints+1))
+	if !errors.Is(err, ErrValidation) || !strings.Contains(err.Error(), "too many points") {
+		t.Errorf("%d points: err = %v, want too many points", MaxImportPoints+1, err)
+	}
+
+	// Длинные названия и описания обрезаются, а не отклоняются
+	long := strings.Repeat("я", 300)
+	data := fmt.Sprintf(`{"type": "Feature", "properties": {"name": "%s", "description": "%s"}, "geometry": {"type": "Point", "coordinates": [37.6, 55.7]}}`,
+		long, strings.Repeat(long, 10))
+	route, err = ParseRouteFile("long.geojson", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len([]rune(route.Points[0].Name)); n > 200 {
+		t.Errorf("name has %d runes, want at most 200", n)
+	}
+	if n := len([]rune(route.Points[0].Description)); n > 2000 {
+		t.Errorf("description has %d runes, want at most 2000", n)
+	}
+}
+
+func TestParseRouteFileErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     string
+		wantErr  string
+	}{
+		{"unknown extension and content", "notes.txt", "Красная площадь, 55.75, 37.62", "unsupported file format"},
+		{"unknown XML root", "map.xml", `<?xml version="1.0"?><osm version="0.6"></osm>`, "unsupported file format"},
+		{"empty file", "route", "", "unsupported file format"},
+		{"broken GPX", "route.gpx", `<gpx><wpt lat="55.7" lon="37.6">`, "invalid GPX"},
+		{"GPX without points", "route.gpx", `<gpx><trk><trkseg><trkpt lat="55.7" lon="37.6"/></trkseg></trk></gpx>`, "no points found in gpx file"},
+		{"KML point with line coordinates", "route.kml",
+			`<kml><Placemark><name>A</name><Point><coordinates>37.6,55.7 37.7,55.8</coordinates></Point></Placemark></kml>`,
+			"invalid KML point coordinates"},
+		{"KML bad coordinate", "route.kml",
+			`<kml><Placemark><name>A</name><Point><coordinates>37.6</coordinates></Point></Placemark></kml>`,
+			"invalid KML point coordinates"},
+		{"GeoJSON without type", "route.geojson", `{"features": []}`, "missing type"},
+		{"GeoJSON bad point", "route.geojson", `{"type": "Point", "coordinates": [37.6]}`, "invalid GeoJSON point coordinates"},
+		{"GeoJSON only polygon", "route.geojson", `{"type": "Polygon", "coordinates": [[[37.6, 55.7], [37.7, 55.7], [37.6, 55.7]]]}`, "no points found"},
+		{"point out of range", "route.geojson", `{"type": "Point", "coordinates": [37.6, 95]}`, "point 1 has invalid coordinates"},
+		{"point at null island", "route.geojson", `{"type": "Point", "coordinates": [0, 0]}`, "point 1 has invalid coordinates"},
+		{"track out of range", "route.gpx",
+			`<gpx><wpt lat="55.7" lon="37.6"/><trk><trkseg><trkpt lat="55.7" lon="237.6"/></trkseg></trk></gpx>`,
+			"track has invalid coordinates"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseRouteFile(tt.filename, []byte(tt.data))
+			if !errors.Is(err, ErrValidation) {
+				t.Fatalf("err = %v, want ErrValidation", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
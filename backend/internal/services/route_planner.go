@@ -0,0 +1,177 @@
+package services
+
+import (
+	"math"
+	"sort"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/google/uuid"
+)
+
+// RoutePlanner собирает маршрут из обязательных точек и автоподобранных мест
+// так, чтобы прогулка укладывалась в бюджет времени
+type RoutePlanner struct {
+	speed        float64 // м/мин
+	dwellMinutes float64 // время на точке (прослушивание рассказа)
+}
+
+func NewRoutePlanner() *RoutePlanner {
+	return &RoutePlanner{
+		speed:        83, // 5 км/ч
+		dwellMinutes: 5,
+	}
+}
+
+// PlanRequest - параметры планирования
+type PlanRequest struct {
+	StartLat      float64
+	StartLon      float64
+	Fixed         []models.POI // обязательные точки (попадают в маршрут всегда)
+	Candidates    []models.POI // места для автоподбора, отсортированные по важности
+	BudgetMinutes int
+	MaxStops      int     // ограничение на общее число точек (обязательные не отбрасываются)
+	OptimizeOrder bool    // упорядочить обязательные точки по близости (иначе - как в запросе)
+	Speed         float64 // скорость передвижения, м/мин (0 - пешком)
+	// Точка финиша: nil - маршрут заканчивается на последнем месте,
+	// совпадает со стартом - кольцевой маршрут
+	End *RoutePoint
+}
+
+// Plan - результат планирования
+type Plan struct {
+	POIs            []models.POI
+	DistanceMeters  float64 // по прямой между точками, включая путь до финиша
+	DurationMinutes int
+}
+
+// Plan при необходимости упорядочивает обязательные точки и вставляет между ними подходящие
+// по времени места из кандидатов (вставка с минимальным удлинением маршрута)
+func (p *RoutePlanner) Plan(req PlanRequest) Plan {
+	stops := make([]models.POI, len(req.Fixed))
+	copy(stops, req.Fixed)
+	if req.OptimizeOrder {
+		if req.End != nil && (req.End.Lat != req.StartLat || req.End.Lon != req.StartLon) {
+			stops = p.orderAlong(req.StartLat, req.StartLon, *req.End, stops)
+		} else {
+			stops = p.orderByNearest(req.StartLat, req.StartLon, stops)
+		}
+	}
+
+	used := make(map[uuid.UUID]bool, len(stops))
+	for _, poi := range stops {
+		used[poi.ID] = true
+	}
+
+	budget := float64(req.BudgetMinutes)
+	for _, candidate := range req.Candidates {
+		if len(stops) >= req.MaxStops {
+			break
+		}
+		if used[candidate.ID] {
+			continue
+		}
+
+		// Ищем позицию, где кандидат удлиняет маршрут меньше всего.
+		// Вставка не меняет взаимный порядок обязательных точек.
+		bestPos := -1
+		bestDistance := math.Inf(1)
+		for pos := 0; pos <= len(stops); pos++ {
+			distance := p.pathDistance(req, insertAt(stops, pos, candidate))
+			if distance < bestDistance {
+				bestDistance = distance
+				bestPos = pos
+			}
+		}
+
+		if p.duration(req, bestDistance, len(stops)+1) > budget {
+			continue
+		}
+
+		stops = insertAt(stops, bestPos, candidate)
+		used[candidate.ID] = true
+	}
+
+	distance := p.pathDistance(req, stops)
+
+	return Plan{
+		POIs:            stops,
+		DistanceMeters:  distance,
+		DurationMinutes: int(math.Ceil(p.duration(req, distance, len(stops)))),
+	}
+}
+
+// EstimateMinutes оценивает длительность прогулки по времени в пути и числу остановок
+func (p *RoutePlanner) EstimateMinutes(travelSeconds, stops int) int {
+	return int(math.Ceil(float64(travelSeconds)/60 + float64(stops)*p.dwellMinutes))
+}
+
+// orderByNearest упорядочивает точки жадно: каждый раз идем к ближайшей непосещенной
+func (p *RoutePlanner) orderByNearest(lat, lon float64, pois []models.POI) []models.POI {
+	ordered := make([]models.POI, 0, len(pois))
+	remaining := append([]models.POI(nil), pois...)
+
+	for len(remaining) > 0 {
+		nearest := 0
+		for i := 1; i < len(remaining); i++ {
+			if calculateDistance(lat, lon, remaining[i].Latitude, remaining[i].Longitude) <
+				calculateDistance(lat, lon, remaining[nearest].Latitude, remaining[nearest].Longitude) {
+				nearest = i
+			}
+		}
+
+		next := remaining[nearest]
+		ordered = append(ordered, next)
+		lat, lon = next.Latitude, next.Longitude
+		remaining = append(remaining[:nearest], remaining[nearest+1:]...)
+	}
+
+	return ordered
+}
+
+// orderAlong упорядочивает точки по проекции на направление старт -> финиш,
+// чтобы маршрут шел к финишу без возвратов
+func (p *RoutePlanner) orderAlong(lat, lon float64, end RoutePoint, pois []models.POI) []models.POI {
+	// Локальная плоская проекция: на масштабах города искажения несущественны
+	scale := math.Cos(lat * math.Pi / 180)
+	dx, dy := (end.Lon-lon)*scale, end.Lat-lat
+
+	progress := func(poi models.POI) float64 {
+		return (poi.Longitude-lon)*scale*dx + (poi.Latitude-lat)*dy
+	}
+
+	ordered := append([]models.POI(nil), pois...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return progress(ordered[i]) < progress(ordered[j])
+	})
+	return ordered
+}
+
+// pathDistance - длина пути от старта через все точки (и до финиша, если он задан) по прямой
+func (p *RoutePlanner) pathDistance(req PlanRequest, stops []models.POI) float64 {
+	lat, lon := req.StartLat, req.StartLon
+	total := 0.0
+	for _, poi := range stops {
+		total += calculateDistance(lat, lon, poi.Latitude, poi.Longitude)
+		lat, lon = poi.Latitude, poi.Longitude
+	}
+	if req.End != nil {
+		total += calculateDistance(lat, lon, req.End.Lat, req.End.Lon)
+	}
+	return total
+}
+
+// duration - время прогулки в минутах: дорога плюс остановки на точках
+func (p *RoutePlanner) duration(req PlanRequest, distance float64, stops int) float64 {
+	speed := req.Speed
+	if speed <= 0 {
+		speed = p.speed
+	}
+	return distance/speed + float64(stops)*p.dwellMinutes
+}
+
+func insertAt(pois []models.POI, pos int, poi models.POI) []models.POI {
+	result := make([]models.POI, 0, len(pois)+1)
+	result = append(result, pois[:pos]...)
+	result = append(result, poi)
+	return append(result, pois[pos:]...)
+}
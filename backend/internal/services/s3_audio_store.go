@@ -0,0 +1,351 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service         = "s3"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3TimeFormat      = "20060102T150405Z"
+	s3DateFormat      = "20060102"
+)
+
+// S3AudioStore хранит аудио в S3-совместимом хранилище (Yandex Object Storage, MinIO).
+// Запросы подписываются AWS Signature V4.
+type S3AudioStore struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	pathStyle bool // bucket в пути (MinIO), иначе в имени хоста
+	client    *http.Client
+}
+
+func NewS3AudioStore() (*S3AudioStore, error) {
+	rawEndpoint := os.Getenv("S3_ENDPOINT")
+	if rawEndpoint == "" {
+		rawEndpoint = "https://storage.yandexcloud.net"
+	}
+	endpoint, err := url.Parse(rawEndpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", rawEndpoint)
+	}
+
+	region := os.Getenv("S3_REGION")
+	if region == "" {
+		region = "ru-central1"
+	}
+
+	store := &S3AudioStore{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    os.Getenv("S3_BUCKET"),
+		accessKey: os.Getenv("S3_ACCESS_KEY"),
+		secretKey: os.Getenv("S3_SECRET_KEY"),
+		pathStyle: os.Getenv("S3_PATH_STYLE") != "false",
+		client:    &http.Client{Timeout: 5 * time.Minute},
+	}
+	if store.bucket == "" || store.accessKey == "" || store.secretKey == "" {
+		return nil, fmt.Errorf("S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY are required for AUDIO_STORE=s3")
+	}
+	return store, nil
+}
+
+func (s *S3AudioStore) Put(key string, data io.Reader, size int64) error {
+	req, err := s.newRequest(http.MethodPut, key, data)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "audio/mpeg")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get возвращает читатель, который при перемотке запрашивает у S3 нужный диапазон байт
+func (s *S3AudioStore) Get(key string) (io.ReadSeekCloser, *AudioObject, error) {
+	object, err := s.Stat(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &s3Reader{store: s, key: key, size: object.Size}, object, nil
+}
+
+func (s *S3AudioStore) Stat(key string) (*AudioObject, error) {
+	req, err := s.newRequest(http.MethodHead, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return s.object(key, resp), nil
+}
+
+func (s *S3AudioStore) Delete(key string) error {
+	req, err := s.newRequest(http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// PresignedURL подписывает GET-ссылку параметрами запроса (срок - до 7 суток)
+func (s *S3AudioStore) PresignedURL(key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		return "", nil
+	}
+	if ttl > 7*24*time.Hour {
+		ttl = 7 * 24 * time.Hour
+	}
+	return s.presign(key, ttl, time.Now().UTC()), nil
+}
+
+func (s *S3AudioStore) presign(key string, ttl time.Duration, now time.Time) string {
+	u := s.objectURL(key)
+	scope := s.scope(now)
+
+	query := url.Values{}
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.accessKey+"/"+scope)
+	query.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(ttl.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+
+	canonical := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery(query),
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	query.Set("X-Amz-Signature", s.signature(now, scope, canonical))
+	u.RawQuery = canonicalQuery(query)
+	return u.String()
+}
+
+// newRequest создает подписанный запрос к объекту
+func (s *S3AudioStore) newRequest(method, key string, body io.Reader) (*http.Request, error) {
+	if key == "" {
+		return nil, fmt.Errorf("invalid audio key %q", key)
+	}
+
+	u := s.objectURL(key)
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	now := time.Now().UTC()
+	scope := s.scope(now)
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		"",
+		"host:" + u.Host,
+		"x-amz-content-sha256:" + s3UnsignedPayload,
+		"x-amz-date:" + now.Format(s3TimeFormat) + "\n",
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, s.signature(now, scope, canonical)))
+	return req, nil
+}
+
+// do выполняет запрос; 404 превращается в ErrNotFound, прочие ошибки - в UpstreamError
+func (s *S3AudioStore) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, upstreamCallError("Object Storage", err)
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: audio %s", ErrNotFound, strings.TrimPrefix(req.URL.Path, "/"))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, upstreamResponseError("Object Storage", resp)
+	}
+	return resp, nil
+}
+
+func (s *S3AudioStore) object(key string, resp *http.Response) *AudioObject {
+	object := &AudioObject{Key: key, Size: resp.ContentLength}
+	if modTime, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		object.ModTime = modTime
+	}
+	return object
+}
+
+func (s *S3AudioStore) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	escapedKey := escapeS3Key(key)
+	if s.pathStyle {
+		u.Path = strings.TrimSuffix(s.endpoint.Path, "/") + "/" + s.bucket + "/" + key
+		u.RawPath = strings.TrimSuffix(s.endpoint.EscapedPath(), "/") + "/" + s.bucket + "/" + escapedKey
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escapedKey
+	}
+	return &u
+}
+
+// s3Reader читает объект S3 с позиции offset; тело ответа открывается лениво при первом чтении
+type s3Reader struct {
+	store  *S3AudioStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		req, err := r.store.newRequest(http.MethodGet, r.key, nil)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+
+		resp, err := r.store.do(req)
+		if err != nil {
+			return 0, err
+		}
+		r.body = resp.Body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid seek offset %d", offset)
+	}
+
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+func (s *S3AudioStore) scope(now time.Time) string {
+	return now.Format(s3DateFormat) + "/" + s.region + "/" + s3Service + "/aws4_request"
+}
+
+// signature вычисляет подпись SigV4 для канонического запроса
+func (s *S3AudioStore) signature(now time.Time, scope, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(s3TimeFormat),
+		scope,
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format(s3DateFormat))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapeS3Key кодирует ключ по правилам SigV4: все, кроме A-Z a-z 0-9 - _ . ~ и /
+func escapeS3Key(key string) string {
+	var b strings.Builder
+	for _, c := range []byte(key) {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// canonicalQuery - параметры, отсортированные по имени и закодированные по правилам SigV4
+func canonicalQuery(values url.Values) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range values[key] {
+			parts = append(parts, escapeS3Key(key)+"="+strings.ReplaceAll(escapeS3Key(value), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
@@ -0,0 +1,120 @@
+package services
+
+import "github.com/dimmy-kor/audioguid/internal/models"
+
+// Способы передвижения по маршруту
+const (
+	TransportWalking         = "walking"
+	TransportCycling         = "cycling"
+	TransportPublicTransport = "public_transport"
+	TransportCar             = "car"
+)
+
+// TransportProfile - модель скорости и радиуса поиска для способа передвижения
+type TransportProfile struct {
+	Mode        string
+	Speed       float64 // средняя скорость, м/мин
+	MaxRadius   float64 // максимальный радиус автоподбора мест, м
+	RoutingType string  // transport в 2GIS Routing API
+	// 2GIS не строит маршруты на общественном транспорте через Routing API:
+	// линию берем пешеходную, а время считаем по средней скорости
+	EstimateDuration bool
+	// Рассказ звучит в пути (велосипед, транспорт, машина), а не на остановке у места
+	NarrateInTransit bool
+	// Радиус срабатывания рассказа у места по умолчанию, м (у места можно задать свой)
+	TriggerRadius float64
+	// Дальше этого от линии маршрута пользователь считается сошедшим с маршрута, м
+	OffRouteDistance float64
+}
+
+var transportProfiles = map[string]TransportProfile{
+	TransportWalking: {
+		Mode:             TransportWalking,
+		Speed:            83, // 5 км/ч
+		MaxRadius:        5000,
+		RoutingType:      "walking",
+		TriggerRadius:    30,
+		OffRouteDistance: 50,
+	},
+	TransportCycling: {
+		Mode:             TransportCycling,
+		Speed:            250, // 15 км/ч
+		MaxRadius:        12000,
+		RoutingType:      "bicycle",
+		NarrateInTransit: true,
+		TriggerRadius:    60,
+		OffRouteDistance: 80,
+	},
+	TransportPublicTransport: {
+		Mode:             TransportPublicTransport,
+		Speed:            300, // 18 км/ч с учетом ожидания и пересадок
+		MaxRadius:        15000,
+		RoutingType:      "walking",
+		EstimateDuration: true,
+		NarrateInTransit: true,
+		TriggerRadius:    150,
+		OffRouteDistance: 200,
+	},
+	TransportCar: {
+		Mode:             TransportCar,
+		Speed:            420, // 25 км/ч в городе
+		MaxRadius:        25000,
+		RoutingType:      "driving",
+		NarrateInTransit: true,
+		TriggerRadius:    150,
+		OffRouteDistance: 150,
+	},
+}
+
+// TransportProfileFor возвращает профиль способа передвижения (по умолчанию - пешком)
+func TransportProfileFor(mode string) TransportProfile {
+	if profile, ok := transportProfiles[mode]; ok {
+		return profile
+	}
+	return transportProfiles[TransportWalking]
+}
+
+// SearchRadius - радиус автоподбора мест для прогулки заданной длительности
+func (p TransportProfile) SearchRadius(minutes int) float64 {
+	radius := float64(minutes) * p.Speed
+	if radius > p.MaxRadius {
+		radius = p.MaxRadius
+	}
+	return radius
+}
+
+// TriggerRadiusFor - радиус срабатывания рассказа у места: заданный для места или по умолчанию
+func (p TransportProfile) TriggerRadiusFor(poi models.POI) float64 {
+	if poi.TriggerRadius > 0 {
+		return float64(poi.TriggerRadius)
+	}
+	return p.TriggerRadius
+}
+
+// TravelSeconds - время в пути на заданное расстояние
+func (p TransportProfile) TravelSeconds(meters float64) int {
+	return int(meters * 60 / p.Speed)
+}
+
+// Длительность рассказа о месте, секунды
+const (
+	defaultNarrationSeconds = 150 // 2-3 минуты, как на пешеходном маршруте
+	maxNarrationSeconds     = 480
+)
+
+// NarrationSeconds подбирает длительность рассказа под время в пути до места:
+// на долгих перегонах рассказ длиннее, но не короче обычного.
+// Пешком рассказ слушают у места, поэтому его длина не зависит от перехода.
+func (p TransportProfile) NarrationSeconds(legSeconds int) int {
+	if !p.NarrateInTransit {
+		return defaultNarrationSeconds
+	}
+	target := legSeconds * 4 / 5
+	if target < defaultNarrationSeconds {
+		return defaultNarrationSeconds
+	}
+	if target > maxNarrationSeconds {
+		return maxNarrationSeconds
+	}
+	return target
+}
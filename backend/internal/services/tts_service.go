@@ -1,12 +1,13 @@
 package services
 
 import (
+	"bytes"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 )
 
 // TTSService генерирует аудио через Yandex SpeechKit
@@ -17,20 +18,22 @@ type TTSService struct {
 	iamToken string
 	voice    string
 	client   *http.Client
+	store    AudioStore
 }
 
-func NewTTSService() *TTSService {
+func NewTTSService(store AudioStore) *TTSService {
 	return &TTSService{
 		apiKey:   os.Getenv("YANDEX_API_KEY"),
 		folderID: os.Getenv("YANDEX_FOLDER_ID"),
 		baseURL:  "https://tts.api.cloud.yandex.net/speech/v1/tts:synthesize",
 		voice:    "ermil", // Фиксированный голос Ermil (мужской, эмоциональный)
 		client:   &http.Client{},
+		store:    store,
 	}
 }
 
-// GenerateAudio генерирует аудио из текста
-func (s *TTSService) GenerateAudio(text, filename string) (string, int, error) {
+// GenerateAudio генерирует аудио из текста для точки маршрута и возвращает ключ в хранилище
+func (s *TTSService) GenerateAudio(text, waypointID string) (string, int, error) {
 	if s.apiKey == "" {
 		return "", 0, fmt.Errorf("YANDEX_API_KEY not set")
 	}
@@ -57,42 +60,33 @@ func (s *TTSService) GenerateAudio(text, filename string) (string, int, error) {
 
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to call Yandex SpeechKit API: %w", err)
+		return "", 0, upstreamCallError("Yandex SpeechKit", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", 0, fmt.Errorf("Yandex SpeechKit API error (status %d): %s", resp.StatusCode, string(body))
+		return "", 0, upstreamResponseError("Yandex SpeechKit", resp)
 	}
 
-	// Сохраняем аудио
-	audioDir := "./audio"
-	if err := os.MkdirAll(audioDir, 0755); err != nil {
-		return "", 0, fmt.Errorf("failed to create audio directory: %w", err)
-	}
-
-	audioPath := filepath.Join(audioDir, filename+".mp3")
-	file, err := os.Create(audioPath)
-	if err != nil {
-		return "", 0, fmt.Errorf("failed to create audio file: %w", err)
-	}
-	defer file.Close()
-
 	audioData, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return "", 0, fmt.Errorf("failed to read audio data: %w", err)
 	}
 
-	if _, err := file.Write(audioData); err != nil {
-		return "", 0, fmt.Errorf("failed to write audio file: %w", err)
+	// Сохраняем аудио
+	key := WaypointAudioKey(waypointID, audioData)
+	if err := s.store.Put(key, bytes.NewReader(audioData), int64(len(audioData))); err != nil {
+		return "", 0, fmt.Errorf("failed to store audio: %w", err)
 	}
 
-	// Примерная длительность: 150 слов в минуту
+	// Длительность по кадрам MP3; если разобрать не удалось - примерно, 150 слов в минуту
 	words := len(text) / 5 // примерное количество слов
 	durationSeconds := (words * 60) / 150
+	if seconds, ok := MP3Duration(audioData); ok {
+		durationSeconds = int(math.Round(seconds))
+	}
 
-	return audioPath, durationSeconds, nil
+	return key, durationSeconds, nil
 }
 
 // Голос зафиксирован на "ermil" (мужской, эмоциональный)
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dimmy-kor/audioguid/internal/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Отметка last_seen_at обновляется не чаще раза в час
+const userTouchInterval = time.Hour
+
+// UserService ведет пользователей приложения и их избранное
+type UserService struct {
+	db *gorm.DB
+}
+
+func NewUserService(db *gorm.DB) *UserService {
+	return &UserService{db: db}
+}
+
+// Ensure возвращает пользователя по subject из JWT, создавая его при первом обращении
+func (s *UserService) Ensure(subject, name string) (*models.User, error) {
+	now := time.Now()
+	user := models.User{Subject: subject, Name: name, LastSeenAt: now}
+
+	err := s.db.Where("subject = ?", subject).Attrs(user).FirstOrCreate(&user).Error
+	if err != nil {
+		// Параллельный запрос мог создать пользователя раньше нас
+		if err := s.db.Where("subject = ?", subject).First(&user).Error; err != nil {
+			return nil, fmt.Errorf("failed to load user: %w", err)
+		}
+	}
+
+	updates := map[string]interface{}{}
+	if name != "" && user.Name != name {
+		updates["name"] = name
+	}
+	if now.Sub(user.LastSeenAt) > userTouchInterval {
+		updates["last_seen_at"] = now
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(&user).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	return &user, nil
+}
+
+// AddFavorite добавляет место или маршрут в избранное; повторное добавление не ошибка.
+// Приватное место можно добавить, только если оно из маршрута этого пользователя.
+func (s *UserService) AddFavorite(userID uuid.UUID, kind string, targetID uuid.UUID) error {
+	var count int64
+	var err error
+	switch kind {
+	case models.FavoriteKindPOI:
+		err = s.db.Model(&models.POI{}).
+			Where("id = ? AND (visibility = ? OR owner_route_id IN (?))", targetID, models.POIVisibilityPublic,
+				s.db.Model(&models.Route{}).Select("id").Where("user_id = ?", userID)).
+			Count(&count).Error
+	case models.FavoriteKindRoute:
+		err = s.db.Model(&models.Route{}).Where("id = ?", targetID).Count(&count).Error
+	default:
+		return validationError("unknown favorite kind %q", kind)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check favorite target: %w", err)
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: %s %s", ErrNotFound, kind, targetID)
+	}
+
+	favorite := models.Favorite{UserID: userID, Kind: kind, TargetID: targetID}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&favorite).Error; err != nil {
+		return fmt.Errorf("failed to save favorite: %w", err)
+	}
+	return nil
+}
+
+// RemoveFavorite убирает место или маршрут из избранного
+func (s *UserService) RemoveFavorite(userID uuid.UUID, kind string, targetID uuid.UUID) error {
+	err := s.db.Where("user_id = ? AND kind = ? AND target_id = ?", userID, kind, targetID).
+		Delete(&models.Favorite{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to remove favorite: %w", err)
+	}
+	return nil
+}
+
+// FavoriteIDs возвращает ID избранного одного типа, новые сверху
+func (s *UserService) FavoriteIDs(userID uuid.UUID, kind string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	err := s.db.Model(&models.Favorite{}).
+		Where("user_id = ? AND kind = ?", userID, kind).
+		Order("created_at DESC").
+		Pluck("target_id", &ids).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query favorites: %w", err)
+	}
+	return ids, nil
+}
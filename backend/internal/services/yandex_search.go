@@ -0,0 +1,152 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Разбор XML-ответа Yandex Search API
+// Формат описан в https://yandex.ru/dev/xml/doc/ru/response
+
+// Код ошибки Yandex XML "искомая комбинация слов нигде не встречается"
+const yandexSearchNoResultsCode = 15
+
+// SearchResult - найденный документ с фрагментами текста
+type SearchResult struct {
+	URL      string
+	Title    string
+	Passages []string
+}
+
+type yandexSearchXML struct {
+	XMLName  xml.Name `xml:"yandexsearch"`
+	Response struct {
+		Error *struct {
+			Code    int    `xml:"code,attr"`
+			Message string `xml:",chardata"`
+		} `xml:"error"`
+		Groups []struct {
+			Docs []yandexSearchDoc `xml:"doc"`
+		} `xml:"results>grouping>group"`
+	} `xml:"response"`
+}
+
+type yandexSearchDoc struct {
+	URL      string    `xml:"url"`
+	Title    xmlText   `xml:"title"`
+	Headline xmlText   `xml:"headline"`
+	Passages []xmlText `xml:"passages>passage"`
+}
+
+// xmlText собирает текст элемента вместе с вложенной разметкой (<hlword> и т.п.)
+type xmlText string
+
+func (t *xmlText) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var sb strings.Builder
+	depth := 0
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok := token.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			if depth == 0 {
+				*t = xmlText(normalizeSearchText(sb.String()))
+				return nil
+			}
+			depth--
+		case xml.CharData:
+			sb.Write(tok)
+		}
+	}
+}
+
+// parseSearchResponse разбирает XML-ответ Yandex Search API
+func parseSearchResponse(data []byte) ([]SearchResult, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// В сниппетах встречаются HTML-сущности (&nbsp;, &laquo; и т.п.)
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var parsed yandexSearchXML
+	if err := decoder.Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	if e := parsed.Response.Error; e != nil {
+		if e.Code == yandexSearchNoResultsCode {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("search API error (code %d): %s", e.Code, strings.TrimSpace(e.Message))
+	}
+
+	results := []SearchResult{}
+	for _, group := range parsed.Response.Groups {
+		for _, doc := range group.Docs {
+			result := SearchResult{
+				URL:   strings.TrimSpace(doc.URL),
+				Title: string(doc.Title),
+			}
+
+			for _, passage := range doc.Passages {
+				if passage != "" {
+					result.Passages = append(result.Passages, string(passage))
+				}
+			}
+
+			// Если пассажей нет, используем аннотацию документа
+			if len(result.Passages) == 0 && doc.Headline != "" {
+				result.Passages = append(result.Passages, string(doc.Headline))
+			}
+
+			if result.URL == "" || len(result.Passages) == 0 {
+				continue
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// formatSearchResults собирает фрагменты для промпта и возвращает адреса использованных источников
+func formatSearchResults(results []SearchResult, maxPassages int) (string, []string) {
+	var lines []string
+	var sources []string
+
+	for _, result := range results {
+		if len(lines) >= maxPassages {
+			break
+		}
+
+		used := false
+		for _, passage := range result.Passages {
+			if len(lines) >= maxPassages {
+				break
+			}
+			lines = append(lines, "- "+passage)
+			used = true
+		}
+
+		if used {
+			sources = append(sources, result.URL)
+		}
+	}
+
+	return strings.Join(lines, "\n"), sources
+}
+
+// normalizeSearchText декодирует оставшиеся HTML-сущности и схлопывает пробелы
+func normalizeSearchText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func readSearchFixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "search", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestParseSearchResponse(t *testing.T) {
+	got, err := parseSearchResponse(readSearchFixture(t, "results.xml"))
+	if err != nil {
+		t.Fatalf("parseSearchResponse: %v", err)
+	}
+
+	// Документы без адреса или без текста пропускаются, пустой пассаж отбрасывается
+	want := []SearchResult{
+		{
+			URL:   "https://spb-guide.ru/isaac",
+			Title: "Исаакиевский собор — история",
+			Passages: []string{
+				"Собор строили сорок лет, с 1818 по 1858 год.",
+				"Архитектор «Огюст Монферран» & его ученики",
+			},
+		},
+		{
+			URL:      "https://example.ru/headline",
+			Title:    "Только аннотация",
+			Passages: []string{"Высота собора 101,5 м"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSearchResponse =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseSearchResponseEmpty(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+	}{
+		{"no results error code", "empty.xml"},
+		{"no groups", "no_groups.xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSearchResponse(readSearchFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatalf("parseSearchResponse: %v", err)
+			}
+			if len(got) != 0 {
+				t.Errorf("parseSearchResponse = %v, want no results", got)
+			}
+		})
+	}
+}
+
+func TestParseSearchResponseErrors(t *testing.T) {
+	_, err := parseSearchResponse(readSearchFixture(t, "error.xml"))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if want := "search API error (code 32): Превышен дневной лимит запросов"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err.Error(), want)
+	}
+
+	for _, body := range []string{"", "not xml", `{"error": "json instead of xml"}`, "<yandexsearch><response>"} {
+		if _, err := parseSearchResponse([]byte(body)); err == nil {
+			t.Errorf("parseSearchResponse(%q): expected error", body)
+		}
+	}
+}
+
+func TestXMLTextUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		want string
+	}{
+		{"plain text", "<t>Красная площадь</t>", "Красная площадь"},
+		{"highlighted words", "<t><hlword>Красная</hlword> <hlword>площадь</hlword> в Москве</t>", "Красная площадь в Москве"},
+		{"nested markup", "<t>до <b>после <hlword>слово</hlword></b> конец</t>", "до после слово конец"},
+		{"whitespace collapsed", "<t>\n  много   \t пробелов \n</t>", "много пробелов"},
+		{"entities", "<t>&lt;b&gt; &amp; &#171;кавычки&#187;</t>", "<b> & «кавычки»"},
+		{"empty", "<t></t>", ""},
+		{"only highlight", "<t><hlword>один</hlword></t>", "один"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got xmlText
+			if err := xml.NewDecoder(strings.NewReader(tt.xml)).Decode(&got); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("xmlText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	var got xmlText
+	if err := xml.NewDecoder(strings.NewReader("<t>обрыв <hlword>текста")).Decode(&got); err == nil {
+		t.Errorf("truncated element: expected error, got %q", got)
+	}
+}
+
+func TestFormatSearchResults(t *testing.T) {
+	results := []SearchResult{
+		{URL: "https://a.ru", Passages: []string{"первый", "второй"}},
+		{URL: "https://b.ru", Passages: []string{"третий"}},
+		{URL: "https://c.ru", Passages: []string{"четвертый"}},
+	}
+
+	text, sources := formatSearchResults(results, 3)
+	if want := "- первый\n- второй\n- третий"; text != want {
+		t.Errorf("text = %q, want %q", text, want)
+	}
+	if want := []string{"https://a.ru", "https://b.ru"}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("sources = %v, want %v", sources, want)
+	}
+}